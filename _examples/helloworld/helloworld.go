@@ -37,9 +37,9 @@ func (i *Iter) Next() (vtab.Row, error) {
 }
 
 var cols = []vtab.Column{
-	{"message", "TEXT", false, false, nil, vtab.NONE},
-	{"times", "INTEGER", false, true, []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}, vtab.NONE},
-	{"name", "TEXT", false, true, []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}, vtab.NONE},
+	{Name: "message", Type: "TEXT"},
+	{Name: "times", Type: "INTEGER", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	{Name: "name", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
 }
 
 func init() {
@@ -63,13 +63,16 @@ func init() {
 		return &Iter{0, total, name}, nil
 	})
 
-	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
-		if err := api.CreateModule("helloworld", m,
-			sqlite.EponymousOnly(true), sqlite.ReadOnly(true)); err != nil {
-			return sqlite.SQLITE_ERROR, err
-		}
-		return sqlite.SQLITE_OK, nil
+	// the registry creates helloworld, and the vtab_modules table listing it
+	registry := vtab.NewRegistry()
+	registry.Add(&vtab.ModuleInfo{
+		Name:          "helloworld",
+		Module:        m,
+		Description:   "greets name, times times",
+		EponymousOnly: true,
+		ReadOnly:      true,
 	})
+	sqlite.Register(registry.Register)
 }
 
 func main() {}
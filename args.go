@@ -0,0 +1,32 @@
+package vtab
+
+import "strings"
+
+// ParseArgs parses the key=value arguments of a CREATE VIRTUAL TABLE statement, such as
+// USING vtab_csv(path='data.csv', header=true). Keys are lower-cased, values are unquoted
+// if wrapped in single or double quotes, and any argument without an = is ignored.
+func ParseArgs(args []string) map[string]string {
+	parsed := make(map[string]string, len(args))
+	for _, arg := range args {
+		eq := strings.IndexByte(arg, '=')
+		if eq < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(arg[:eq]))
+		parsed[key] = unquote(strings.TrimSpace(arg[eq+1:]))
+	}
+	return parsed
+}
+
+// unquote removes SQL-style quotes from s, if it's wrapped in them
+func unquote(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+	for _, q := range []string{"'", `"`} {
+		if strings.HasPrefix(s, q) && strings.HasSuffix(s, q) {
+			return strings.ReplaceAll(s[1:len(s)-1], q+q, q)
+		}
+	}
+	return s
+}
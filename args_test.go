@@ -0,0 +1,22 @@
+package vtab
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	args := []string{"vtab_csv", "main", "t", "path='my file.csv'", " Header = true", `delimiter="'"`, "quote='it''s'"}
+
+	got := ParseArgs(args)
+	want := map[string]string{
+		"path":      "my file.csv",
+		"header":    "true",
+		"delimiter": "'",
+		"quote":     "it's",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wanted: %v, got: %v", want, got)
+	}
+}
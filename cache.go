@@ -0,0 +1,352 @@
+package vtab
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Cached tells the table-func to keep the rows of its scans in c, so that scanning its table again with the
+// same constraints (and orders), as a correlated subquery or the inner table of a join do, replays the rows
+// rather than calling its iterator. Only scans that reach the end of the iterator are kept, and only the
+// columns a query uses. Rows whose columns report errors, or values that can't outlive the query (such as
+// with ResultValue or ResultPointer), aren't cached. See NoCache to exclude some scans.
+func Cached(c *Cache) OptFunc {
+	return func(opts *options) { opts.cache = c }
+}
+
+// NoCache marks the scans of the table-func with constraints on any of columns as non-cacheable, such as
+// an argument that asks for live data. With no columns, none of the table-func's scans are cached.
+func NoCache(columns ...string) OptFunc {
+	return func(opts *options) {
+		if len(columns) == 0 {
+			opts.noCache = true
+		}
+		opts.noCacheColumns = append(opts.noCacheColumns, columns...)
+	}
+}
+
+// Cache is an LRU cache of the rows of table-funcs' scans, see Cached. It's safe for concurrent use,
+// and may be shared by any number of table-funcs.
+type Cache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxBytes int64
+	bytes    int64
+	entries  map[string]*list.Element
+	// lru holds the entries, most recently used first
+	lru *list.List
+	// invalidations counts the invalidations of each module's scans, and allInvalidations those of every scan,
+	// so that the rows of scans started before an invalidation aren't kept
+	invalidations    map[string]uint64
+	allInvalidations uint64
+
+	hits, misses int64
+}
+
+type cacheEntry struct {
+	key    string
+	module string
+	// generation is the module's generation when the scan started
+	generation uint64
+	rows       [][]cachedValue
+	bytes      int64
+	expires    time.Time
+}
+
+// NewCache returns a Cache keeping the rows of scans for ttl (or until they're evicted, if ttl is 0), of at most
+// maxBytes (as estimated from the size of their values) in total, evicting the least recently used scans first.
+// A Cache of a maxBytes of 0 keeps nothing, disabling the caching of the table-funcs using it.
+func NewCache(ttl time.Duration, maxBytes int64) *Cache {
+	return &Cache{
+		ttl: ttl, maxBytes: maxBytes, entries: make(map[string]*list.Element), lru: list.New(),
+		invalidations: make(map[string]uint64),
+	}
+}
+
+// Invalidate discards the scans of the tables of a module, including those still running. The tables of a
+// Writable table-func invalidate their scans after each INSERT, UPDATE and DELETE.
+func (c *Cache) Invalidate(module string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidations[module]++
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*cacheEntry).module == module {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// InvalidateAll discards every scan, including those still running
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.allInvalidations++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// Stats returns the number of scans replayed from the cache, and the number of cacheable scans that weren't,
+// along with the estimated size of the rows kept
+func (c *Cache) Stats() (hits, misses, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, c.bytes
+}
+
+// generation returns the generation of the scans of a module, which changes with each invalidation of them
+func (c *Cache) generation(module string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.allInvalidations + c.invalidations[module]
+}
+
+func (c *Cache) get(key string) ([][]cachedValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(e)
+		c.misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	c.hits++
+	return entry.rows, true
+}
+
+func (c *Cache) put(entry *cacheEntry) {
+	if entry.bytes > c.maxBytes {
+		return
+	}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the scan's rows may predate a change to the table
+	if entry.generation != c.allInvalidations+c.invalidations[entry.module] {
+		return
+	}
+	if e, ok := c.entries[entry.key]; ok {
+		c.remove(e)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.bytes += entry.bytes
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.bytes
+}
+
+// cacheKey returns the key of a scan, or false if it isn't cacheable
+func (c *tableFuncCursor) cacheKey(constraints []*Constraint, orders []*sqlite.OrderBy, used ColumnSet) (string, bool) {
+	if c.options.noCache {
+		return "", false
+	}
+
+	type keyConstraint struct {
+		Col   int
+		Op    sqlite.ConstraintOp
+		Type  sqlite.ColumnType
+		Value interface{}
+	}
+	key := struct {
+		// Table tells apart the tables of a NewModule, which share its name but not their columns or iterators
+		Table       string
+		Constraints []keyConstraint
+		Orders      []*sqlite.OrderBy
+		Used        ColumnSet
+	}{Table: fmt.Sprintf("%s %p", c.name, c.tableFuncModule), Orders: orders, Used: used}
+
+	for _, constraint := range constraints {
+		if constraint.ColIndex >= 0 {
+			for _, col := range c.options.noCacheColumns {
+				if c.columns[constraint.ColIndex].Name == col {
+					return "", false
+				}
+			}
+		}
+
+		k := keyConstraint{Col: constraint.ColIndex, Op: constraint.Op, Type: constraint.Value.Type()}
+		switch k.Type {
+		case sqlite.SQLITE_INTEGER:
+			k.Value = constraint.Value.Int64()
+		case sqlite.SQLITE_FLOAT:
+			k.Value = constraint.Value.Float()
+		case sqlite.SQLITE_TEXT:
+			k.Value = constraint.Value.Text()
+		case sqlite.SQLITE_BLOB:
+			k.Value = constraint.Value.Blob()
+		}
+		key.Constraints = append(key.Constraints, k)
+	}
+
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// cachedIterator replays the rows of a cached scan
+type cachedIterator struct {
+	rows    [][]cachedValue
+	current int
+}
+
+func (i *cachedIterator) Next() (Row, error) {
+	if i.current >= len(i.rows) {
+		return nil, io.EOF
+	}
+	i.current++
+	return cachedRow(i.rows[i.current-1]), nil
+}
+
+// cachingIterator records the rows of an iterator, keeping them in the cache once it's exhausted
+type cachingIterator struct {
+	Iterator
+	cache   *Cache
+	entry   *cacheEntry
+	columns []int
+	// abandoned is whether the rows aren't cached, once a row couldn't be recorded or they're too large
+	abandoned bool
+}
+
+func (c *tableFuncCursor) newCachingIterator(iter Iterator, cache *Cache, key string, used ColumnSet) *cachingIterator {
+	var columns []int
+	for col, column := range c.columns {
+		if used.Has(col) && !(c.options.tolerateColumnErrors && column.Name == ErrorsColumn) {
+			columns = append(columns, col)
+		}
+	}
+	return &cachingIterator{
+		Iterator: iter,
+		cache:    cache,
+		entry:    &cacheEntry{key: key, module: c.name, generation: cache.generation(c.name), bytes: int64(len(key))},
+		columns:  columns,
+	}
+}
+
+func (i *cachingIterator) Next() (Row, error) {
+	row, err := i.Iterator.Next()
+	if err != nil {
+		if errors.Is(err, io.EOF) && !i.abandoned {
+			i.cache.put(i.entry)
+			i.abandoned = true
+		}
+		return row, err
+	}
+	if i.abandoned {
+		return row, nil
+	}
+
+	values := make([]cachedValue, len(i.columns))
+	for c, col := range i.columns {
+		v := &cachedValue{col: col}
+		if err := row.Column(v, col); err != nil || v.uncacheable {
+			i.abandoned = true
+			i.entry = nil
+			return row, nil
+		}
+		values[c] = *v
+		i.entry.bytes += v.size()
+	}
+	if i.entry.bytes > i.cache.maxBytes {
+		i.abandoned = true
+		i.entry = nil
+		return row, nil
+	}
+	i.entry.rows = append(i.entry.rows, values)
+	return cachedRow(values), nil
+}
+
+// Close closes the iterator recorded, if it implements io.Closer
+func (i *cachingIterator) Close() error {
+	if closer, ok := i.Iterator.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// cachedValue is the value of a column, as reported to it by a row
+type cachedValue struct {
+	col         int
+	value       interface{}
+	zeroBlob    bool
+	uncacheable bool
+}
+
+func (v *cachedValue) ResultInt(i int)           { v.value = int64(i) }
+func (v *cachedValue) ResultInt64(i int64)       { v.value = i }
+func (v *cachedValue) ResultFloat(f float64)     { v.value = f }
+func (v *cachedValue) ResultNull()               { v.value = nil }
+func (v *cachedValue) ResultValue(sqlite.Value)  { v.uncacheable = true }
+func (v *cachedValue) ResultZeroBlob(n int64)    { v.value, v.zeroBlob = n, true }
+func (v *cachedValue) ResultText(s string)       { v.value = s }
+func (v *cachedValue) ResultBlob(b []byte)       { v.value = append([]byte{}, b...) }
+func (v *cachedValue) ResultError(error)         { v.uncacheable = true }
+func (v *cachedValue) ResultPointer(interface{}) { v.uncacheable = true }
+
+// size estimates the memory held by the value
+func (v *cachedValue) size() int64 {
+	const overhead = 32
+	switch value := v.value.(type) {
+	case string:
+		return overhead + int64(len(value))
+	case []byte:
+		return overhead + int64(len(value))
+	}
+	return overhead
+}
+
+// cachedRow is a row of cached values, of the columns the query uses
+type cachedRow []cachedValue
+
+func (r cachedRow) Column(ctx Context, col int) error {
+	for _, v := range r {
+		if v.col != col {
+			continue
+		}
+		switch value := v.value.(type) {
+		case nil:
+			ctx.ResultNull()
+		case int64:
+			if v.zeroBlob {
+				ctx.ResultZeroBlob(value)
+			} else {
+				ctx.ResultInt64(value)
+			}
+		case float64:
+			ctx.ResultFloat(value)
+		case string:
+			ctx.ResultText(value)
+		case []byte:
+			ResultBlob(ctx, value)
+		}
+		return nil
+	}
+	// the column isn't used by the query
+	ctx.ResultNull()
+	return nil
+}
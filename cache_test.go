@@ -0,0 +1,156 @@
+package vtab_test
+
+import (
+	"fmt"
+	"iter"
+	"testing"
+	"time"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+type number struct {
+	N     int
+	Label string
+	Fresh int
+}
+
+var numberCols = []vtab.Column{
+	{Name: "n", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_LE}}},
+	{Name: "label", Type: "TEXT"},
+	{Name: "fresh", Type: "INTEGER", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+}
+
+// numberScans counts the scans of the numbers iterator, rather than of the cache
+var numberScans int
+
+func numbers(cache *vtab.Cache) sqlite.Module {
+	return vtab.NewTableFunc("cached_numbers", numberCols, vtab.FromSeq(func(_ []*vtab.Constraint, _ []*sqlite.OrderBy) (iter.Seq[number], error) {
+		numberScans++
+		return func(yield func(number) bool) {
+			for n := 1; n <= 10; n++ {
+				if !yield(number{n, fmt.Sprintf("number %d", n), 0}) {
+					return
+				}
+			}
+		}, nil
+	}, vtab.StructColumns[number](numberCols)), vtab.Cached(cache), vtab.NoCache("fresh"))
+}
+
+var numbersCache = vtab.NewCache(0, 1<<20)
+
+var expiringCache = vtab.NewCache(50*time.Millisecond, 1<<20)
+
+// smallCache only has room for a few rows
+var smallCache = vtab.NewCache(0, 1024)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		for name, cache := range map[string]*vtab.Cache{
+			"cached_numbers":   numbersCache,
+			"expiring_numbers": expiringCache,
+			"small_numbers":    smallCache,
+		} {
+			if err := api.CreateModule(name, numbers(cache),
+				sqlite.EponymousOnly(true),
+				sqlite.ReadOnly(true)); err != nil {
+				return sqlite.SQLITE_ERROR, err
+			}
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+// countScans returns the number of scans of the numbers iterator made by query
+func countScans(t *testing.T, db *sqlx.DB, query string, want []string) int {
+	t.Helper()
+	before := numberScans
+	var labels []string
+	if err := db.Select(&labels, query); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want, labels, query)
+	return numberScans - before
+}
+
+func TestCache(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	numbersCache.InvalidateAll()
+	query := "select label from cached_numbers where n <= 2"
+	want := []string{"number 1", "number 2"}
+	assert.Equal(t, 1, countScans(t, db, query, want))
+	assert.Equal(t, 0, countScans(t, db, query, want))
+	assert.Equal(t, 1, countScans(t, db, "select label from cached_numbers where n <= 1", want[:1]))
+
+	// a correlated subquery scans the table once per distinct value
+	assert.Equal(t, 1, countScans(t, db,
+		"select (select label from cached_numbers where n = x) from (select 3 as x union all select 3 union all select 3)",
+		[]string{"number 3", "number 3", "number 3"}))
+
+	numbersCache.Invalidate("cached_numbers")
+	assert.Equal(t, 1, countScans(t, db, query, want))
+
+	// scans with a fresh argument aren't cached
+	fresh := "select label from cached_numbers where n <= 2 and fresh = 0"
+	assert.Equal(t, 1, countScans(t, db, fresh, want))
+	assert.Equal(t, 1, countScans(t, db, fresh, want))
+
+	// scans that end early aren't cached
+	limited := "select label from cached_numbers limit 1"
+	assert.Equal(t, 1, countScans(t, db, limited, want[:1]))
+	assert.Equal(t, 1, countScans(t, db, limited, want[:1]))
+
+	hits, misses, bytes := numbersCache.Stats()
+	assert.Greater(t, hits, int64(0))
+	assert.Greater(t, misses, int64(0))
+	assert.Greater(t, bytes, int64(0))
+}
+
+func TestCacheTTL(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	query := "select label from expiring_numbers where n = 4"
+	want := []string{"number 4"}
+	assert.Equal(t, 1, countScans(t, db, query, want))
+	assert.Equal(t, 0, countScans(t, db, query, want))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, countScans(t, db, query, want))
+}
+
+func TestCacheEviction(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	smallCache.InvalidateAll()
+	one := "select label from small_numbers where n = 1"
+	two := "select label from small_numbers where n = 2"
+	assert.Equal(t, 1, countScans(t, db, one, []string{"number 1"}))
+	assert.Equal(t, 1, countScans(t, db, two, []string{"number 2"}))
+	// the least recently used scan is evicted, to make room for another
+	assert.Equal(t, 0, countScans(t, db, two, []string{"number 2"}))
+	assert.Equal(t, 1, countScans(t, db, one, []string{"number 1"}))
+
+	// the cache stays within its bound
+	var all []string
+	for n := 1; n <= 10; n++ {
+		all = append(all, fmt.Sprintf("number %d", n))
+	}
+	countScans(t, db, "select label from small_numbers", all)
+	_, _, bytes := smallCache.Stats()
+	assert.LessOrEqual(t, bytes, int64(1024))
+}
@@ -0,0 +1,131 @@
+package vtab
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"go.riyazali.net/sqlite"
+)
+
+// TimeoutColumn is the name of the hidden argument added to channel-backed tables, which ends
+// the scan after the channel has been quiet for the given duration (e.g. '500ms' or a number of seconds)
+const TimeoutColumn = "timeout"
+
+// ChanFunc produces the channel of items for a query. ctx is cancelled once the cursor is
+// done with the channel, so that any goroutine sending on it can exit.
+type ChanFunc[T any] func(ctx context.Context, constraints []*Constraint) (<-chan T, error)
+
+// NewChanTable returns a module exposing the items received from ch as rows, until ch is closed.
+// As ch is shared, concurrent queries each receive a portion of the items.
+func NewChanTable[T any](name string, columns []Column, ch <-chan T, column ColumnFunc[T], opts ...OptFunc) sqlite.Module {
+	return NewChanTableFunc(name, columns, func(context.Context, []*Constraint) (<-chan T, error) {
+		return ch, nil
+	}, column, opts...)
+}
+
+// NewChanTableFunc returns a module exposing the items received from a channel, produced by newChan for each query,
+// as rows until the channel is closed or the cursor is closed. A hidden timeout argument is added to columns.
+func NewChanTableFunc[T any](name string, columns []Column, newChan ChanFunc[T], column ColumnFunc[T], opts ...OptFunc) sqlite.Module {
+	timeoutCol := len(columns)
+	columns = append(columns[:len(columns):len(columns)], Column{
+		Name: TimeoutColumn, Type: "TEXT", Hidden: true,
+		Filters: []*ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}},
+	})
+
+	return NewTableFunc(name, columns, func(constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error) {
+		iter := &chanIterator[T]{column: column, timeoutCol: timeoutCol}
+		for _, constraint := range constraints {
+			if constraint.ColIndex == timeoutCol && constraint.Op == sqlite.INDEX_CONSTRAINT_EQ {
+				timeout, err := parseTimeout(constraint.Value.Text())
+				if err != nil {
+					return nil, ColumnError(sqlite.SQLITE_ERROR, TimeoutColumn, err)
+				}
+				iter.timeout, iter.timeoutArg = timeout, constraint.Value.Text()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := newChan(ctx, constraints)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		iter.ch, iter.cancel = ch, cancel
+
+		return iter, nil
+	}, opts...)
+}
+
+// parseTimeout parses a duration such as '1m30s', or a (possibly fractional) number of seconds.
+// A timeout of 0 is none, and negative ones are invalid.
+func parseTimeout(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timeout %q", s)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q, it's negative", s)
+	}
+	return d, nil
+}
+
+type chanIterator[T any] struct {
+	ch         <-chan T
+	cancel     context.CancelFunc
+	column     ColumnFunc[T]
+	timeout    time.Duration
+	timeoutArg string
+	timeoutCol int
+}
+
+func (i *chanIterator[T]) Next() (Row, error) {
+	if i.timeout == 0 {
+		item, ok := <-i.ch
+		if !ok {
+			return nil, io.EOF
+		}
+		return &chanRow[T]{item, i}, nil
+	}
+
+	timer := time.NewTimer(i.timeout)
+	defer timer.Stop()
+
+	select {
+	case item, ok := <-i.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return &chanRow[T]{item, i}, nil
+	case <-timer.C:
+		return nil, io.EOF
+	}
+}
+
+func (i *chanIterator[T]) Close() error {
+	i.cancel()
+	return nil
+}
+
+type chanRow[T any] struct {
+	item T
+	iter *chanIterator[T]
+}
+
+func (r *chanRow[T]) Column(ctx Context, col int) error {
+	if col == r.iter.timeoutCol {
+		if r.iter.timeoutArg == "" {
+			ctx.ResultNull()
+		} else {
+			ctx.ResultText(r.iter.timeoutArg)
+		}
+		return nil
+	}
+	return r.iter.column(ctx, r.item, col)
+}
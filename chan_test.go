@@ -0,0 +1,139 @@
+package vtab_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+type event struct {
+	Seq  int
+	Kind string
+}
+
+var eventCols = []vtab.Column{
+	{Name: "seq", Type: "INTEGER"},
+	{Name: "kind", Type: "TEXT"},
+}
+
+// eventProducers tracks the number of producer goroutines still running
+var eventProducers int64
+
+// eventsModule sends 3 events and then (unlike a finite source) waits to be cancelled
+var eventsModule = vtab.NewChanTableFunc("events", eventCols, func(ctx context.Context, _ []*vtab.Constraint) (<-chan event, error) {
+	ch := make(chan event)
+	atomic.AddInt64(&eventProducers, 1)
+	go func() {
+		defer atomic.AddInt64(&eventProducers, -1)
+		for i := 1; i <= 3; i++ {
+			select {
+			case ch <- event{i, "tick"}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return ch, nil
+}, vtab.StructColumns[event](eventCols))
+
+var finiteEvents = make(chan event, 3)
+
+var finiteEventsModule = vtab.NewChanTable("finite_events", eventCols, finiteEvents, vtab.StructColumns[event](eventCols))
+
+func init() {
+	finiteEvents <- event{1, "start"}
+	finiteEvents <- event{2, "stop"}
+	close(finiteEvents)
+
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("events", eventsModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("finite_events", finiteEventsModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestChanTableClosed(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var kinds []string
+	err = db.Select(&kinds, "select kind from finite_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"start", "stop"}, kinds)
+}
+
+func TestChanTableLimit(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var seqs []int
+	err = db.Select(&seqs, "select seq from events limit 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []int{1, 2}, seqs)
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&eventProducers) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestChanTableTimeout(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var seqs []int
+	err = db.Select(&seqs, "select seq from events('50ms')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []int{1, 2, 3}, seqs)
+}
+
+func TestChanTableInvalidTimeout(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var seqs []int
+	err = db.Select(&seqs, "select seq from events where timeout = 'soon'")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid timeout "soon"`)
+	}
+
+	for _, timeout := range []string{"'-1s'", "-0.5"} {
+		err = db.Select(&seqs, "select seq from events where timeout = "+timeout)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "it's negative")
+		}
+	}
+}
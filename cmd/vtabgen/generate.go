@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"text/template"
+)
+
+// goTypeInfo is how values of a Go type are read from constraints and reported as results
+type goTypeInfo struct {
+	// sql is the SQL type of a column of the Go type
+	sql string
+	// decode is the expression reading a value of the type from constraint.Value
+	decode string
+	// result reports the value of an expression x of the type through ctx
+	result func(x string) string
+}
+
+var goTypes = map[string]goTypeInfo{
+	"bool":    {"INTEGER", "constraint.Value.Int64() != 0", resultBool},
+	"int":     {"INTEGER", "constraint.Value.Int()", func(x string) string { return "ctx.ResultInt(" + x + ")" }},
+	"int8":    intType("int8"),
+	"int16":   intType("int16"),
+	"int32":   intType("int32"),
+	"int64":   {"INTEGER", "constraint.Value.Int64()", func(x string) string { return "ctx.ResultInt64(" + x + ")" }},
+	"uint":    uintType("uint"),
+	"uint8":   intType("uint8"),
+	"uint16":  intType("uint16"),
+	"uint32":  intType("uint32"),
+	"uint64":  uintType("uint64"),
+	"float32": {"REAL", "float32(constraint.Value.Float())", func(x string) string { return "ctx.ResultFloat(float64(" + x + "))" }},
+	"float64": {"REAL", "constraint.Value.Float()", func(x string) string { return "ctx.ResultFloat(" + x + ")" }},
+	"string":  {"TEXT", "constraint.Value.Text()", func(x string) string { return "ctx.ResultText(" + x + ")" }},
+	"[]byte":  {"BLOB", "constraint.Value.Blob()", resultBytes},
+	// time.Time is parsed in decodeArg, and reported as RFC 3339 text, as StructColumns does
+	"time.Time": {"TEXT", "", resultTime},
+}
+
+func intType(typ string) goTypeInfo {
+	return goTypeInfo{"INTEGER", typ + "(constraint.Value.Int64())", func(x string) string { return "ctx.ResultInt64(int64(" + x + "))" }}
+}
+
+// uintType is an unsigned type of 64 bits, whose values above math.MaxInt64 are reported as REAL
+// (as StructColumns does) rather than wrapping around to negative integers
+func uintType(typ string) goTypeInfo {
+	return goTypeInfo{"INTEGER", typ + "(constraint.Value.Int64())", resultUint}
+}
+
+func resultUint(x string) string {
+	return fmt.Sprintf("if uint64(%s) > math.MaxInt64 {\nctx.ResultFloat(float64(%[1]s))\n} else {\nctx.ResultInt64(int64(%[1]s))\n}", x)
+}
+
+func resultBool(x string) string {
+	return fmt.Sprintf("if %s {\nctx.ResultInt(1)\n} else {\nctx.ResultInt(0)\n}", x)
+}
+
+func resultBytes(x string) string {
+	return fmt.Sprintf("if %s == nil {\nctx.ResultNull()\n} else {\nvtab.ResultBlob(ctx, %[1]s)\n}", x)
+}
+
+func resultTime(x string) string {
+	return fmt.Sprintf("if %s.IsZero() {\nctx.ResultNull()\n} else {\nctx.ResultText(%[1]s.Format(time.RFC3339Nano))\n}", x)
+}
+
+// file is a table's generated file, of its columns, arguments, rows and iterator
+type file struct {
+	Source  string
+	Package string
+	Table   *Table
+}
+
+// Lower returns the prefix of the table's unexported names, such as procs for procsCols
+func (f *file) Lower() string { return lowerCamel(f.Table.Name) }
+
+// Upper returns the prefix of the table's exported names, such as Procs for NewProcsModule
+func (f *file) Upper() string { return camel(f.Table.Name) }
+
+// External returns whether the type of the table's items is declared elsewhere, as it was read from a struct
+func (f *file) External() bool { return f.Table.external }
+
+func (f *file) Imports() []string {
+	imports := []string{"fmt", "io"}
+	var unsigned, times bool
+	for _, col := range f.Table.Columns {
+		switch col.Go {
+		case "uint", "uint64":
+			unsigned = true
+		case "time.Time":
+			times = true
+		}
+	}
+	if unsigned {
+		imports = append(imports, "math")
+	}
+	if times {
+		imports = append(imports, "time")
+	}
+	return imports
+}
+
+// Args returns the arguments of the table-func
+func (f *file) Args() []*Column {
+	var args []*Column
+	for _, col := range f.Table.Columns {
+		if col.isArg() {
+			args = append(args, col)
+		}
+	}
+	return args
+}
+
+// Fields returns the columns of the rows' fields, those that aren't arguments
+func (f *file) Fields() []*Column {
+	var fields []*Column
+	for _, col := range f.Table.Columns {
+		if !col.isArg() {
+			fields = append(fields, col)
+		}
+	}
+	return fields
+}
+
+// Options returns the options of the module
+func (f *file) Options() []string {
+	var opts []string
+	if f.Table.EarlyExit {
+		opts = append(opts, "vtab.EarlyOrderByConstraintExit(true)")
+	}
+	if f.Table.Limit {
+		opts = append(opts, "vtab.PushDownLimit(true)")
+	}
+	if f.Table.Description != "" || len(f.Table.Examples) > 0 {
+		args := []string{fmt.Sprintf("%q", f.Table.Description)}
+		for _, example := range f.Table.Examples {
+			args = append(args, fmt.Sprintf("%q", example))
+		}
+		opts = append(opts, "vtab.Describe("+strings.Join(args, ", ")+")")
+	}
+	return opts
+}
+
+// Column returns the vtab.Column literal of col
+func (f *file) Column(col *Column) string {
+	fields := []string{fmt.Sprintf("Name: %q", col.Name), fmt.Sprintf("Type: %q", col.Type)}
+	if col.NotNull {
+		fields = append(fields, "NotNull: true")
+	}
+	if col.Hidden {
+		fields = append(fields, "Hidden: true")
+	}
+	filters, _ := col.filters()
+	if len(filters) > 0 {
+		var lits []string
+		for _, filter := range filters {
+			lit := "{Op: sqlite.INDEX_CONSTRAINT_" + filter.Op
+			if filter.Omit {
+				lit += ", OmitCheck: true"
+			}
+			lits = append(lits, lit+"}")
+		}
+		fields = append(fields, "Filters: []*vtab.ColumnFilter{"+strings.Join(lits, ", ")+"}")
+	}
+	switch asc, desc := col.ordered(false), col.ordered(true); {
+	case asc && desc:
+		fields = append(fields, "OrderBy: vtab.ASC | vtab.DESC")
+	case asc:
+		fields = append(fields, "OrderBy: vtab.ASC")
+	case desc:
+		fields = append(fields, "OrderBy: vtab.DESC")
+	}
+	if col.Description != "" {
+		fields = append(fields, fmt.Sprintf("Description: %q", col.Description))
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// DecodeArg returns the statements setting the argument of col, from constraint
+func (f *file) DecodeArg(col *Column) string {
+	if col.Go == "time.Time" {
+		return fmt.Sprintf("v, err := time.Parse(time.RFC3339Nano, constraint.Value.Text())\n"+
+			"if err != nil {\nreturn nil, fmt.Errorf(\"%s: %%w\", err)\n}\nargs.%s = &v", col.Name, col.Field)
+	}
+	return fmt.Sprintf("v := %s\nargs.%s = &v", goTypes[col.Go].decode, col.Field)
+}
+
+// Result returns the statements reporting the value of col
+func (f *file) Result(col *Column) string {
+	if col.isArg() {
+		arg := "*r.args." + col.Field
+		if col.Go == "time.Time" {
+			// the methods of time.Time are called through the pointer
+			arg = "r.args." + col.Field
+		}
+		result := goTypes[col.Go].result(arg)
+		if !strings.HasPrefix(result, "if ") {
+			result = "{\n" + result + "\n}"
+		}
+		return fmt.Sprintf("if r.args.%s == nil {\nctx.ResultNull()\n} else %s", col.Field, result)
+	}
+	return goTypes[col.Go].result("r.item." + col.Field)
+}
+
+// Todo returns the comment of the iterator's skeleton, telling what's left to do
+func (f *file) Todo() string {
+	lines := []string{"TODO: list the rows of " + f.Table.Name + "."}
+	if args := f.Args(); len(args) > 0 {
+		var names []string
+		for _, arg := range args {
+			names = append(names, "args."+arg.Field)
+		}
+		lines = append(lines, "The arguments of the query are "+strings.Join(names, ", ")+", each nil if it isn't given.")
+	}
+
+	var constraints []string
+	for _, col := range f.Fields() {
+		filters, _ := col.filters()
+		if len(filters) == 0 {
+			continue
+		}
+		var names []string
+		for _, filter := range filters {
+			names = append(names, strings.ToLower(filter.Op))
+		}
+		constraints = append(constraints, fmt.Sprintf("%s (%s)", col.Name, strings.Join(names, ", ")))
+	}
+	if len(constraints) > 0 {
+		lines = append(lines, "args.Constraints are the constraints on "+strings.Join(constraints, ", ")+
+			", which SQLite checks too, unless they omit the check.")
+	}
+
+	var orders []string
+	for _, col := range f.Table.Columns {
+		switch asc, desc := col.ordered(false), col.ordered(true); {
+		case asc && desc:
+			orders = append(orders, col.Name)
+		case asc:
+			orders = append(orders, col.Name+" ASC")
+		case desc:
+			orders = append(orders, col.Name+" DESC")
+		}
+	}
+	if len(orders) > 0 {
+		lines = append(lines, "When order is an ORDER BY on "+strings.Join(orders, " or ")+", the rows must be in that order.")
+	}
+	if f.Table.Limit {
+		lines = append(lines, "args.Limit is the LIMIT of the query, if it's not 0, but more rows may be listed.")
+	}
+	return "// " + strings.Join(lines, "\n\t// ")
+}
+
+var funcs = template.FuncMap{"quote": func(s string) string { return fmt.Sprintf("%q", s) }}
+
+var vtabTemplate = template.Must(template.New("vtab").Funcs(funcs).Parse(`// Code generated by vtabgen from {{.Source}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{quote .}}
+{{- end}}
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+var {{.Lower}}Cols = []vtab.Column{
+{{- range .Table.Columns}}
+	{{$.Column .}},
+{{- end}}
+}
+{{if not .External}}
+// {{.Table.Row}} is an item listed by {{.Lower}}Iterator, a row of the {{.Table.Name}} table
+type {{.Table.Row}} struct {
+{{- range .Fields}}
+	{{.Field}} {{.Go}}
+{{- end}}
+}
+{{end}}
+// {{.Upper}}Args are the arguments of a scan of the {{.Table.Name}} table, decoded from its constraints
+type {{.Upper}}Args struct {
+{{- range .Args}}
+	{{.Field}} *{{.Go}}
+{{- end}}
+{{- if .Table.Limit}}
+	// Limit is the LIMIT of the query, or 0 if it has none
+	Limit int64
+{{- end}}
+	// Constraints are the other constraints of the scan
+	Constraints []*vtab.Constraint
+}
+
+// decode{{.Upper}}Args decodes the arguments of a scan of the {{.Table.Name}} table
+func decode{{.Upper}}Args(constraints []*vtab.Constraint) (*{{.Upper}}Args, error) {
+	args := &{{.Upper}}Args{}
+	for _, constraint := range constraints {
+{{- if .Table.Limit}}
+		if constraint.Op == vtab.INDEX_CONSTRAINT_LIMIT {
+			args.Limit = constraint.Value.Int64()
+			continue
+		}
+{{- end}}
+{{- if .Args}}
+		if constraint.ColIndex >= 0 && constraint.Op == sqlite.INDEX_CONSTRAINT_EQ {
+			switch {{.Lower}}Cols[constraint.ColIndex].Name {
+{{- range .Args}}
+			case {{quote .Name}}:
+				{{$.DecodeArg .}}
+				continue
+{{- end}}
+			}
+		}
+{{- end}}
+		args.Constraints = append(args.Constraints, constraint)
+	}
+	return args, nil
+}
+
+// {{.Lower}}Row is a row of a scan of the {{.Table.Name}} table
+type {{.Lower}}Row struct {
+	item *{{.Table.Row}}
+	args *{{.Upper}}Args
+}
+
+func (r *{{.Lower}}Row) Column(ctx vtab.Context, c int) error {
+	switch {{.Lower}}Cols[c].Name {
+{{- range .Table.Columns}}
+	case {{quote .Name}}:
+		{{$.Result .}}
+{{- end}}
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// {{.Lower}}Iter produces the rows of a scan of the {{.Table.Name}} table, of the items listed by {{.Lower}}Iterator
+type {{.Lower}}Iter struct {
+	args  *{{.Upper}}Args
+	items []*{{.Table.Row}}
+}
+
+func new{{.Upper}}Iter(args *{{.Upper}}Args, items []*{{.Table.Row}}) *{{.Lower}}Iter {
+	return &{{.Lower}}Iter{args: args, items: items}
+}
+
+func (i *{{.Lower}}Iter) Next() (vtab.Row, error) {
+	if len(i.items) == 0 {
+		return nil, io.EOF
+	}
+	item := i.items[0]
+	i.items = i.items[1:]
+	return &{{.Lower}}Row{item: item, args: i.args}, nil
+}
+
+// New{{.Upper}}Module returns the {{.Table.Name}} table-func, whose rows are listed by {{.Lower}}Iterator
+func New{{.Upper}}Module(opts ...vtab.OptFunc) sqlite.Module {
+{{- if .Options}}
+	opts = append([]vtab.OptFunc{ {{- range $o, $opt := .Options}}{{if $o}}, {{end}}{{$opt}}{{end -}} }, opts...)
+{{- end}}
+	return vtab.NewTableFunc({{quote .Table.Name}}, {{.Lower}}Cols, {{.Lower}}Iterator, opts...)
+}
+`))
+
+var iteratorTemplate = template.Must(template.New("iterator").Funcs(funcs).Parse(`// Code generated by vtabgen from {{.Source}}, to be completed.
+
+package {{.Package}}
+
+import (
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// {{.Lower}}Iterator is the GetIteratorFunc of the {{.Table.Name}} table
+func {{.Lower}}Iterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	args, err := decode{{.Upper}}Args(constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	{{.Todo}}
+	var items []*{{.Table.Row}}
+
+	return new{{.Upper}}Iter(args, items), nil
+}
+`))
+
+var testTemplate = template.Must(template.New("test").Funcs(funcs).Parse(`// Code generated by vtabgen from {{.Source}}, to be completed.
+
+package {{.Package}}
+
+import (
+	"testing"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule({{quote .Table.Name}}, New{{.Upper}}Module(),
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func Test{{.Upper}}(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// TODO: check the rows of {{.Table.Name}}
+	var count int
+	if err := db.Get(&count, "SELECT count(*) FROM {{.Table.Name}}"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+}
+`))
+
+// generate renders tmpl for a table, formatted as Go source
+func generate(tmpl *template.Template, source, pkg string, table *Table) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &file{Source: source, Package: pkg, Table: table}); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: formatting generated code: %v", table.Name, err)
+	}
+	return src, nil
+}
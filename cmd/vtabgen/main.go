@@ -0,0 +1,122 @@
+// Command vtabgen generates the code of table-funcs from a description of their tables, a YAML or JSON schema
+// or an annotated Go struct:
+//
+//	vtabgen [-out dir] [-package name] [-force] schema.yaml
+//	vtabgen -type Proc [-table procs] [-force] proc.go
+//
+// For each table, such as procs, it writes to dir (by default the current directory, or the directory of the
+// Go file):
+//
+//	procs_vtab.go       the []vtab.Column of the table, the type of its rows (from a schema), ProcsArgs (the
+//	                    arguments of a scan, decoded from its constraints), the Row.Column switch, an iterator
+//	                    and NewProcsModule. It's overwritten each time.
+//	procs_iter.go       a skeleton of procsIterator, the GetIteratorFunc of the table, listing the rows
+//	procs_vtab_test.go  a test of the table, registering it as an eponymous-only module
+//
+// The skeleton and the test are only written if they don't exist, or with -force. A schema lists tables:
+//
+//	package: procs
+//	tables:
+//	  - name: procs
+//	    description: The processes of a host
+//	    examples: ["SELECT name FROM procs('db1') WHERE pid > 1000"]
+//	    early_exit: true
+//	    columns:
+//	      - {name: pid, type: INTEGER, filters: [eq, gt, ge, lt, le], order: [asc, desc]}
+//	      - {name: name, type: TEXT, filters: [like]}
+//	      - {name: host, type: TEXT, hidden: true, filters: ["eq:omit"], description: the host to list}
+//
+// Hidden columns with an eq filter are the arguments of the table-func, as in procs('localhost').
+// See Table and Column for the other fields, and loadStruct for the tags of a struct's fields.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+func main() {
+	out := flag.String("out", "", "the directory to write to (the current directory, or that of the Go file)")
+	pkg := flag.String("package", "", "the package of the generated code, if the schema doesn't declare it (the name of -out)")
+	typ := flag.String("type", "", "the struct type describing the table, in the Go file")
+	table := flag.String("table", "", "the name of the table of -type (the type in snake_case)")
+	force := flag.Bool("force", false, "overwrite the iterator skeleton and test")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: vtabgen [flags] schema.yaml|schema.json\n       vtabgen [flags] -type T file.go\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *out, *pkg, *typ, *table, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "vtabgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(path, out, pkg, typ, table string, force bool) error {
+	var schema *Schema
+	var err error
+	if typ != "" {
+		schema, err = loadStruct(path, typ, table)
+		if out == "" {
+			out = filepath.Dir(path)
+		}
+	} else {
+		schema, err = loadSchema(path)
+		if out == "" {
+			out = "."
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if schema.Package == "" {
+		schema.Package = pkg
+	}
+	if schema.Package == "" {
+		abs, err := filepath.Abs(out)
+		if err != nil {
+			return err
+		}
+		schema.Package = filepath.Base(abs)
+	}
+	if err := schema.normalize(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	source := filepath.Base(path)
+	for _, t := range schema.Tables {
+		files := []struct {
+			suffix    string
+			tmpl      *template.Template
+			overwrite bool
+		}{
+			{"_vtab.go", vtabTemplate, true},
+			{"_iter.go", iteratorTemplate, force},
+			{"_vtab_test.go", testTemplate, force},
+		}
+		for _, f := range files {
+			name := filepath.Join(out, t.Name+f.suffix)
+			if _, err := os.Stat(name); err == nil && !f.overwrite {
+				continue
+			}
+			src, err := generate(f.tmpl, source, schema.Package, t)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(name, src, 0o644); err != nil {
+				return err
+			}
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema describes the tables to generate, in a package
+type Schema struct {
+	Package string   `yaml:"package" json:"package"`
+	Tables  []*Table `yaml:"tables" json:"tables"`
+}
+
+// Table describes a table-func
+type Table struct {
+	// Name is the name of the module, as used in SQL
+	Name string `yaml:"name" json:"name"`
+	// Row is the Go type of the items listed by the iterator, generated with a field per column
+	// (other than hidden ones) unless the table was read from a struct. It defaults to <Name>Row.
+	Row string `yaml:"row" json:"row"`
+	// Description and Examples (queries of the table) are passed to the Describe option, for vtab_help
+	Description string   `yaml:"description" json:"description"`
+	Examples    []string `yaml:"examples" json:"examples"`
+	// EarlyExit and Limit add the EarlyOrderByConstraintExit and PushDownLimit options
+	EarlyExit bool      `yaml:"early_exit" json:"early_exit"`
+	Limit     bool      `yaml:"limit" json:"limit"`
+	Columns   []*Column `yaml:"columns" json:"columns"`
+
+	// external is whether Row is declared elsewhere, as it was read from a struct
+	external bool
+}
+
+// Column describes a column of a table. Hidden columns with an = filter are the arguments of the table-func.
+type Column struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is the SQL type of the column, derived from Go if it's empty
+	Type string `yaml:"type" json:"type"`
+	// Go is the Go type of the column, derived from Type if it's empty. See goTypes for those supported.
+	Go string `yaml:"go" json:"go"`
+	// Field is the name of the column's field, of the row or the arguments, CamelCase of Name by default
+	Field   string `yaml:"field" json:"field"`
+	Hidden  bool   `yaml:"hidden" json:"hidden"`
+	NotNull bool   `yaml:"not_null" json:"not_null"`
+	// Filters are the operators of the constraints handled, such as eq or >=, suffixed with :omit if
+	// SQLite needn't check them, such as eq:omit
+	Filters []string `yaml:"filters" json:"filters"`
+	// Order is the orders the iterator can produce the rows in, asc and/or desc
+	Order       []string `yaml:"order" json:"order"`
+	Description string   `yaml:"description" json:"description"`
+}
+
+// filter is a parsed Column.Filters entry
+type filter struct {
+	Op   string // the name of the sqlite.INDEX_CONSTRAINT_ constant
+	Omit bool
+}
+
+// ops are the names of the operators of filters, and the SQLite constants they stand for
+var ops = map[string]string{
+	"eq": "EQ", "=": "EQ", "==": "EQ",
+	"gt": "GT", ">": "GT",
+	"ge": "GE", ">=": "GE",
+	"lt": "LT", "<": "LT",
+	"le": "LE", "<=": "LE",
+	"ne": "NE", "!=": "NE", "<>": "NE",
+	"match": "MATCH", "like": "LIKE", "glob": "GLOB", "regexp": "REGEXP",
+	"is": "IS", "isnot": "ISNOT", "isnull": "ISNULL", "isnotnull": "ISNOTNULL",
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// loadSchema reads a YAML or JSON schema (by the extension of path)
+func loadSchema(path string) (*Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema Schema
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(strings.NewReader(string(b)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&schema)
+	} else {
+		dec := yaml.NewDecoder(strings.NewReader(string(b)))
+		dec.KnownFields(true)
+		err = dec.Decode(&schema)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &schema, nil
+}
+
+// normalize checks the schema, filling in the defaults
+func (s *Schema) normalize() error {
+	if !namePattern.MatchString(s.Package) {
+		return fmt.Errorf("invalid package name %q", s.Package)
+	}
+	if len(s.Tables) == 0 {
+		return fmt.Errorf("no tables")
+	}
+	names := make(map[string]bool)
+	for _, table := range s.Tables {
+		if err := table.normalize(); err != nil {
+			return fmt.Errorf("table %s: %w", table.Name, err)
+		}
+		if names[strings.ToLower(table.Name)] {
+			return fmt.Errorf("table %s: declared twice", table.Name)
+		}
+		names[strings.ToLower(table.Name)] = true
+	}
+	return nil
+}
+
+func (t *Table) normalize() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid name")
+	}
+	if t.Row == "" {
+		t.Row = camel(t.Name) + "Row"
+	}
+	if len(t.Columns) == 0 {
+		return fmt.Errorf("no columns")
+	}
+
+	names := make(map[string]bool)
+	fields := make(map[string]bool)
+	for _, col := range t.Columns {
+		if err := col.normalize(); err != nil {
+			return fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		if names[strings.ToLower(col.Name)] {
+			return fmt.Errorf("column %s: declared twice", col.Name)
+		}
+		names[strings.ToLower(col.Name)] = true
+		if fields[col.Field] {
+			return fmt.Errorf("column %s: field %s declared twice", col.Name, col.Field)
+		}
+		fields[col.Field] = true
+	}
+	return nil
+}
+
+func (c *Column) normalize() error {
+	if !namePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid name")
+	}
+	if c.Field == "" {
+		c.Field = camel(c.Name)
+	}
+	if c.Go == "" {
+		c.Go = goType(c.Type)
+	}
+	if _, ok := goTypes[c.Go]; !ok {
+		return fmt.Errorf("unsupported Go type %s", c.Go)
+	}
+	if c.Type == "" {
+		c.Type = goTypes[c.Go].sql
+	}
+	if _, err := c.filters(); err != nil {
+		return err
+	}
+	for _, order := range c.Order {
+		if o := strings.ToLower(order); o != "asc" && o != "desc" {
+			return fmt.Errorf("invalid order %q, want asc or desc", order)
+		}
+	}
+	return nil
+}
+
+// filters parses the column's Filters
+func (c *Column) filters() ([]filter, error) {
+	var filters []filter
+	for _, f := range c.Filters {
+		op, omit := strings.ToLower(strings.TrimSpace(f)), false
+		if strings.HasSuffix(op, ":omit") {
+			op, omit = strings.TrimSuffix(op, ":omit"), true
+		}
+		name, ok := ops[op]
+		if !ok {
+			return nil, fmt.Errorf("invalid filter %q", f)
+		}
+		filters = append(filters, filter{Op: name, Omit: omit})
+	}
+	return filters, nil
+}
+
+// isArg returns whether the column is an argument of the table-func, a hidden column with an = filter
+func (c *Column) isArg() bool {
+	if !c.Hidden {
+		return false
+	}
+	filters, _ := c.filters()
+	for _, f := range filters {
+		if f.Op == "EQ" {
+			return true
+		}
+	}
+	return false
+}
+
+// ordered returns whether the column can be ordered asc or desc
+func (c *Column) ordered(desc bool) bool {
+	for _, order := range c.Order {
+		if strings.EqualFold(order, "desc") == desc {
+			return true
+		}
+	}
+	return false
+}
+
+// goType returns the Go type of a column of SQL type typ, as by SQLite's rules for column affinity
+func goType(typ string) string {
+	typ = strings.ToUpper(typ)
+	switch {
+	case strings.Contains(typ, "BOOL"):
+		return "bool"
+	case strings.Contains(typ, "INT"):
+		return "int64"
+	case strings.Contains(typ, "CHAR"), strings.Contains(typ, "CLOB"), strings.Contains(typ, "TEXT"):
+		return "string"
+	case strings.Contains(typ, "BLOB"):
+		return "[]byte"
+	case strings.Contains(typ, "REAL"), strings.Contains(typ, "FLOA"), strings.Contains(typ, "DOUB"):
+		return "float64"
+	case strings.Contains(typ, "DATE"), strings.Contains(typ, "TIME"):
+		return "time.Time"
+	default:
+		return "string"
+	}
+}
+
+// initialisms are the words written in upper case in Go names
+var initialisms = map[string]bool{
+	"api": true, "cpu": true, "gid": true, "http": true, "id": true, "ip": true, "json": true, "pid": true,
+	"sql": true, "tcp": true, "udp": true, "uid": true, "uri": true, "url": true,
+}
+
+// camel returns the CamelCase Go name of a snake_case SQL name, such as ParentPID for parent_pid
+func camel(name string) string {
+	var sb strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if word == "" {
+			continue
+		}
+		if initialisms[strings.ToLower(word)] {
+			sb.WriteString(strings.ToUpper(word))
+		} else {
+			sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	if sb.Len() == 0 {
+		return "X"
+	}
+	return sb.String()
+}
+
+// lowerCamel returns the camelCase Go name of a snake_case SQL name, such as parentPID for parent_pid
+func lowerCamel(name string) string {
+	words := strings.SplitN(strings.TrimLeft(name, "_"), "_", 2)
+	first := strings.ToLower(words[0])
+	if first == "" {
+		first = "x"
+	}
+	if len(words) == 1 {
+		return first
+	}
+	return first + camel(words[1])
+}
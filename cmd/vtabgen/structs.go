@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// loadStruct reads the table of the struct typ, declared in the Go file path. Each exported field is a column,
+// named by the first element of its vtab tag (as with vtab.StructColumns), or the field's name in lower case.
+// The other elements of the tag declare the column:
+//
+//	hidden           the column is hidden, an argument of the table-func if it has an eq filter
+//	notnull          the column is NOT NULL
+//	type=TEXT        the SQL type of the column, derived from the field's type by default
+//	filter=eq|gt     the filters of the column, as in a schema, such as eq:omit
+//	order=asc|desc   the orders the rows can be produced in
+//
+// Fields tagged vtab:"-" are skipped. The doc comments of the type and its fields describe the table and its
+// columns. The table is named name, or typ in snake_case if it's empty.
+func loadStruct(path, typ, name string) (*Schema, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec *ast.StructType
+	var doc *ast.CommentGroup
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gen.Specs {
+			if ts := s.(*ast.TypeSpec); ts.Name.Name == typ {
+				spec, _ = ts.Type.(*ast.StructType)
+				// the doc of a lone type is that of its declaration
+				if doc = ts.Doc; doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+			}
+		}
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("%s: no struct type %s", path, typ)
+	}
+
+	if name == "" {
+		name = snake(typ)
+	}
+	table := &Table{Name: name, Row: typ, Description: docText(doc), external: true}
+	for _, field := range spec.Fields.List {
+		var tag string
+		if field.Tag != nil {
+			unquoted, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", fset.Position(field.Tag.Pos()), err)
+			}
+			tag = reflect.StructTag(unquoted).Get("vtab")
+		}
+		if tag == "-" {
+			continue
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			col, err := structColumn(ident.Name, typeString(field.Type), tag)
+			if err != nil {
+				return nil, fmt.Errorf("%s: field %s: %w", fset.Position(ident.Pos()), ident.Name, err)
+			}
+			col.Description = docText(field.Doc)
+			table.Columns = append(table.Columns, col)
+		}
+	}
+	return &Schema{Package: f.Name.Name, Tables: []*Table{table}}, nil
+}
+
+// structColumn returns the column of a field, declared by its vtab tag
+func structColumn(field, goType, tag string) (*Column, error) {
+	opts := strings.Split(tag, ",")
+	col := &Column{Name: opts[0], Field: field, Go: goType}
+	if col.Name == "" {
+		col.Name = strings.ToLower(field)
+	}
+	for _, opt := range opts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch key {
+		case "hidden":
+			col.Hidden = true
+		case "notnull":
+			col.NotNull = true
+		case "type":
+			col.Type = value
+		case "filter":
+			col.Filters = strings.Split(value, "|")
+		case "order":
+			col.Order = strings.Split(value, "|")
+		default:
+			return nil, fmt.Errorf("unknown vtab tag option %q", opt)
+		}
+	}
+	return col, nil
+}
+
+// docText returns a doc comment as a single line, or "" if there's none
+func docText(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+// typeString returns the Go source of a field's type, such as []byte
+func typeString(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name
+	case *ast.SelectorExpr:
+		return typeString(expr.X) + "." + expr.Sel.Name
+	case *ast.ArrayType:
+		if expr.Len == nil {
+			return "[]" + typeString(expr.Elt)
+		}
+	case *ast.StarExpr:
+		return "*" + typeString(expr.X)
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+// snake returns the snake_case of a Go name, such as net_conn for NetConn or tcp_conn for TCPConn
+func snake(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for r, c := range runes {
+		if unicode.IsUpper(c) && r > 0 {
+			// a word starts at an upper case letter after a lower case one, or before one (as in TCPConn)
+			if unicode.IsLower(runes[r-1]) || (r+1 < len(runes) && unicode.IsLower(runes[r+1]) && unicode.IsUpper(runes[r-1])) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToLower(c))
+	}
+	return sb.String()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const procsSchema = `
+package: procs
+tables:
+  - name: procs
+    description: The processes of a host
+    examples: ["SELECT * FROM procs('db1')"]
+    early_exit: true
+    columns:
+      - {name: pid, type: INTEGER, filters: [eq, gt, "<="], order: [asc, desc]}
+      - {name: parent_pid, type: INTEGER}
+      - {name: started, type: DATETIME}
+      - {name: cmdline, type: BLOB}
+      - {name: memory, type: INTEGER, go: uint64}
+      - {name: host, type: TEXT, hidden: true, filters: ["eq:omit"], description: the host to list}
+`
+
+func write(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func read(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestGenerateSchema(t *testing.T) {
+	dir := t.TempDir()
+	schema := write(t, dir, "procs.yaml", procsSchema)
+	if err := run(schema, dir, "", "", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	vtab := read(t, filepath.Join(dir, "procs_vtab.go"))
+	for _, want := range []string{
+		"// Code generated by vtabgen from procs.yaml; DO NOT EDIT.",
+		`{Name: "pid", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_GT}, {Op: sqlite.INDEX_CONSTRAINT_LE}}, OrderBy: vtab.ASC | vtab.DESC},`,
+		`{Name: "host", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}, Description: "the host to list"},`,
+		"\tParentPID int64\n",
+		"\tStarted   time.Time\n",
+		"\tHost *string\n",
+		"args.Host = &v",
+		"ctx.ResultInt64(r.item.ParentPID)",
+		"vtab.ResultBlob(ctx, r.item.Cmdline)",
+		"if uint64(r.item.Memory) > math.MaxInt64 {",
+		"ctx.ResultFloat(float64(r.item.Memory))",
+		"ctx.ResultInt64(int64(r.item.Memory))",
+		"\t\"math\"\n",
+		"ctx.ResultText(*r.args.Host)",
+		`vtab.EarlyOrderByConstraintExit(true), vtab.Describe("The processes of a host", "SELECT * FROM procs('db1')")`,
+		"func NewProcsModule(opts ...vtab.OptFunc) sqlite.Module {",
+	} {
+		assert.Contains(t, vtab, want)
+	}
+
+	iter := read(t, filepath.Join(dir, "procs_iter.go"))
+	assert.Contains(t, iter, "func procsIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {")
+	assert.Contains(t, iter, "args, err := decodeProcsArgs(constraints)")
+	assert.Contains(t, iter, "args.Constraints are the constraints on pid (eq, gt, le)")
+
+	test := read(t, filepath.Join(dir, "procs_vtab_test.go"))
+	assert.Contains(t, test, `api.CreateModule("procs", NewProcsModule(),`)
+
+	// the skeleton is kept once it's written, unless forced
+	write(t, dir, "procs_iter.go", "package procs\n")
+	if err := run(schema, dir, "", "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "package procs\n", read(t, filepath.Join(dir, "procs_iter.go")))
+	if err := run(schema, dir, "", "", "", true); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, read(t, filepath.Join(dir, "procs_iter.go")), "func procsIterator(")
+}
+
+// TestGenerateCompiles builds and vets the code generated from the schema, in a package of this module (under
+// testdata, which ./... doesn't match) so that it imports this version of vtab
+func TestGenerateCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a package")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool isn't installed")
+	}
+
+	if err := os.MkdirAll("testdata", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("testdata", "procs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+		os.Remove("testdata") // unless it holds something else
+	})
+
+	schema := write(t, t.TempDir(), "procs.yaml", procsSchema)
+	if err := run(schema, dir, "", "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range [][]string{{"build"}, {"vet"}} {
+		out, err := exec.Command(goTool, append(cmd, "./"+filepath.ToSlash(dir))...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("go %s: %v\n%s", cmd[0], err, out)
+		}
+	}
+}
+
+func TestGenerateStruct(t *testing.T) {
+	dir := t.TempDir()
+	src := write(t, dir, "conn.go", "package netstat\n\n"+
+		"// TCPConn is a TCP connection\n"+
+		"type TCPConn struct {\n"+
+		"\t// Port is the local port\n"+
+		"\tPort    uint16  `vtab:\"port,filter=eq|gt,order=asc\"`\n"+
+		"\tState   string\n"+
+		"\tRate    float32 `vtab:\"rate,notnull\"`\n"+
+		"\tIgnored int     `vtab:\"-\"`\n"+
+		"\tprivate int\n"+
+		"\tHost    string  `vtab:\"host,hidden,filter=eq\"`\n"+
+		"}\n")
+	if err := run(src, "", "", "TCPConn", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	vtab := read(t, filepath.Join(dir, "tcp_conn_vtab.go"))
+	for _, want := range []string{
+		"// Code generated by vtabgen from conn.go; DO NOT EDIT.",
+		"package netstat",
+		`{Name: "port", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_GT}}, OrderBy: vtab.ASC, Description: "Port is the local port"},`,
+		`opts = append([]vtab.OptFunc{vtab.Describe("TCPConn is a TCP connection")}, opts...)`,
+		`{Name: "state", Type: "TEXT"},`,
+		`{Name: "rate", Type: "REAL", NotNull: true},`,
+		"item *TCPConn",
+		"ctx.ResultInt64(int64(r.item.Port))",
+		"ctx.ResultFloat(float64(r.item.Rate))",
+		"ctx.ResultText(*r.args.Host)",
+		`return vtab.NewTableFunc("tcp_conn", tcpConnCols, tcpConnIterator, opts...)`,
+	} {
+		assert.Contains(t, vtab, want)
+	}
+	// the struct is declared by the package, not generated
+	assert.NotContains(t, vtab, "type TCPConn struct")
+	assert.NotContains(t, vtab, "Ignored")
+}
+
+func TestSchemaErrors(t *testing.T) {
+	for _, tt := range []struct {
+		schema, err string
+	}{
+		{"package: p\ntables: []\n", "no tables"},
+		{"package: p\ntables:\n  - name: t\n", "table t: no columns"},
+		{"package: p\ntables:\n  - name: t\n    columns: [{name: a, filters: [between]}]\n", `column a: invalid filter "between"`},
+		{"package: p\ntables:\n  - name: t\n    columns: [{name: a, order: [up]}]\n", `column a: invalid order "up"`},
+		{"package: p\ntables:\n  - name: t\n    columns: [{name: a, go: complex64}]\n", "column a: unsupported Go type complex64"},
+		{"package: p\ntables:\n  - name: t\n    columns: [{name: a}, {name: A}]\n", "column A: declared twice"},
+		{"package: p\ntables:\n  - name: t-1\n    columns: [{name: a}]\n", "table t-1: invalid name"},
+		{"package: p\ntables:\n  - name: t\n    colums: [{name: a}]\n", "field colums not found"},
+	} {
+		dir := t.TempDir()
+		err := run(write(t, dir, "schema.yaml", tt.schema), dir, "", "", "", false)
+		if assert.Error(t, err, tt.schema) {
+			assert.Contains(t, err.Error(), tt.err)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	for _, tt := range []struct{ sql, camel, lower string }{
+		{"procs", "Procs", "procs"},
+		{"parent_pid", "ParentPID", "parentPID"},
+		{"net_tcp", "NetTCP", "netTCP"},
+		{"local_address_2", "LocalAddress2", "localAddress2"},
+	} {
+		assert.Equal(t, tt.camel, camel(tt.sql))
+		assert.Equal(t, tt.lower, lowerCamel(tt.sql))
+	}
+
+	for _, tt := range []struct{ goName, snake string }{
+		{"Proc", "proc"},
+		{"TCPConn", "tcp_conn"},
+		{"NetConnStats", "net_conn_stats"},
+	} {
+		assert.Equal(t, tt.snake, snake(tt.goName))
+	}
+
+	assert.Equal(t, "string", goType("VARCHAR(32)"))
+	assert.Equal(t, "int64", goType("BIGINT"))
+	assert.Equal(t, "float64", goType("DOUBLE PRECISION"))
+}
@@ -0,0 +1,59 @@
+package vtab
+
+import (
+	"encoding/json"
+
+	"go.riyazali.net/sqlite"
+)
+
+// ErrorsColumn is the name of the hidden column added to tables created with TolerateColumnErrors
+const ErrorsColumn = "_errors"
+
+// rowError is a single Row.Column error, as reported in the _errors column
+type rowError struct {
+	Column string `json:"column"`
+	Error  string `json:"error"`
+}
+
+// tolerantColumn reports the value of col for the current row, substituting a NULL if Row.Column fails
+func (c *tableFuncCursor) tolerantColumn(ctx *sqlite.VirtualTableContext, col int) error {
+	if col == len(c.columns)-1 {
+		return c.errorsColumn(ctx)
+	}
+
+	if err := c.current.Column(ctx, col); err != nil {
+		ctx.ResultNull()
+	}
+	return nil
+}
+
+// errorsColumn reports the errors of the current row as a JSON array, or NULL if there were none
+func (c *tableFuncCursor) errorsColumn(ctx *sqlite.VirtualTableContext) error {
+	// columns may be requested in any order (or not at all) so the columns used by the query are probed
+	// for errors, the first time the _errors column is requested for a row. The others aren't read, as
+	// they may be expensive.
+	if c.rowErrors == nil {
+		c.rowErrors = make([]*rowError, 0)
+		for col := 0; col < len(c.columns)-1; col++ {
+			if !c.columnsUsed.Has(col) {
+				continue
+			}
+			getter := &valueGetter{}
+			if err := c.current.Column(getter, col); err != nil {
+				c.rowErrors = append(c.rowErrors, &rowError{c.columns[col].Name, c.annotateError(err, col).Error()})
+			}
+		}
+	}
+
+	if len(c.rowErrors) == 0 {
+		ctx.ResultNull()
+		return nil
+	}
+
+	b, err := json.Marshal(c.rowErrors)
+	if err != nil {
+		return err
+	}
+	ctx.ResultText(string(b))
+	return nil
+}
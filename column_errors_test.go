@@ -0,0 +1,111 @@
+package vtab_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+type flakyIter struct {
+	current int
+}
+
+func (i *flakyIter) Column(ctx vtab.Context, c int) error {
+	switch flakyCols[c].Name {
+	case "id":
+		ctx.ResultInt(i.current)
+	case "value":
+		if i.current%2 == 0 {
+			return fmt.Errorf("unreadable value")
+		}
+		ctx.ResultInt(i.current * 10)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+func (i *flakyIter) Next() (vtab.Row, error) {
+	i.current++
+	if i.current > 4 {
+		return nil, io.EOF
+	}
+	return i, nil
+}
+
+var flakyCols = []vtab.Column{
+	{Name: "id", Type: "INTEGER"},
+	{Name: "value", Type: "INTEGER"},
+}
+
+var flakyModule = vtab.NewTableFunc("flaky", flakyCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	return &flakyIter{}, nil
+}, vtab.TolerateColumnErrors(true))
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("flaky", flakyModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestTolerateColumnErrors(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []struct {
+		ID     int            `db:"id"`
+		Value  sql.NullInt64  `db:"value"`
+		Errors sql.NullString `db:"_errors"`
+	}
+	err = db.Select(&contents, "select id, value, _errors from flaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 4, len(contents))
+
+	assert.Equal(t, int64(10), contents[0].Value.Int64)
+	assert.False(t, contents[0].Errors.Valid)
+
+	assert.False(t, contents[1].Value.Valid)
+	assert.Equal(t, `[{"column":"value","error":"unreadable value"}]`, contents[1].Errors.String)
+}
+
+func TestTolerateColumnErrorsQueryErrors(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the side channel can be inspected without selecting the failing column
+	var ids []int
+	err = db.Select(&ids, "select id from flaky where _errors is not null and value is null")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{2, 4}, ids)
+
+	// but only the columns used by the query are probed for errors, as the others may be expensive to read
+	ids = nil
+	err = db.Select(&ids, "select id from flaky where _errors is not null")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, ids)
+}
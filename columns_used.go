@@ -0,0 +1,23 @@
+package vtab
+
+// ColumnSet is a set of column indexes, such as the columns referenced by a query.
+// As with SQLite's colUsed, the last bit stands for every column from index 63 onwards.
+type ColumnSet uint64
+
+// AllColumns is the ColumnSet containing every column
+const AllColumns = ^ColumnSet(0)
+
+// Has reports whether col is in the set
+func (s ColumnSet) Has(col int) bool {
+	if col >= 63 {
+		col = 63
+	}
+	return s&(1<<uint(col)) != 0
+}
+
+// ColumnsUsedIterator is an Iterator that's told which columns a query references, before its first Next,
+// so that it can avoid loading the values of columns that won't be read.
+type ColumnsUsedIterator interface {
+	Iterator
+	ColumnsUsed(used ColumnSet)
+}
@@ -0,0 +1,17 @@
+package vtab
+
+import "testing"
+
+func TestColumnSetHas(t *testing.T) {
+	used := ColumnSet(1<<0 | 1<<2 | 1<<63)
+
+	for col, want := range map[int]bool{0: true, 1: false, 2: true, 62: false, 63: true, 100: true} {
+		if got := used.Has(col); got != want {
+			t.Fatalf("column %d: wanted: %v, got: %v", col, want, got)
+		}
+	}
+
+	if !AllColumns.Has(10) {
+		t.Fatal("AllColumns should contain every column")
+	}
+}
@@ -0,0 +1,127 @@
+package vtab
+
+import (
+	"bytes"
+
+	"go.riyazali.net/sqlite"
+)
+
+// compareValue compares a column value (as captured by a valueGetter) with a constraint value,
+// returning -1, 0 or 1. ok is false if the column value is of a type that can't be compared,
+// or of a different storage class than the constraint's, leaving the comparison to SQLite.
+// Integers are compared as floats with REAL constraints, so that port < 80.5 holds for 80.
+func compareValue(v interface{}, limit *sqlite.Value) (comparison int, ok bool) {
+	switch v := v.(type) {
+	case int:
+		return compareValue(int64(v), limit)
+	case int64:
+		switch limit.Type() {
+		case sqlite.SQLITE_INTEGER:
+			return compareOrdered(v, limit.Int64()), true
+		case sqlite.SQLITE_FLOAT:
+			return compareOrdered(float64(v), limit.Float()), true
+		}
+	case float64:
+		switch limit.Type() {
+		case sqlite.SQLITE_INTEGER, sqlite.SQLITE_FLOAT:
+			return compareOrdered(v, limit.Float()), true
+		}
+	case string:
+		if limit.Type() == sqlite.SQLITE_TEXT {
+			return compareOrdered(v, limit.Text()), true
+		}
+	case []byte:
+		if limit.Type() == sqlite.SQLITE_BLOB {
+			return bytes.Compare(v, limit.Blob()), true
+		}
+	}
+	return 0, false
+}
+
+// compareValues compares two column values (as captured by a valueGetter) using SQLite's
+// ordering of storage classes: NULL, then numbers, then text, then blobs.
+func compareValues(a, b interface{}) int {
+	ra, rb := storageRank(a), storageRank(b)
+	if ra != rb {
+		return compareOrdered(ra, rb)
+	}
+
+	switch a := a.(type) {
+	case int:
+		if b, ok := b.(int); ok {
+			return compareOrdered(a, b)
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return compareOrdered(a, b)
+		}
+	case string:
+		return compareOrdered(a, b.(string))
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	}
+	if ra == 1 {
+		return compareOrdered(toFloat(a), toFloat(b))
+	}
+	return 0
+}
+
+// matchConstraint reports whether a comparison (as returned by compareValue) satisfies op.
+// Operators other than the comparison operators are always considered satisfied.
+func matchConstraint(comparison int, op sqlite.ConstraintOp) bool {
+	switch op {
+	case sqlite.INDEX_CONSTRAINT_EQ, sqlite.INDEX_CONSTRAINT_IS:
+		return comparison == 0
+	case sqlite.INDEX_CONSTRAINT_NE, sqlite.INDEX_CONSTRAINT_ISNOT:
+		return comparison != 0
+	case sqlite.INDEX_CONSTRAINT_GT:
+		return comparison > 0
+	case sqlite.INDEX_CONSTRAINT_GE:
+		return comparison >= 0
+	case sqlite.INDEX_CONSTRAINT_LT:
+		return comparison < 0
+	case sqlite.INDEX_CONSTRAINT_LE:
+		return comparison <= 0
+	default:
+		return true
+	}
+}
+
+func compareOrdered[T int | int64 | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func storageRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int, int64, float64:
+		return 1
+	case string:
+		return 2
+	case []byte:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
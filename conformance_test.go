@@ -0,0 +1,20 @@
+package vtab_test
+
+import (
+	"testing"
+
+	"github.com/augmentable-dev/vtab/pkg/vtabtest"
+	"go.riyazali.net/sqlite"
+)
+
+func TestConformance(t *testing.T) {
+	db, _ := vtabtest.Open(t, "series_conformance", seriesModule, sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+	vtabtest.Conformance(t, db, vtabtest.Table{From: "series_conformance(0, 100, 1)"})
+	vtabtest.Conformance(t, db, vtabtest.Table{From: "series_conformance(10, 50, 5)"})
+
+	db, _ = vtabtest.Open(t, "alphabet_conformance", alphabetModule, sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+	vtabtest.Conformance(t, db, vtabtest.Table{From: "alphabet_conformance"})
+
+	db, _ = vtabtest.Open(t, "services_conformance", servicesModule, sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+	vtabtest.Conformance(t, db, vtabtest.Table{From: "services_conformance"})
+}
@@ -0,0 +1,121 @@
+package vtab
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Error is an error that can be returned from a GetIteratorFunc, Iterator.Next or Row.Column
+// to report a specific SQLite result code (SQLITE_BUSY, SQLITE_CONSTRAINT, SQLITE_NOTFOUND etc.)
+// rather than the generic SQLITE_ERROR.
+type Error struct {
+	// Code is the SQLite result code to report, defaults to SQLITE_ERROR if unset
+	Code sqlite.ErrorCode
+	// Table is the name of the table the error originated from, filled in by the table-func if left empty
+	Table string
+	// Column is the name of the column (or hidden argument) involved, if any
+	Column string
+	// Err is the underlying error
+	Err error
+}
+
+// NewError returns an *Error reporting err with the given SQLite result code
+func NewError(code sqlite.ErrorCode, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// Errorf returns an *Error reporting a formatted message with the given SQLite result code
+func Errorf(code sqlite.ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// ColumnError returns an *Error reporting err against the named column (or argument)
+func ColumnError(code sqlite.ErrorCode, column string, err error) *Error {
+	return &Error{Code: code, Column: column, Err: err}
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Table != "" {
+		b.WriteString(e.Table)
+		b.WriteString(": ")
+	}
+	if e.Column != "" {
+		b.WriteString(e.Column)
+		b.WriteString(": ")
+	}
+	if e.Err != nil {
+		b.WriteString(e.Err.Error())
+	} else {
+		b.WriteString(e.code().Error())
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is the sqlite.ErrorCode carried by e,
+// so that errors.Is(err, sqlite.SQLITE_BUSY) works as expected
+func (e *Error) Is(target error) bool {
+	code, ok := target.(sqlite.ErrorCode)
+	return ok && code == e.code()
+}
+
+// As sets target to the code carried by e if it's a *sqlite.ErrorCode,
+// so that errors.As(err, &code) finds the code SQLite is to report
+func (e *Error) As(target interface{}) bool {
+	code, ok := target.(*sqlite.ErrorCode)
+	if ok {
+		*code = e.code()
+	}
+	return ok
+}
+
+func (e *Error) code() sqlite.ErrorCode {
+	if e.Code == sqlite.SQLITE_OK {
+		return sqlite.SQLITE_ERROR
+	}
+	return e.Code
+}
+
+// ResultErrorCode is the code-carrying variant of Context.ResultError. It sets err as the result of
+// the column and then overrides the result code reported to SQLite with code.
+func ResultErrorCode(ctx Context, code sqlite.ErrorCode, err error) {
+	if err != nil {
+		ctx.ResultError(err)
+	}
+	if code != sqlite.SQLITE_OK && code != sqlite.SQLITE_ERROR {
+		ctx.ResultError(code)
+	}
+}
+
+// annotateError returns an *Error wrapping err, with the code of the first *Error in err's chain and the table
+// (and column, if col is a valid index) it lacks filled in. The chain is kept, along with any context added
+// around the *Error, whose table and column are only repeated if err is the *Error itself. The *Error is left
+// as is, as it may be shared, such as a package's sentinel. Errors that are not an *Error are returned as-is.
+func (t *tableFuncTable) annotateError(err error, col int) error {
+	var e *Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	annotated := &Error{Code: e.Code, Err: err}
+	if err == error(e) {
+		annotated.Table, annotated.Column, annotated.Err = e.Table, e.Column, e.Err
+	}
+	if e.Table == "" {
+		annotated.Table = t.name
+	}
+	if e.Column == "" && col >= 0 && col < len(t.columns) {
+		annotated.Column = t.columns[col].Name
+	}
+	return annotated
+}
+
+// translateError converts err into what's returned to SQLite from a table or cursor method.
+// An *Error is returned annotated, so that SQLite is given both its message and its code (see Error.As).
+func (t *tableFuncTable) translateError(err error, col int) error {
+	return t.annotateError(err, col)
+}
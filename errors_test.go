@@ -0,0 +1,199 @@
+package vtab_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+type failingIter struct {
+	current int
+	failOn  string
+}
+
+func (i *failingIter) Column(ctx vtab.Context, c int) error {
+	switch failingCols[c].Name {
+	case "value":
+		if i.failOn == "column" {
+			return vtab.Errorf(sqlite.SQLITE_CONSTRAINT, "value %d is out of range", i.current)
+		}
+		ctx.ResultInt(i.current)
+	case "fail_on":
+		ctx.ResultText(i.failOn)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+func (i *failingIter) Next() (vtab.Row, error) {
+	i.current++
+	if i.failOn == "next" && i.current > 2 {
+		return nil, vtab.NewError(sqlite.SQLITE_ERROR, errors.New("source went away"))
+	}
+	if i.current > 5 {
+		return nil, io.EOF
+	}
+	return i, nil
+}
+
+var failingCols = []vtab.Column{
+	{Name: "value", Type: "INTEGER"},
+	{Name: "fail_on", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+}
+
+// errSentinel is shared by the scans failing with it, so mustn't be annotated in place
+var errSentinel = vtab.NewError(sqlite.SQLITE_BUSY, errors.New("source is busy"))
+
+var failingModule = vtab.NewTableFunc("failing", failingCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	failOn := ""
+	for _, constraint := range constraints {
+		if constraint.Op == sqlite.INDEX_CONSTRAINT_EQ && constraint.ColIndex == 1 {
+			failOn = constraint.Value.Text()
+		}
+	}
+
+	if failOn == "sentinel" {
+		return nil, errSentinel
+	}
+	if failOn == "wrapped" {
+		return nil, fmt.Errorf("opening source: %w", vtab.NewError(sqlite.SQLITE_NOTFOUND, errors.New("no such source")))
+	}
+	if failOn == "iterator" {
+		return nil, vtab.ColumnError(sqlite.SQLITE_NOTFOUND, "fail_on", errors.New("no such source"))
+	}
+
+	return &failingIter{0, failOn}, nil
+})
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("failing", failingModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestErrorFormatting(t *testing.T) {
+	err := &vtab.Error{Code: sqlite.SQLITE_BUSY, Table: "failing", Column: "value", Err: errors.New("try again")}
+
+	assert.Equal(t, "failing: value: try again", err.Error())
+	assert.True(t, errors.Is(err, sqlite.SQLITE_BUSY))
+	assert.False(t, errors.Is(err, sqlite.SQLITE_ERROR))
+
+	wrapped := fmt.Errorf("wrapped: %w", err)
+	var e *vtab.Error
+	assert.True(t, errors.As(wrapped, &e))
+	assert.Equal(t, sqlite.SQLITE_BUSY, e.Code)
+
+	var code sqlite.ErrorCode
+	assert.True(t, errors.As(wrapped, &code))
+	assert.Equal(t, sqlite.SQLITE_BUSY, code)
+
+	// an unset code is reported as a generic SQLITE_ERROR
+	assert.True(t, errors.Is(&vtab.Error{Err: errors.New("oops")}, sqlite.SQLITE_ERROR))
+}
+
+func TestErrorFromNext(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []int
+	err = db.Select(&contents, "select value from failing('next')")
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), "failing: source went away")
+}
+
+func TestErrorFromColumn(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []int
+	err = db.Select(&contents, "select value from failing('column')")
+	if !assert.Error(t, err) {
+		return
+	}
+
+	var sqliteErr sqlite3.Error
+	if assert.True(t, errors.As(err, &sqliteErr)) {
+		assert.Equal(t, sqlite3.ErrConstraint, sqliteErr.Code)
+	}
+	assert.Contains(t, err.Error(), "failing: value: value 1 is out of range")
+}
+
+func TestErrorFromIterator(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []int
+	err = db.Select(&contents, "select value from failing('iterator')")
+	if !assert.Error(t, err) {
+		return
+	}
+
+	var sqliteErr sqlite3.Error
+	if assert.True(t, errors.As(err, &sqliteErr)) {
+		assert.Equal(t, sqlite3.ErrNotFound, sqliteErr.Code)
+	}
+	assert.Contains(t, err.Error(), "failing: fail_on: no such source")
+}
+
+func TestErrorSentinel(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []int
+	err = db.Select(&contents, "select value from failing('sentinel')")
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), "failing: source is busy")
+	// the error reported is a copy, annotated with the table
+	assert.Equal(t, "", errSentinel.Table)
+}
+
+func TestErrorWrapped(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []int
+	err = db.Select(&contents, "select value from failing('wrapped')")
+	if !assert.Error(t, err) {
+		return
+	}
+
+	var sqliteErr sqlite3.Error
+	if assert.True(t, errors.As(err, &sqliteErr)) {
+		assert.Equal(t, sqlite3.ErrNotFound, sqliteErr.Code)
+	}
+	// the context around the *Error is kept
+	assert.Contains(t, err.Error(), "failing: opening source: no such source")
+}
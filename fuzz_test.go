@@ -0,0 +1,56 @@
+package vtab_test
+
+import (
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/augmentable-dev/vtab/pkg/vtabtest"
+	"go.riyazali.net/sqlite"
+)
+
+func FuzzSeriesBestIndex(f *testing.F) {
+	vtabtest.FuzzBestIndex(f, seriesModule, len(seriesCols))
+}
+
+func FuzzAlphabetBestIndex(f *testing.F) {
+	vtabtest.FuzzBestIndex(f, alphabetModule, len(alphabetIterCols))
+}
+
+func FuzzServicesBestIndex(f *testing.F) {
+	vtabtest.FuzzBestIndex(f, servicesModule, len(serviceCols))
+}
+
+func FuzzKVBestIndex(f *testing.F) {
+	vtabtest.FuzzBestIndex(f, vtab.NewKVTable("kv", vtab.NewMapStore()), 2)
+}
+
+func FuzzServicesQueries(f *testing.F) {
+	db, _ := vtabtest.Open(f, "services_fuzz", servicesModule, sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+	vtabtest.FuzzQueries(f, db, vtabtest.Table{From: "services_fuzz"})
+}
+
+func FuzzSeriesQueries(f *testing.F) {
+	db, _ := vtabtest.Open(f, "series_fuzz", seriesModule, sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+	vtabtest.FuzzQueries(f, db, vtabtest.Table{From: "series_fuzz(0, 50, 1)", Samples: 8})
+}
+
+func TestBestIndexDuplicateFilters(t *testing.T) {
+	m := vtab.NewTableFunc("duplicates", []vtab.Column{
+		{Name: "a", Type: "INTEGER", Filters: []*vtab.ColumnFilter{
+			{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true},
+		}},
+		{Name: "b", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	}, nil)
+	table, err := m.Connect(nil, nil, func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = vtabtest.CheckBestIndex(table, &sqlite.IndexInfoInput{Constraints: []*sqlite.IndexConstraint{
+		{ColumnIndex: 0, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: true},
+		{ColumnIndex: 1, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
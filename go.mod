@@ -1,12 +1,15 @@
 module github.com/augmentable-dev/vtab
 
-go 1.16
+go 1.23
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/jmoiron/sqlx v1.3.4
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.10
 	go.riyazali.net/sqlite v0.0.0-20220820100132-b0f5d97504db
-	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
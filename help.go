@@ -0,0 +1,256 @@
+package vtab
+
+import (
+	"fmt"
+	"strings"
+
+	"go.riyazali.net/sqlite"
+)
+
+// ColumnsTable and HelpFunction are the names of the table and function describing a Registry's modules,
+// see Registry.Register
+const (
+	ColumnsTable = "vtab_columns"
+	HelpFunction = "vtab_help"
+)
+
+// Describe gives the table-func a description, and examples of queries of it, as shown by vtab_modules
+// and vtab_help (see Registry)
+func Describe(description string, examples ...string) OptFunc {
+	return func(opts *options) {
+		opts.description = description
+		opts.examples = append(opts.examples, examples...)
+	}
+}
+
+// ModuleDescription returns the description and examples of a module created with Describe, if any
+func ModuleDescription(m sqlite.Module) (description string, examples []string) {
+	if m, ok := m.(*tableFuncModule); ok {
+		return m.options.description, m.options.examples
+	}
+	return "", nil
+}
+
+// description returns the description of the module, its ModuleInfo's or else that of its Describe option
+func (info *ModuleInfo) description() string {
+	if info.Description != "" {
+		return info.Description
+	}
+	description, _ := ModuleDescription(info.Module)
+	return description
+}
+
+// isArgument returns whether a column is an argument of its table-func, a hidden column with an = filter
+func isArgument(col Column) bool {
+	if !col.Hidden {
+		return false
+	}
+	for _, filter := range col.Filters {
+		if filter.Op == sqlite.INDEX_CONSTRAINT_EQ {
+			return true
+		}
+	}
+	return false
+}
+
+// filterNames returns the operators of a column's filters, such as >, >=
+func filterNames(col Column) string {
+	var names []string
+	seen := make(map[sqlite.ConstraintOp]bool)
+	for _, filter := range col.Filters {
+		if !seen[filter.Op] {
+			seen[filter.Op] = true
+			names = append(names, OpName(filter.Op))
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// orderNames returns the orders of a column, such as ASC, DESC
+func orderNames(col Column) string {
+	var names []string
+	if col.OrderBy&ASC != 0 {
+		names = append(names, "ASC")
+	}
+	if col.OrderBy&DESC != 0 {
+		names = append(names, "DESC")
+	}
+	return strings.Join(names, ", ")
+}
+
+// moduleColumnInfo is a column of a module, a row of vtab_columns
+type moduleColumnInfo struct {
+	module string
+	cid    int
+	Column
+}
+
+// columnInfos returns the columns of modules, by module
+func columnInfos(modules []*ModuleInfo) []*moduleColumnInfo {
+	var columns []*moduleColumnInfo
+	for _, info := range modules {
+		for c, col := range ModuleColumns(info.Module) {
+			columns = append(columns, &moduleColumnInfo{info.Name, c, col})
+		}
+	}
+	return columns
+}
+
+var columnInfoCols = []Column{
+	{Name: "module", Type: "TEXT", Hidden: true, Filters: []*ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}},
+		Description: "the name of the module"},
+	{Name: "cid", Type: "INTEGER", Description: "the position of the column in the table"},
+	{Name: "name", Type: "TEXT"},
+	{Name: "type", Type: "TEXT"},
+	{Name: "hidden", Type: "INTEGER"},
+	{Name: "argument", Type: "INTEGER", Description: "whether the column is an argument of the table-func"},
+	{Name: "not_null", Type: "INTEGER"},
+	{Name: "primary_key", Type: "INTEGER"},
+	{Name: "filters", Type: "TEXT", Description: "the operators of the constraints handled by the module, such as =, >"},
+	{Name: "order_by", Type: "TEXT", Description: "the orders the module can produce, ASC and/or DESC"},
+	{Name: "description", Type: "TEXT"},
+}
+
+// ColumnsModule returns the vtab_columns table of the columns of the registry's modules, created by Register,
+// whose argument is the name of a module, as in SELECT * FROM vtab_columns('series'). filters and order_by
+// list the constraints and orders the module handles, from its Filters and OrderBy.
+// Modules whose columns are decided by each table (see NewModule) have none. Only the columns of the named
+// module are listed, when there's one.
+func (r *Registry) ColumnsModule() sqlite.Module {
+	column := func(ctx Context, col *moduleColumnInfo, c int) error {
+		text := func(s string) {
+			if s == "" {
+				ctx.ResultNull()
+			} else {
+				ctx.ResultText(s)
+			}
+		}
+		switch columnInfoCols[c].Name {
+		case "module":
+			ctx.ResultText(col.module)
+		case "cid":
+			ctx.ResultInt(col.cid)
+		case "name":
+			ctx.ResultText(col.Name)
+		case "type":
+			ctx.ResultText(col.Type)
+		case "hidden":
+			return resultValue(ctx, col.Hidden)
+		case "argument":
+			return resultValue(ctx, isArgument(col.Column))
+		case "not_null":
+			return resultValue(ctx, col.NotNull)
+		case "primary_key":
+			return resultValue(ctx, col.PrimaryKey)
+		case "filters":
+			text(filterNames(col.Column))
+		case "order_by":
+			text(orderNames(col.Column))
+		case "description":
+			text(col.Description)
+		default:
+			return fmt.Errorf("unknown column")
+		}
+		return nil
+	}
+
+	cols := sliceColumns(columnInfoCols)
+	return NewTableFunc(ColumnsTable, cols, func(constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error) {
+		modules := r.Modules()
+		var others []*Constraint
+		for _, constraint := range constraints {
+			if constraint.ColIndex < 0 || cols[constraint.ColIndex].Name != "module" {
+				others = append(others, constraint)
+				continue
+			}
+			// the constraint is omitted by SQLite, so it's checked here (it's the only filter of the column)
+			var named []*ModuleInfo
+			for _, info := range modules {
+				if !constraint.Value.IsNil() && info.Name == constraint.Value.Text() {
+					named = append(named, info)
+				}
+			}
+			modules = named
+		}
+		return newSliceIterator(columnInfos(modules), column, others, order)
+	}, EarlyOrderByConstraintExit(true), Describe("The columns of the modules, with the constraints and orders they handle",
+		"SELECT name, type, filters, order_by FROM vtab_columns('series')"))
+}
+
+// Help returns the help text of the named module, as returned by vtab_help: its arguments, description,
+// columns (with the constraints and orders they handle) and examples.
+func (r *Registry) Help(name string) (string, error) {
+	r.mu.Lock()
+	info, ok := r.modules[name]
+	r.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no module %q", name)
+	}
+
+	columns := ModuleColumns(info.Module)
+	var args []string
+	for _, col := range columns {
+		if isArgument(col) {
+			args = append(args, col.Name)
+		}
+	}
+
+	var sb strings.Builder
+	if len(args) > 0 {
+		fmt.Fprintf(&sb, "%s(%s)\n", info.Name, strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(&sb, "%s\n", info.Name)
+	}
+	if description := info.description(); description != "" {
+		fmt.Fprintf(&sb, "  %s\n", description)
+	}
+
+	section := func(title string, argument bool) {
+		var lines []string
+		for _, col := range columns {
+			// arguments are listed apart from the other columns, of which hidden ones aren't listed
+			if argument && !isArgument(col) || !argument && col.Hidden {
+				continue
+			}
+			line := "  " + strings.TrimSpace(col.Name+" "+col.Type)
+			if filters := filterNames(col); filters != "" && !argument {
+				line += ", filters " + filters
+			}
+			if orders := orderNames(col); orders != "" {
+				line += ", ordered " + orders
+			}
+			if col.Description != "" {
+				line += ": " + col.Description
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&sb, "\n%s:\n%s\n", title, strings.Join(lines, "\n"))
+		}
+	}
+	section("Arguments", true)
+	section("Columns", false)
+	if columns == nil {
+		sb.WriteString("\nColumns are decided by the arguments of each table.\n")
+	}
+
+	if _, examples := ModuleDescription(info.Module); len(examples) > 0 {
+		fmt.Fprintf(&sb, "\nExamples:\n  %s\n", strings.Join(examples, "\n  "))
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// helpFunction is vtab_help(module), returning the help text of a registry's module
+type helpFunction struct{ registry *Registry }
+
+func (f *helpFunction) Deterministic() bool { return false }
+func (f *helpFunction) Args() int           { return 1 }
+
+func (f *helpFunction) Apply(ctx *sqlite.Context, values ...sqlite.Value) {
+	help, err := f.registry.Help(values[0].Text())
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+	ctx.ResultText(help)
+}
@@ -0,0 +1,133 @@
+package vtab_test
+
+import (
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+var describedSeriesCols = []vtab.Column{
+	{Name: "value", Type: "INTEGER", OrderBy: vtab.ASC | vtab.DESC, Filters: []*vtab.ColumnFilter{
+		{Op: sqlite.INDEX_CONSTRAINT_GT}, {Op: sqlite.INDEX_CONSTRAINT_GE},
+		{Op: sqlite.INDEX_CONSTRAINT_LT}, {Op: sqlite.INDEX_CONSTRAINT_LE},
+	}, Description: "a value of the series"},
+	{Name: "start", Type: "INTEGER", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}, Description: "the first value, 0 by default"},
+	{Name: "stop", Type: "INTEGER", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}, Description: "the last value, 100 by default"},
+	{Name: "step", Type: "INTEGER", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+}
+
+// describedSeries is series, with descriptions of it and its columns
+var describedSeries = vtab.NewTableFunc("described_series", describedSeriesCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	return nil, vtab.Errorf(sqlite.SQLITE_ERROR, "not implemented")
+}, vtab.Describe("A series of integers, from start to stop by step", "SELECT value FROM described_series(1, 10, 2)"))
+
+var describedSeriesHelp = `described_series(start, stop, step)
+  A series of integers, from start to stop by step
+
+Arguments:
+  start INTEGER: the first value, 0 by default
+  stop INTEGER: the last value, 100 by default
+  step INTEGER
+
+Columns:
+  value INTEGER, filters >, >=, <, <=, ordered ASC, DESC: a value of the series
+
+Examples:
+  SELECT value FROM described_series(1, 10, 2)`
+
+func init() {
+	registry.Add(&vtab.ModuleInfo{Name: "described_series", Module: describedSeries, EponymousOnly: true, ReadOnly: true})
+}
+
+func TestHelp(t *testing.T) {
+	help, err := registry.Help("described_series")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, describedSeriesHelp, help)
+
+	help, err = registry.Help("registry_echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "registry_echo\n\nColumns are decided by the arguments of each table.", help)
+
+	_, err = registry.Help("missing")
+	assert.EqualError(t, err, `no module "missing"`)
+
+	description, examples := vtab.ModuleDescription(describedSeries)
+	assert.Equal(t, "A series of integers, from start to stop by step", description)
+	assert.Equal(t, []string{"SELECT value FROM described_series(1, 10, 2)"}, examples)
+}
+
+func TestHelpSQL(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var help string
+	if err := db.Get(&help, "SELECT vtab_help('described_series')"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, describedSeriesHelp, help)
+
+	var description string
+	if err := db.Get(&description, "SELECT description FROM vtab_modules WHERE name = 'described_series'"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "A series of integers, from start to stop by step", description)
+
+	type column struct {
+		Name        string  `db:"name"`
+		Argument    bool    `db:"argument"`
+		Filters     *string `db:"filters"`
+		OrderBy     *string `db:"order_by"`
+		Description *string `db:"description"`
+	}
+	var columns []column
+	if err := db.Select(&columns, "SELECT name, argument, filters, order_by, description FROM vtab_columns('described_series') ORDER BY cid"); err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	assert.Equal(t, []column{
+		{Name: "value", Filters: str(">, >=, <, <="), OrderBy: str("ASC, DESC"), Description: str("a value of the series")},
+		{Name: "start", Argument: true, Filters: str("="), Description: str("the first value, 0 by default")},
+		{Name: "stop", Argument: true, Filters: str("="), Description: str("the last value, 100 by default")},
+		{Name: "step", Argument: true, Filters: str("=")},
+	}, columns)
+
+	if err := db.Get(&help, "SELECT vtab_help('missing')"); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `no module "missing"`)
+	}
+
+	// the module argument is checked by vtab_columns, rather than by SQLite
+	for query, want := range map[string]int{
+		"SELECT count(*) FROM vtab_columns('described_series')":                4,
+		"SELECT count(*) FROM vtab_columns WHERE module = 'described_series'":  4,
+		"SELECT count(*) FROM vtab_columns('missing')":                         0,
+		"SELECT count(*) FROM vtab_columns(NULL)":                              0,
+		"SELECT count(DISTINCT module) > 1 FROM vtab_columns":                  1,
+		"SELECT count(*) FROM vtab_columns('described_series') WHERE cid >= 2": 2,
+	} {
+		var n int
+		if err := db.Get(&n, query); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, n, query)
+	}
+}
+
+func TestColumnsModuleArgument(t *testing.T) {
+	cols := vtab.ModuleColumns(registry.ColumnsModule())
+	if assert.Equal(t, "module", cols[0].Name) {
+		assert.True(t, cols[0].Hidden)
+		assert.Equal(t, []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}, cols[0].Filters)
+	}
+}
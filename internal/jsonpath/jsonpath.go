@@ -0,0 +1,120 @@
+// Package jsonpath implements the subset of JSON paths ($.a.b[0]."c d") used by the modules
+// that map JSON documents to columns.
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/augmentable-dev/vtab"
+)
+
+// Path is a parsed JSON path, a list of object keys (strings) and array indices (ints)
+type Path []interface{}
+
+// Parse parses a JSON path such as $.a.b[0]."c d"
+func Parse(p string) (Path, error) {
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("invalid path %q, must start with $", p)
+	}
+
+	path := Path{}
+	rest := p[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.IndexByte(rest[1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("invalid path %q, unterminated key", p)
+				}
+				path = append(path, rest[1:end+1])
+				rest = rest[end+2:]
+				continue
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %q, empty key", p)
+			}
+			path = append(path, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q, unterminated index", p)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid path %q, bad index %q", p, rest[1:end])
+			}
+			path = append(path, i)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q", p)
+		}
+	}
+	return path, nil
+}
+
+// Extract follows the path into a decoded JSON document, reporting false if it doesn't exist
+func (p Path) Extract(doc interface{}) (interface{}, bool) {
+	for _, step := range p {
+		switch step := step.(type) {
+		case string:
+			obj, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if doc, ok = obj[step]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := doc.([]interface{})
+			if !ok || step >= len(arr) {
+				return nil, false
+			}
+			doc = arr[step]
+		}
+	}
+	return doc, true
+}
+
+// Result reports a decoded JSON value (ideally decoded with json.Decoder.UseNumber) through ctx.
+// Booleans are reported as 0 or 1, and objects and arrays as JSON text.
+func Result(ctx vtab.Context, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		ctx.ResultNull()
+	case string:
+		ctx.ResultText(v)
+	case bool:
+		if v {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case float64:
+		ctx.ResultFloat(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			ctx.ResultInt64(i)
+		} else if f, err := v.Float64(); err == nil {
+			ctx.ResultFloat(f)
+		} else {
+			ctx.ResultText(v.String())
+		}
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		ctx.ResultText(string(b))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	path, err := Parse(`$.a.b[2]."c d"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Path{"a", "b", 2, "c d"}
+	if !reflect.DeepEqual(path, want) {
+		t.Fatalf("wanted: %v, got: %v", want, path)
+	}
+
+	if _, err := Parse("a.b"); err == nil {
+		t.Fatal("expected an error for a path without $")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	doc := map[string]interface{}{"a": []interface{}{"x", map[string]interface{}{"b": "y"}}}
+
+	v, ok := Path{"a", 1, "b"}.Extract(doc)
+	if !ok || v != "y" {
+		t.Fatalf("wanted: y, got: %v", v)
+	}
+
+	if _, ok := (Path{"a", 5}).Extract(doc); ok {
+		t.Fatal("expected an index out of range not to be found")
+	}
+}
@@ -0,0 +1,259 @@
+package vtab
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"iter"
+	"sort"
+	"sync"
+
+	"go.riyazali.net/sqlite"
+)
+
+// KV is a single entry of a KVStore
+type KV struct {
+	Key   []byte
+	Value []byte
+}
+
+// KVRange is the range of keys read by a KVStore scan
+type KVRange struct {
+	// Prefix restricts the scan to keys with the prefix
+	Prefix []byte
+	// Start is the key the scan starts from (inclusive), the smallest key of the scan or, if it's reversed,
+	// the largest. A nil Start scans from the first (or last) key with Prefix.
+	Start []byte
+	// Reverse scans keys in descending order
+	Reverse bool
+}
+
+// KVStore is an ordered key-value store, such as an embedded database, that can be exposed as a table with
+// NewKVTable. Keys are ordered bytewise.
+type KVStore interface {
+	// Get returns the value of key, or nil if there's none
+	Get(key []byte) ([]byte, error)
+	// Scan returns the entries of a range, in order. Entries aren't valid after the sequence moves on.
+	Scan(r KVRange) iter.Seq2[KV, error]
+	Put(key, value []byte) error
+	Delete(key []byte) error
+}
+
+// kvColumns are the columns of a kv table
+var kvColumns = []Column{
+	{Name: "key", Type: "TEXT", PrimaryKey: true, OrderBy: ASC | DESC, Filters: []*ColumnFilter{
+		{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true},
+		{Op: sqlite.INDEX_CONSTRAINT_GT}, {Op: sqlite.INDEX_CONSTRAINT_GE},
+		{Op: sqlite.INDEX_CONSTRAINT_LT}, {Op: sqlite.INDEX_CONSTRAINT_LE},
+	}},
+	{Name: "value", Type: "TEXT"},
+}
+
+// NewKVTable returns a module exposing store as a table of (key, value) rows, in key order.
+// An = constraint on key is a Get, and the >, >=, < and <= constraints become a scan from the lower (or, for
+// ORDER BY key DESC, upper) bound, ending as soon as the other bound is passed. INSERT and UPDATE statements
+// Put keys (an INSERT of an existing key replaces its value) and DELETE statements Delete them.
+func NewKVTable(name string, store KVStore, opts ...OptFunc) sqlite.Module {
+	return NewTableFunc(name, kvColumns, func(constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error) {
+		return newKVIterator(store, constraints, order)
+	}, append([]OptFunc{Writable(&kvWriter{store})}, opts...)...)
+}
+
+type kvIterator struct {
+	next        func() (KV, error, bool)
+	stop        func()
+	constraints []*Constraint
+	desc        bool
+	// skip is a key to skip at the start of the scan, the bound of a > (or <, when descending) constraint
+	skip  []byte
+	entry KV
+}
+
+func newKVIterator(store KVStore, constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error) {
+	it := &kvIterator{constraints: constraints}
+	for _, o := range order {
+		if o.ColumnIndex == 0 {
+			it.desc = o.Desc
+		}
+	}
+
+	r := KVRange{Reverse: it.desc}
+	var seq iter.Seq2[KV, error]
+	for _, constraint := range constraints {
+		if constraint.ColIndex != 0 {
+			continue
+		}
+		if constraint.Value.Type() == sqlite.SQLITE_NULL {
+			// comparisons with NULL are never true, and the = constraint isn't checked again by SQLite
+			it.next, it.stop = iter.Pull2(func(func(KV, error) bool) {})
+			return it, nil
+		}
+		bound := []byte(constraint.Value.Text())
+
+		switch op := constraint.Op; {
+		case op == sqlite.INDEX_CONSTRAINT_EQ:
+			seq = func(yield func(KV, error) bool) {
+				value, err := store.Get(bound)
+				if err != nil {
+					yield(KV{}, err)
+				} else if value != nil {
+					yield(KV{bound, value}, nil)
+				}
+			}
+		case !it.desc && (op == sqlite.INDEX_CONSTRAINT_GT || op == sqlite.INDEX_CONSTRAINT_GE),
+			it.desc && (op == sqlite.INDEX_CONSTRAINT_LT || op == sqlite.INDEX_CONSTRAINT_LE):
+			// start from the tightest bound
+			if cmp := bytes.Compare(bound, r.Start); r.Start == nil || (!it.desc && cmp > 0) || (it.desc && cmp < 0) {
+				r.Start, it.skip = bound, nil
+			}
+			if bytes.Equal(bound, r.Start) && (op == sqlite.INDEX_CONSTRAINT_GT || op == sqlite.INDEX_CONSTRAINT_LT) {
+				it.skip = bound
+			}
+		}
+	}
+
+	if seq == nil {
+		seq = store.Scan(r)
+	}
+	it.next, it.stop = iter.Pull2(seq)
+	return it, nil
+}
+
+func (i *kvIterator) Next() (Row, error) {
+	for {
+		entry, err, ok := i.next()
+		if !ok {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i.skip != nil && bytes.Equal(entry.Key, i.skip) {
+			i.skip = nil
+			continue
+		}
+		i.skip = nil
+
+		// the scan ends at the first key past the other bound, as with EarlyOrderByConstraintExit
+		if past, ok := pastConstraints(string(entry.Key), i.constraints, 0, i.desc); ok && past {
+			return nil, io.EOF
+		}
+
+		i.entry = entry
+		return i, nil
+	}
+}
+
+func (i *kvIterator) Close() error {
+	i.stop()
+	return nil
+}
+
+func (i *kvIterator) Column(ctx Context, c int) error {
+	switch c {
+	case 0:
+		ctx.ResultText(string(i.entry.Key))
+	case 1:
+		ctx.ResultText(string(i.entry.Value))
+	}
+	return nil
+}
+
+// kvWriter applies the changes made to a kv table to its store
+type kvWriter struct {
+	store KVStore
+}
+
+// valueBytes returns the bytes of a text or blob value
+func valueBytes(v sqlite.Value) []byte {
+	if v.Type() == sqlite.SQLITE_BLOB {
+		return v.Blob()
+	}
+	return []byte(v.Text())
+}
+
+func (w *kvWriter) Insert(values []sqlite.Value) error {
+	if values[0].Type() == sqlite.SQLITE_NULL {
+		return NewError(sqlite.SQLITE_CONSTRAINT, errors.New("key can't be NULL"))
+	}
+	return w.store.Put(valueBytes(values[0]), valueBytes(values[1]))
+}
+
+func (w *kvWriter) Update(key sqlite.Value, values []sqlite.Value) error {
+	if values[0].Type() == sqlite.SQLITE_NULL {
+		return NewError(sqlite.SQLITE_CONSTRAINT, errors.New("key can't be NULL"))
+	}
+	if old := valueBytes(key); !bytes.Equal(old, valueBytes(values[0])) {
+		if err := w.store.Delete(old); err != nil {
+			return err
+		}
+	}
+	return w.Insert(values)
+}
+
+func (w *kvWriter) Delete(key sqlite.Value) error {
+	return w.store.Delete(valueBytes(key))
+}
+
+// MapStore is a KVStore held in memory, safe for concurrent use
+type MapStore struct {
+	mu      sync.RWMutex
+	entries map[string][]byte
+}
+
+// NewMapStore returns an empty MapStore
+func NewMapStore() *MapStore {
+	return &MapStore{entries: make(map[string][]byte)}
+}
+
+func (m *MapStore) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.entries[string(key)], nil
+}
+
+// Scan returns the entries of a range as of the start of the scan
+func (m *MapStore) Scan(r KVRange) iter.Seq2[KV, error] {
+	return func(yield func(KV, error) bool) {
+		m.mu.RLock()
+		entries := make([]KV, 0, len(m.entries))
+		for k, v := range m.entries {
+			key := []byte(k)
+			if !bytes.HasPrefix(key, r.Prefix) {
+				continue
+			}
+			if r.Start != nil && ((!r.Reverse && bytes.Compare(key, r.Start) < 0) || (r.Reverse && bytes.Compare(key, r.Start) > 0)) {
+				continue
+			}
+			entries = append(entries, KV{key, v})
+		}
+		m.mu.RUnlock()
+
+		sort.Slice(entries, func(a, b int) bool {
+			if r.Reverse {
+				return bytes.Compare(entries[a].Key, entries[b].Key) > 0
+			}
+			return bytes.Compare(entries[a].Key, entries[b].Key) < 0
+		})
+		for _, entry := range entries {
+			if !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m *MapStore) Put(key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// a copy that's never nil, which Get would report as a missing key
+	m.entries[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *MapStore) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, string(key))
+	return nil
+}
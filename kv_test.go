@@ -0,0 +1,216 @@
+package vtab_test
+
+import (
+	"iter"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+// countingStore is a KVStore that counts the calls made to it, and the entries read by scans
+type countingStore struct {
+	vtab.KVStore
+	gets, scans, read int
+	last              vtab.KVRange
+}
+
+func (s *countingStore) Get(key []byte) ([]byte, error) {
+	s.gets++
+	return s.KVStore.Get(key)
+}
+
+func (s *countingStore) Scan(r vtab.KVRange) iter.Seq2[vtab.KV, error] {
+	s.scans++
+	s.last = r
+	return func(yield func(vtab.KV, error) bool) {
+		for entry, err := range s.KVStore.Scan(r) {
+			s.read++
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
+
+func (s *countingStore) reset() {
+	s.gets, s.scans, s.read = 0, 0, 0
+}
+
+var kvStore = &countingStore{KVStore: vtab.NewMapStore()}
+
+// kvWriteStore is the store of the kv_write table, which is written to by tests
+var kvWriteStore = vtab.NewMapStore()
+
+// kvCachedStore is the store of the kv_cached table, whose scans are cached
+var kvCachedStore = &countingStore{KVStore: vtab.NewMapStore()}
+
+func init() {
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		if err := kvStore.Put([]byte(key), []byte("value of "+key)); err != nil {
+			panic(err)
+		}
+	}
+
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("kv", vtab.NewKVTable("kv", kvStore), sqlite.EponymousOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("kv_write", vtab.NewKVTable("kv_write", kvWriteStore), sqlite.EponymousOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		kvCached := vtab.NewKVTable("kv_cached", kvCachedStore, vtab.Cached(vtab.NewCache(0, 1<<20)))
+		if err := api.CreateModule("kv_cached", kvCached, sqlite.EponymousOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestKVGet(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	kvStore.reset()
+	var value string
+	if err := db.Get(&value, "select value from kv where key = 'c'"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "value of c", value)
+	assert.Equal(t, 1, kvStore.gets)
+	assert.Equal(t, 0, kvStore.scans)
+}
+
+func TestKVNullKey(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, query := range []string{
+		"select key from kv where key = ?",
+		"select key from kv where key > ?",
+		"select key from kv where key <= ? order by key desc",
+	} {
+		kvStore.reset()
+		var keys []string
+		if err := db.Select(&keys, query, nil); err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, keys, query)
+		assert.Equal(t, 0, kvStore.scans+kvStore.gets, query)
+	}
+}
+
+func TestKVRange(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	kvStore.reset()
+	var keys []string
+	if err := db.Select(&keys, "select key from kv where key > 'b' and key <= 'd'"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"c", "d"}, keys)
+	assert.Equal(t, []byte("b"), kvStore.last.Start)
+	// b (skipped), c, d and e (past the end)
+	assert.Equal(t, 4, kvStore.read)
+
+	kvStore.reset()
+	keys = nil
+	if err := db.Select(&keys, "select key from kv where key >= 'b' and key < 'e' order by key desc"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"d", "c", "b"}, keys)
+	assert.True(t, kvStore.last.Reverse)
+	assert.Equal(t, []byte("e"), kvStore.last.Start)
+	assert.Equal(t, 5, kvStore.read)
+}
+
+func TestKVWrite(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("insert into kv_write (key, value) values ('x', '1'), ('y', '2'), ('z', '3')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("update kv_write set value = value * 10 where key >= 'y'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("update kv_write set key = 'w' where key = 'x'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("delete from kv_write where key = 'z'"); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []struct {
+		Key   string `db:"key"`
+		Value string `db:"value"`
+	}
+	if err := db.Select(&rows, "select key, value from kv_write"); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "w", rows[0].Key)
+		assert.Equal(t, "1", rows[0].Value)
+		assert.Equal(t, "y", rows[1].Key)
+		assert.Equal(t, "20", rows[1].Value)
+	}
+
+	_, err = db.Exec("insert into kv_write (key, value) values (NULL, 'x')")
+	assert.Error(t, err)
+}
+
+func TestKVWriteInvalidatesCache(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	values := func() []string {
+		t.Helper()
+		var values []string
+		if err := db.Select(&values, "select value from kv_cached"); err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+
+	if _, err := db.Exec("insert into kv_cached (key, value) values ('a', '1'), ('b', '2')"); err != nil {
+		t.Fatal(err)
+	}
+	kvCachedStore.reset()
+	assert.Equal(t, []string{"1", "2"}, values())
+	assert.Equal(t, []string{"1", "2"}, values())
+	assert.Equal(t, 1, kvCachedStore.scans, "the second scan should be cached")
+
+	for _, query := range []string{
+		"insert into kv_cached (key, value) values ('c', '3')",
+		"update kv_cached set value = value * 10",
+		"delete from kv_cached where key = 'a'",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+		// the update and delete scan the table themselves, while writing to it
+		kvCachedStore.reset()
+		values()
+		assert.Equal(t, 1, kvCachedStore.scans, "the scan after %q shouldn't be cached", query)
+	}
+	assert.Equal(t, []string{"20", "30"}, values())
+}
@@ -0,0 +1,189 @@
+package vtab
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Metrics is an Observer counting the work of the table-funcs observed by it (see Observe), per module.
+// The counts are queryable through its Module, the vtab_stats table, and exportable with Publish.
+// It's safe for concurrent use, by any number of table-funcs and connections.
+type Metrics struct {
+	mu      sync.Mutex
+	modules map[string]*moduleCounters
+}
+
+// ModuleStats are the counts of a module's work
+type ModuleStats struct {
+	Module string `vtab:"module" json:"-"`
+	// BestIndexCalls is the number of plans chosen
+	BestIndexCalls int64 `vtab:"best_index_calls" json:"best_index_calls"`
+	// ConstraintsOffered and ConstraintsUsed are the number of constraints offered to BestIndex
+	// (other than LIMIT and OFFSET), and the number of those passed to the iterator
+	ConstraintsOffered int64 `vtab:"constraints_offered" json:"constraints_offered"`
+	ConstraintsUsed    int64 `vtab:"constraints_used" json:"constraints_used"`
+	// PushdownRate is ConstraintsUsed as a fraction of ConstraintsOffered, 0 if none were offered
+	PushdownRate float64 `vtab:"pushdown_rate" json:"pushdown_rate"`
+	// OrderBysOffered and OrderBysConsumed are the number of plans with an ORDER BY,
+	// and the number of those that consumed it
+	OrderBysOffered  int64 `vtab:"order_bys_offered" json:"order_bys_offered"`
+	OrderBysConsumed int64 `vtab:"order_bys_consumed" json:"order_bys_consumed"`
+	// FilterCalls is the number of scans
+	FilterCalls int64 `vtab:"filter_calls" json:"filter_calls"`
+	// NextCalls is the number of calls to iterators' Next
+	NextCalls int64 `vtab:"next_calls" json:"next_calls"`
+	// Rows is the number of rows emitted, the rows produced by iterators less those cut by an early exit
+	Rows int64 `vtab:"rows" json:"rows"`
+	// EarlyExits is the number of scans ended early, each cutting a row (see EarlyOrderByConstraintExit)
+	EarlyExits int64 `vtab:"early_exits" json:"early_exits"`
+	// Errors is the number of errors returned by iterators and their rows
+	Errors int64 `vtab:"errors" json:"errors"`
+	// NextTime is the total time spent in iterators' Next, in nanoseconds
+	NextTime int64 `vtab:"next_ns" json:"next_ns"`
+}
+
+type moduleCounters struct {
+	bestIndexCalls, constraintsOffered, constraintsUsed, orderBysOffered, orderBysConsumed int64
+	filterCalls, nextCalls, rows, earlyExits, errors, nextTime                             int64
+}
+
+// NewMetrics returns new Metrics, to be passed to Observe
+func NewMetrics() *Metrics {
+	return &Metrics{modules: make(map[string]*moduleCounters)}
+}
+
+// counters returns the counters of a module, creating them if needed
+func (m *Metrics) counters(module string) *moduleCounters {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters, ok := m.modules[module]
+	if !ok {
+		counters = &moduleCounters{}
+		m.modules[module] = counters
+	}
+	return counters
+}
+
+func (m *Metrics) BestIndex(plan *Plan, err error) {
+	if err != nil {
+		return
+	}
+	counters := m.counters(plan.Table)
+	atomic.AddInt64(&counters.bestIndexCalls, 1)
+	for _, constraint := range plan.Constraints {
+		// LIMIT and OFFSET have no column
+		if constraint.Column == "" {
+			continue
+		}
+		atomic.AddInt64(&counters.constraintsOffered, 1)
+		if constraint.Used {
+			atomic.AddInt64(&counters.constraintsUsed, 1)
+		}
+	}
+	if len(plan.OrderBy) > 0 {
+		atomic.AddInt64(&counters.orderBysOffered, 1)
+		if plan.OrderByConsumed {
+			atomic.AddInt64(&counters.orderBysConsumed, 1)
+		}
+	}
+}
+
+func (m *Metrics) Filter(scan *Scan) ScanObserver {
+	counters := m.counters(scan.Table)
+	atomic.AddInt64(&counters.filterCalls, 1)
+	return counters
+}
+
+func (c *moduleCounters) Next(latency time.Duration, row bool) {
+	atomic.AddInt64(&c.nextCalls, 1)
+	atomic.AddInt64(&c.nextTime, int64(latency))
+	if row {
+		atomic.AddInt64(&c.rows, 1)
+	}
+}
+
+func (c *moduleCounters) EarlyExit() {
+	atomic.AddInt64(&c.earlyExits, 1)
+	atomic.AddInt64(&c.rows, -1)
+}
+
+func (c *moduleCounters) Error(error) { atomic.AddInt64(&c.errors, 1) }
+
+func (c *moduleCounters) Close() {}
+
+// Stats returns the counts of each module observed, ordered by module name
+func (m *Metrics) Stats() []*ModuleStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]*ModuleStats, 0, len(m.modules))
+	for module, c := range m.modules {
+		s := &ModuleStats{
+			Module:             module,
+			BestIndexCalls:     atomic.LoadInt64(&c.bestIndexCalls),
+			ConstraintsOffered: atomic.LoadInt64(&c.constraintsOffered),
+			ConstraintsUsed:    atomic.LoadInt64(&c.constraintsUsed),
+			OrderBysOffered:    atomic.LoadInt64(&c.orderBysOffered),
+			OrderBysConsumed:   atomic.LoadInt64(&c.orderBysConsumed),
+			FilterCalls:        atomic.LoadInt64(&c.filterCalls),
+			NextCalls:          atomic.LoadInt64(&c.nextCalls),
+			Rows:               atomic.LoadInt64(&c.rows),
+			EarlyExits:         atomic.LoadInt64(&c.earlyExits),
+			Errors:             atomic.LoadInt64(&c.errors),
+			NextTime:           atomic.LoadInt64(&c.nextTime),
+		}
+		if s.ConstraintsOffered > 0 {
+			s.PushdownRate = float64(s.ConstraintsUsed) / float64(s.ConstraintsOffered)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Module < stats[b].Module })
+	return stats
+}
+
+// Reset resets the counts of every module
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.modules = make(map[string]*moduleCounters)
+}
+
+var statsCols = []Column{
+	{Name: "module", Type: "TEXT"},
+	{Name: "best_index_calls", Type: "INTEGER"},
+	{Name: "constraints_offered", Type: "INTEGER"},
+	{Name: "constraints_used", Type: "INTEGER"},
+	{Name: "pushdown_rate", Type: "REAL"},
+	{Name: "order_bys_offered", Type: "INTEGER"},
+	{Name: "order_bys_consumed", Type: "INTEGER"},
+	{Name: "filter_calls", Type: "INTEGER"},
+	{Name: "next_calls", Type: "INTEGER"},
+	{Name: "rows", Type: "INTEGER"},
+	{Name: "early_exits", Type: "INTEGER"},
+	{Name: "errors", Type: "INTEGER"},
+	{Name: "next_ns", Type: "INTEGER"},
+}
+
+// Module returns the vtab_stats table of the counts of each module, to be registered as an eponymous-only module:
+//
+//	api.CreateModule("vtab_stats", metrics.Module(), sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+func (m *Metrics) Module() sqlite.Module {
+	return NewSliceTable("vtab_stats", statsCols, m.Stats, StructColumns[*ModuleStats](statsCols))
+}
+
+// Publish exports the counts of each module as the expvar name, a JSON object keyed by module.
+// As with expvar.Publish, it panics if name is already published.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		stats := make(map[string]*ModuleStats)
+		for _, s := range m.Stats() {
+			stats[s.Module] = s
+		}
+		return stats
+	}))
+}
@@ -0,0 +1,102 @@
+package vtab_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+var metrics = vtab.NewMetrics()
+
+// meteredObserver is also told of the metered_services table, as a second observer
+var meteredObserver = &observer{}
+
+func init() {
+	metrics.Publish("vtab_test_metrics")
+
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("metered_services", vtab.NewSliceTable("metered_services", serviceCols, func() []service {
+			return services
+		}, vtab.StructColumns[service](serviceCols), vtab.Observe(metrics), vtab.Observe(meteredObserver)),
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("vtab_stats", metrics.Module(),
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	metrics.Reset()
+	var names []string
+	err = db.Select(&names, "select name from metered_services where port > 1000 and name like '%e%' order by port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"queue", "cache"}, names)
+
+	var stats struct {
+		FilterCalls        int     `db:"filter_calls"`
+		NextCalls          int     `db:"next_calls"`
+		Rows               int     `db:"rows"`
+		ConstraintsOffered int     `db:"constraints_offered"`
+		ConstraintsUsed    int     `db:"constraints_used"`
+		PushdownRate       float64 `db:"pushdown_rate"`
+		OrderBysConsumed   int     `db:"order_bys_consumed"`
+	}
+	err = db.Get(&stats, "select filter_calls, next_calls, rows, constraints_offered, constraints_used, pushdown_rate, order_bys_consumed from vtab_stats where module = 'metered_services'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, stats.FilterCalls)
+	// the services with a port over 1000, and the end of the scan
+	assert.Equal(t, 5, stats.NextCalls)
+	assert.Equal(t, 4, stats.Rows)
+	// LIKE isn't pushed down
+	assert.Greater(t, stats.ConstraintsUsed, 0)
+	assert.Less(t, stats.ConstraintsUsed, stats.ConstraintsOffered)
+	assert.Equal(t, float64(stats.ConstraintsUsed)/float64(stats.ConstraintsOffered), stats.PushdownRate)
+	assert.Equal(t, 1, stats.OrderBysConsumed)
+
+	assert.NotEmpty(t, meteredObserver.plans)
+
+	var published map[string]vtab.ModuleStats
+	if err := json.Unmarshal([]byte(expvar.Get("vtab_test_metrics").String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(4), published["metered_services"].Rows)
+}
+
+func TestMetricsEarlyExit(t *testing.T) {
+	m := vtab.NewMetrics()
+	scan := m.Filter(&vtab.Scan{Table: "t"})
+	scan.Next(0, true)
+	scan.Next(0, true)
+	scan.EarlyExit()
+	scan.Close()
+
+	stats := m.Stats()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, "t", stats[0].Module)
+		assert.Equal(t, int64(1), stats[0].FilterCalls)
+		assert.Equal(t, int64(2), stats[0].NextCalls)
+		assert.Equal(t, int64(1), stats[0].Rows)
+		assert.Equal(t, int64(1), stats[0].EarlyExits)
+	}
+}
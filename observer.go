@@ -0,0 +1,272 @@
+package vtab
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.riyazali.net/sqlite"
+)
+
+// Observe tells the table-func to report the use of its tables and cursors to o. It may be given more than
+// once, to report to several observers, in order.
+func Observe(o Observer) OptFunc {
+	return func(opts *options) {
+		combined := o
+		if opts.observer != nil {
+			combined = observers{opts.observer, o}
+		}
+		opts.observer = combined
+	}
+}
+
+// Observer is told of the plans chosen for a table-func's tables, and of each scan of them. Its methods are
+// called on the goroutine running the query, in the midst of it, and so should return quickly.
+type Observer interface {
+	// BestIndex is called with the plan chosen by each call to BestIndex (whose ID is only set if plans
+	// are recorded, see RecordPlans), or the error it returned instead.
+	BestIndex(plan *Plan, err error)
+	// Filter is called when a cursor starts a scan, returning the observer of the scan, or nil.
+	Filter(scan *Scan) ScanObserver
+}
+
+// Scan is a scan of a table-func's table, as passed to its iterator
+type Scan struct {
+	// Table is the name of the table-func's module
+	Table   string
+	Columns []Column
+	// Constraints are the constraints of the scan, whose Values are only valid during the call to Filter
+	Constraints []*Constraint
+	OrderBy     []*sqlite.OrderBy
+}
+
+// String returns the constraints and order of the scan as SQL, such as port > 1000 ORDER BY port DESC
+func (s *Scan) String() string {
+	name := func(col int) string {
+		if col < 0 || col >= len(s.Columns) {
+			return ""
+		}
+		return s.Columns[col].Name + " "
+	}
+
+	var sb strings.Builder
+	for c, constraint := range s.Constraints {
+		if c > 0 {
+			sb.WriteString(" AND ")
+		}
+		fmt.Fprintf(&sb, "%s%s %s", name(constraint.ColIndex), OpName(constraint.Op), formatValue(constraint.Value))
+	}
+	for o, order := range s.OrderBy {
+		if o == 0 {
+			if sb.Len() > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString("ORDER BY ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(strings.TrimSpace(name(order.ColumnIndex)))
+		if order.Desc {
+			sb.WriteString(" DESC")
+		}
+	}
+	return sb.String()
+}
+
+// formatValue formats a constraint's value as an SQL literal, with long text and blobs shortened
+func formatValue(v *sqlite.Value) string {
+	const max = 64
+	if v == nil {
+		return "?"
+	}
+	switch v.Type() {
+	case sqlite.SQLITE_INTEGER:
+		return strconv.FormatInt(v.Int64(), 10)
+	case sqlite.SQLITE_FLOAT:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case sqlite.SQLITE_TEXT:
+		s := v.Text()
+		if len(s) > max {
+			s = s[:max] + "..."
+		}
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	case sqlite.SQLITE_BLOB:
+		b := v.Blob()
+		if len(b) > max/2 {
+			return fmt.Sprintf("X'%X...'", b[:max/2])
+		}
+		return fmt.Sprintf("X'%X'", b)
+	default:
+		return "NULL"
+	}
+}
+
+// ScanObserver is told of the progress of a scan
+type ScanObserver interface {
+	// Next is called after each call to the iterator's Next, with how long it took, and whether
+	// it produced a row (or ended the scan, or failed)
+	Next(latency time.Duration, row bool)
+	// EarlyExit is called when the scan ends early, before the iterator's end, as later rows can't match
+	// its constraints (see EarlyOrderByConstraintExit)
+	EarlyExit()
+	// Error is called with the errors returned by the iterator and its rows, as reported to SQLite
+	Error(err error)
+	// Close is called when the scan ends, when the cursor is closed or filtered again
+	Close()
+}
+
+// observeBestIndex reports a call to BestIndex to the table's observer
+func (t *tableFuncTable) observeBestIndex(input *sqlite.IndexInfoInput, output *sqlite.IndexInfoOutput, plan *Plan, err error) {
+	if plan == nil {
+		plan = t.newPlan(input, output)
+	}
+	t.options.observer.BestIndex(plan, err)
+}
+
+// observeNext reports a call to the iterator's Next, which started at start, to the scan's observer
+func (c *tableFuncCursor) observeNext(start time.Time, row Row, err error) {
+	if c.scan == nil {
+		return
+	}
+	c.scan.Next(time.Since(start), row != nil && err == nil)
+}
+
+// observeError reports an error of the scan to its observer, returning err
+func (c *tableFuncCursor) observeError(err error) error {
+	if c.scan != nil && err != nil {
+		c.scan.Error(err)
+	}
+	return err
+}
+
+// observers reports to each of several observers
+type observers []Observer
+
+func (o observers) BestIndex(plan *Plan, err error) {
+	for _, observer := range o {
+		observer.BestIndex(plan, err)
+	}
+}
+
+func (o observers) Filter(scan *Scan) ScanObserver {
+	var scans scanObservers
+	for _, observer := range o {
+		if s := observer.Filter(scan); s != nil {
+			scans = append(scans, s)
+		}
+	}
+	if len(scans) == 0 {
+		return nil
+	}
+	return scans
+}
+
+type scanObservers []ScanObserver
+
+func (s scanObservers) Next(latency time.Duration, row bool) {
+	for _, scan := range s {
+		scan.Next(latency, row)
+	}
+}
+
+func (s scanObservers) EarlyExit() {
+	for _, scan := range s {
+		scan.EarlyExit()
+	}
+}
+
+func (s scanObservers) Error(err error) {
+	for _, scan := range s {
+		scan.Error(err)
+	}
+}
+
+func (s scanObservers) Close() {
+	for _, scan := range s {
+		scan.Close()
+	}
+}
+
+// Span is a span of a tracer, such as an OpenTelemetry span, as created by SpanObserver
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// SpanObserver returns an Observer creating a span (with start) of each scan of a table, named
+// vtab.scan <table>, and of each call to BestIndex, named vtab.best_index <table>, so that the time spent
+// in a query can be attributed to the tables it scans. A scan's span has these attributes:
+//
+//	vtab.table        the name of the module
+//	vtab.scan         the scan's constraints and ORDER BY, see Scan.String
+//	vtab.rows         the number of rows produced by the iterator
+//	vtab.next_calls   the number of calls to the iterator's Next
+//	vtab.next_ns      the time spent in the iterator's Next, in nanoseconds
+//	vtab.next_max_ns  the time taken by the slowest call to Next, in nanoseconds
+//	vtab.early_exit   whether the scan ended early
+//
+// A span of BestIndex has the attributes vtab.table, vtab.used (the constraints used, see Plan.Used),
+// vtab.order_by_consumed and vtab.cost.
+func SpanObserver(start func(name string) Span) Observer {
+	return &spanObserver{start}
+}
+
+type spanObserver struct {
+	start func(name string) Span
+}
+
+func (o *spanObserver) BestIndex(plan *Plan, err error) {
+	span := o.start("vtab.best_index " + plan.Table)
+	span.SetAttribute("vtab.table", plan.Table)
+	span.SetAttribute("vtab.used", plan.Used())
+	span.SetAttribute("vtab.order_by_consumed", plan.OrderByConsumed)
+	span.SetAttribute("vtab.cost", plan.Cost)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (o *spanObserver) Filter(scan *Scan) ScanObserver {
+	span := o.start("vtab.scan " + scan.Table)
+	span.SetAttribute("vtab.table", scan.Table)
+	span.SetAttribute("vtab.scan", scan.String())
+	return &scanSpan{span: span}
+}
+
+type scanSpan struct {
+	span             Span
+	rows, nexts      int64
+	next, slowest    time.Duration
+	earlyExit, ended bool
+}
+
+func (s *scanSpan) Next(latency time.Duration, row bool) {
+	s.nexts++
+	if row {
+		s.rows++
+	}
+	s.next += latency
+	if latency > s.slowest {
+		s.slowest = latency
+	}
+}
+
+func (s *scanSpan) EarlyExit() { s.earlyExit = true }
+
+func (s *scanSpan) Error(err error) { s.span.RecordError(err) }
+
+func (s *scanSpan) Close() {
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.span.SetAttribute("vtab.rows", s.rows)
+	s.span.SetAttribute("vtab.next_calls", s.nexts)
+	s.span.SetAttribute("vtab.next_ns", s.next.Nanoseconds())
+	s.span.SetAttribute("vtab.next_max_ns", s.slowest.Nanoseconds())
+	s.span.SetAttribute("vtab.early_exit", s.earlyExit)
+	s.span.End()
+}
@@ -0,0 +1,185 @@
+package vtab_test
+
+import (
+	"iter"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+// testSpan is a span recorded by testTracer
+type testSpan struct {
+	name       string
+	attributes map[string]interface{}
+	errors     []error
+	ended      bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *testSpan) RecordError(err error)                      { s.errors = append(s.errors, err) }
+func (s *testSpan) End()                                       { s.ended = true }
+
+type testTracer struct {
+	sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) start(name string) vtab.Span {
+	t.Lock()
+	defer t.Unlock()
+	span := &testSpan{name: name, attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+// named returns the spans with name
+func (t *testTracer) named(name string) []*testSpan {
+	t.Lock()
+	defer t.Unlock()
+	var spans []*testSpan
+	for _, span := range t.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+var tracer = &testTracer{}
+
+var observedCols = []vtab.Column{
+	{Name: "name", Type: "TEXT"},
+	{Name: "port", Type: "INTEGER", OrderBy: vtab.ASC, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_LT}}},
+	{Name: "replicas", Type: "INTEGER"},
+}
+
+// observedServices yields the services by port, relying on an early exit to end a scan with a port constraint
+var observedServices = vtab.NewTableFunc("observed_services", observedCols, vtab.FromSeq(func(_ []*vtab.Constraint, _ []*sqlite.OrderBy) (iter.Seq[service], error) {
+	byPort := append([]service(nil), services...)
+	sort.Slice(byPort, func(a, b int) bool { return byPort[a].Port < byPort[b].Port })
+	return slices.Values(byPort), nil
+}, vtab.StructColumns[service](observedCols)), vtab.EarlyOrderByConstraintExit(true), vtab.Observe(vtab.SpanObserver(tracer.start)))
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("observed_services", observedServices,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestSpanObserver(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var names []string
+	err = db.Select(&names, "select name from observed_services where port < 6000 order by port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"web", "db", "queue"}, names)
+
+	scans := tracer.named("vtab.scan observed_services")
+	if !assert.Len(t, scans, 1) {
+		return
+	}
+	scan := scans[0]
+	assert.True(t, scan.ended)
+	assert.Equal(t, "port < 6000 ORDER BY port", scan.attributes["vtab.scan"])
+	// the row with port 6379 ends the scan
+	assert.Equal(t, int64(4), scan.attributes["vtab.rows"])
+	assert.Equal(t, int64(4), scan.attributes["vtab.next_calls"])
+	assert.Equal(t, true, scan.attributes["vtab.early_exit"])
+
+	plans := tracer.named("vtab.best_index observed_services")
+	if assert.NotEmpty(t, plans) {
+		assert.Equal(t, "port < ?", plans[len(plans)-1].attributes["vtab.used"])
+	}
+}
+
+// observer records the plans and scans it's told of
+type observer struct {
+	plans []*vtab.Plan
+	errs  []error
+}
+
+func (o *observer) BestIndex(plan *vtab.Plan, err error) {
+	o.plans = append(o.plans, plan)
+	o.errs = append(o.errs, err)
+}
+
+func (o *observer) Filter(*vtab.Scan) vtab.ScanObserver { return nil }
+
+func TestObserveBestIndex(t *testing.T) {
+	o := &observer{}
+	table, err := vtab.NewTableFunc("observed", seriesCols, nil, vtab.Observe(o)).Connect(nil, nil, func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = table.BestIndex(&sqlite.IndexInfoInput{
+		Constraints: []*sqlite.IndexConstraint{
+			{ColumnIndex: 0, Op: sqlite.INDEX_CONSTRAINT_GT, Usable: true},
+			{ColumnIndex: 1, Op: sqlite.INDEX_CONSTRAINT_LIKE, Usable: true},
+		},
+		OrderBy: []*sqlite.OrderBy{{ColumnIndex: 0, Desc: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = table.BestIndex(&sqlite.IndexInfoInput{
+		Constraints: []*sqlite.IndexConstraint{{ColumnIndex: 1, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: false}},
+	})
+	assert.Equal(t, sqlite.SQLITE_CONSTRAINT, err)
+
+	if !assert.Len(t, o.plans, 2) {
+		return
+	}
+	assert.Equal(t, "observed", o.plans[0].Table)
+	assert.Equal(t, "value > ?", o.plans[0].Used())
+	assert.True(t, o.plans[0].OrderByConsumed)
+	assert.Equal(t, []vtab.PlanConstraint{
+		{Column: "value", Op: ">", Usable: true, Used: true},
+		{Column: "start", Op: "LIKE", Usable: true},
+	}, o.plans[0].Constraints)
+	assert.NoError(t, o.errs[0])
+
+	assert.Equal(t, "", o.plans[1].Used())
+	assert.Equal(t, sqlite.SQLITE_CONSTRAINT, o.errs[1])
+}
+
+func TestObserveReused(t *testing.T) {
+	first, second := &observer{}, &observer{}
+	observeSecond := vtab.Observe(second)
+
+	// an Observe reused by a module doesn't bring the observers of the modules it was given to before
+	for _, m := range []sqlite.Module{
+		vtab.NewTableFunc("observed", seriesCols, nil, vtab.Observe(first), observeSecond),
+		vtab.NewTableFunc("reobserved", seriesCols, nil, observeSecond),
+	} {
+		table, err := m.Connect(nil, nil, func(string) error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := table.BestIndex(&sqlite.IndexInfoInput{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if assert.Len(t, first.plans, 1) {
+		assert.Equal(t, "observed", first.plans[0].Table)
+	}
+	assert.Len(t, second.plans, 2)
+}
@@ -0,0 +1,239 @@
+// Package archive provides table-valued functions listing the entries of zip and tar archives:
+//
+//	SELECT name, size, mtime FROM zip_entries('release.zip')
+//	SELECT contents FROM tar_entries('backup.tar.gz') WHERE name = 'etc/hosts'
+//
+// An equality constraint on name reads only the entries of that name, and contents are only read
+// if the query references the contents column. Gzip-compressed tar files are detected automatically.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+var cols = []vtab.Column{
+	{Name: "name", Type: "TEXT", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	{Name: "size", Type: "INTEGER"},
+	{Name: "mode", Type: "TEXT"},
+	{Name: "mtime", Type: "TEXT"},
+	{Name: "is_dir", Type: "INTEGER"},
+	{Name: "contents", Type: "BLOB"},
+	{Name: "path", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+}
+
+// contentsCol is the index of the contents column
+const contentsCol = 5
+
+// args are the arguments and constraints of a query
+type args struct {
+	path string
+	name *string
+}
+
+func parseArgs(constraints []*vtab.Constraint) *args {
+	a := &args{}
+	for _, constraint := range constraints {
+		switch cols[constraint.ColIndex].Name {
+		case "path":
+			a.path = constraint.Value.Text()
+		case "name":
+			name := constraint.Value.Text()
+			a.name = &name
+		}
+	}
+	return a
+}
+
+// entry is the row of a single archive entry
+type entry struct {
+	path     string
+	name     string
+	info     fs.FileInfo
+	contents func() ([]byte, error)
+}
+
+func (e *entry) Column(ctx vtab.Context, c int) error {
+	switch cols[c].Name {
+	case "name":
+		ctx.ResultText(e.name)
+	case "size":
+		ctx.ResultInt64(e.info.Size())
+	case "mode":
+		ctx.ResultText(e.info.Mode().String())
+	case "mtime":
+		ctx.ResultText(e.info.ModTime().UTC().Format(time.RFC3339Nano))
+	case "is_dir":
+		if e.info.IsDir() {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case "contents":
+		if e.contents == nil || e.info.IsDir() {
+			ctx.ResultNull()
+			return nil
+		}
+		b, err := e.contents()
+		if err != nil {
+			return vtab.ColumnError(sqlite.SQLITE_IOERR, "contents", err)
+		}
+		vtab.ResultBlob(ctx, b)
+	case "path":
+		ctx.ResultText(e.path)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// NewZipFunc returns the zip_entries(path) table-valued function
+func NewZipFunc() sqlite.Module {
+	return vtab.NewTableFunc("zip_entries", cols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		a := parseArgs(constraints)
+		r, err := zip.OpenReader(a.path)
+		if err != nil {
+			return nil, vtab.ColumnError(sqlite.SQLITE_CANTOPEN, "path", err)
+		}
+
+		// the central directory is read up front, so an EQ on name only has to find the entry in it
+		files := r.File
+		if a.name != nil {
+			files = nil
+			for _, f := range r.File {
+				if f.Name == *a.name {
+					files = append(files, f)
+				}
+			}
+		}
+
+		return &zipIter{r, a.path, files, -1}, nil
+	})
+}
+
+type zipIter struct {
+	reader  *zip.ReadCloser
+	path    string
+	files   []*zip.File
+	current int
+}
+
+func (i *zipIter) Next() (vtab.Row, error) {
+	i.current++
+	if i.current >= len(i.files) {
+		return nil, io.EOF
+	}
+
+	f := i.files[i.current]
+	return &entry{i.path, f.Name, f.FileInfo(), func() ([]byte, error) {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}}, nil
+}
+
+func (i *zipIter) Close() error {
+	return i.reader.Close()
+}
+
+// NewTarFunc returns the tar_entries(path) table-valued function
+func NewTarFunc() sqlite.Module {
+	return vtab.NewTableFunc("tar_entries", cols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		a := parseArgs(constraints)
+		f, err := os.Open(a.path)
+		if err != nil {
+			return nil, vtab.ColumnError(sqlite.SQLITE_CANTOPEN, "path", err)
+		}
+
+		r, err := decompress(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		return &tarIter{file: f, reader: tar.NewReader(r), args: a, readContents: true}, nil
+	})
+}
+
+// decompress wraps r in a gzip reader, if it's gzip compressed
+func decompress(r io.Reader) (io.Reader, error) {
+	buf := bufio.NewReader(r)
+	magic, err := buf.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(buf)
+	}
+	return buf, nil
+}
+
+type tarIter struct {
+	file         *os.File
+	reader       *tar.Reader
+	args         *args
+	readContents bool
+}
+
+// ColumnsUsed implements vtab.ColumnsUsedIterator, as a tar file is a stream the contents of an entry
+// have to be read when it's reached, which is skipped if the query doesn't reference them
+func (i *tarIter) ColumnsUsed(used vtab.ColumnSet) {
+	i.readContents = used.Has(contentsCol)
+}
+
+func (i *tarIter) Next() (vtab.Row, error) {
+	for {
+		hdr, err := i.reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		// an archive can hold several entries of the same name, so the whole of it is scanned for them
+		if i.args.name != nil && hdr.Name != *i.args.name {
+			continue
+		}
+
+		e := &entry{i.args.path, hdr.Name, hdr.FileInfo(), nil}
+		if i.readContents {
+			b, err := io.ReadAll(i.reader)
+			e.contents = func() ([]byte, error) { return b, err }
+		}
+		return e, nil
+	}
+}
+
+func (i *tarIter) Close() error {
+	return i.file.Close()
+}
+
+// Modules returns the zip_entries and tar_entries table-valued functions, as created by Register
+func Modules() []*vtab.ModuleInfo {
+	return []*vtab.ModuleInfo{
+		{Name: "zip_entries", Module: NewZipFunc(), EponymousOnly: true, ReadOnly: true},
+		{Name: "tar_entries", Module: NewTarFunc(), EponymousOnly: true, ReadOnly: true},
+	}
+}
+
+func init() {
+	for _, info := range Modules() {
+		vtab.DefaultRegistry.Add(info)
+	}
+}
+
+// Register registers the zip_entries and tar_entries table-valued functions with api. They're also added to
+// vtab.DefaultRegistry.
+func Register(api *sqlite.ExtensionApi) error {
+	return vtab.CreateModules(api, Modules())
+}
@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := Register(api); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+var files = []struct{ name, contents string }{
+	{"README.md", "# hello"},
+	{"src/main.go", "package main"},
+	{"src/util.go", "package util"},
+}
+
+func writeZip(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, file := range files {
+		fw, err := w.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(file.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeTarGz(t *testing.T) string {
+	return writeTarGzFiles(t, files)
+}
+
+func writeTarGzFiles(t *testing.T, files []struct{ name, contents string }) string {
+	path := filepath.Join(t.TempDir(), "test.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	w := tar.NewWriter(gz)
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.contents))}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(file.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestZipEntries(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	path := writeZip(t)
+
+	var names []string
+	err = db.Select(&names, "select name from zip_entries(?) order by name", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"README.md", "src/main.go", "src/util.go"}, names)
+
+	var contents []string
+	err = db.Select(&contents, "select contents from zip_entries(?) where name = 'src/util.go'", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"package util"}, contents)
+}
+
+func TestTarEntries(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	path := writeTarGz(t)
+
+	var sizes []int
+	err = db.Select(&sizes, "select size from tar_entries(?)", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{7, 12, 12}, sizes)
+
+	var contents []string
+	err = db.Select(&contents, "select contents || '!' from tar_entries(?) where name = 'src/main.go'", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"package main!"}, contents)
+}
+
+func TestTarEntriesDuplicateNames(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// a later entry of a name, as appended by tar -r, is listed along with the first
+	path := writeTarGzFiles(t, append(files[:len(files):len(files)], struct{ name, contents string }{"src/main.go", "package main // v2"}))
+
+	var contents []string
+	err = db.Select(&contents, "select contents from tar_entries(?) where name = 'src/main.go'", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"package main", "package main // v2"}, contents)
+
+	var types []string
+	err = db.Select(&types, "select typeof(contents) from tar_entries(?) where name = 'README.md'", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"blob"}, types)
+}
+
+func TestTarContentsOnlyReadWhenUsed(t *testing.T) {
+	path := writeTarGz(t)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iter := &tarIter{file: f, reader: tar.NewReader(r), args: &args{path: path}, readContents: true}
+	iter.ColumnsUsed(1 << 0)
+
+	row, err := iter.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, row.(*entry).contents)
+}
@@ -0,0 +1,161 @@
+// Package boltkv adapts a bucket of a bbolt database to a vtab.KVStore, so that it can be queried
+// (and changed) as a table with vtab.NewKVTable:
+//
+//	db, _ := bbolt.Open("app.db", 0o600, nil)
+//	api.CreateModule("settings", vtab.NewKVTable("settings", boltkv.New(db, []byte("settings"))), sqlite.EponymousOnly(true))
+//
+//	SELECT value FROM settings WHERE key = 'theme'
+//	UPDATE settings SET value = 'dark' WHERE key = 'theme'
+package boltkv
+
+import (
+	"bytes"
+	"iter"
+
+	"github.com/augmentable-dev/vtab"
+	"go.etcd.io/bbolt"
+)
+
+// batch is the number of entries read by each read transaction of a scan
+const batch = 256
+
+// Store is a vtab.KVStore over a single bucket of a bbolt database
+type Store struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+var _ vtab.KVStore = (*Store)(nil)
+
+// New returns the Store of bucket in db. The bucket is created on the first Put, and reads as empty until then.
+func New(db *bbolt.DB, bucket []byte) *Store {
+	return &Store{db, bucket}
+}
+
+func (s *Store) Get(key []byte) (value []byte, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(s.bucket); b != nil {
+			// values are only valid for the life of the transaction
+			if v := b.Get(key); v != nil {
+				value = append([]byte{}, v...)
+			}
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Scan reads the entries of a range in batches, each in its own read transaction, so that no transaction
+// is held open between entries (while the table may be written to). Each batch reflects the bucket as of its read.
+func (s *Store) Scan(r vtab.KVRange) iter.Seq2[vtab.KV, error] {
+	return func(yield func(vtab.KV, error) bool) {
+		from, first := r.Start, true
+		for {
+			var entries []vtab.KV
+			err := s.db.View(func(tx *bbolt.Tx) error {
+				b := tx.Bucket(s.bucket)
+				if b == nil {
+					return nil
+				}
+				c := b.Cursor()
+				k, v := seek(c, r, from)
+				// later batches start after the last key of the previous one
+				if !first && k != nil && bytes.Equal(k, from) {
+					k, v = step(c, r)
+				}
+				for ; k != nil && bytes.HasPrefix(k, r.Prefix) && len(entries) < batch; k, v = step(c, r) {
+					entries = append(entries, vtab.KV{Key: append([]byte{}, k...), Value: append([]byte{}, v...)})
+				}
+				return nil
+			})
+			if err != nil {
+				yield(vtab.KV{}, err)
+				return
+			}
+
+			for _, entry := range entries {
+				if !yield(entry, nil) {
+					return
+				}
+			}
+			if len(entries) < batch {
+				return
+			}
+			from, first = entries[len(entries)-1].Key, false
+		}
+	}
+}
+
+// seek positions c at the first key of a scan of r from the key from (inclusive), or from the start of r if nil
+func seek(c *bbolt.Cursor, r vtab.KVRange, from []byte) ([]byte, []byte) {
+	if !r.Reverse {
+		start := from
+		if start == nil || bytes.Compare(start, r.Prefix) < 0 {
+			start = r.Prefix
+		}
+		return c.Seek(start)
+	}
+
+	// in reverse, seek to the first key after from (or after every key with the prefix), and step back
+	if end := prefixEnd(r.Prefix); from != nil && end != nil && bytes.Compare(from, end) >= 0 {
+		from = nil
+	}
+	var k, v []byte
+	switch {
+	case from != nil:
+		k, v = c.Seek(from)
+		if k != nil && bytes.Equal(k, from) {
+			return k, v
+		}
+	case len(r.Prefix) > 0:
+		if end := prefixEnd(r.Prefix); end != nil {
+			k, v = c.Seek(end)
+		}
+	}
+	if k == nil {
+		return c.Last()
+	}
+	return c.Prev()
+}
+
+func step(c *bbolt.Cursor, r vtab.KVRange) ([]byte, []byte) {
+	if r.Reverse {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// prefixEnd returns the smallest key greater than every key with prefix, or nil if there's none
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func (s *Store) Put(key, value []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.bucket)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			value = []byte{}
+		}
+		return b.Put(key, value)
+	})
+}
+
+func (s *Store) Delete(key []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete(key)
+	})
+}
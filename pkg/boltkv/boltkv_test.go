@@ -0,0 +1,111 @@
+package boltkv
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+)
+
+func newStore(t *testing.T) *Store {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "test.db"), 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, []byte("test"))
+}
+
+func keys(t *testing.T, s *Store, r vtab.KVRange) []string {
+	var keys []string
+	for entry, err := range s.Scan(r) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(entry.Key))
+	}
+	return keys
+}
+
+func TestGetPutDelete(t *testing.T) {
+	s := newStore(t)
+
+	// the bucket doesn't exist yet
+	v, err := s.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+	assert.NoError(t, s.Delete([]byte("a")))
+	assert.Empty(t, keys(t, s, vtab.KVRange{}))
+
+	assert.NoError(t, s.Put([]byte("a"), []byte("1")))
+	assert.NoError(t, s.Put([]byte("b"), nil))
+
+	v, err = s.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), v)
+
+	// an empty value is still present
+	v, err = s.Get([]byte("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{}, v)
+
+	assert.NoError(t, s.Delete([]byte("a")))
+	v, err = s.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestScan(t *testing.T) {
+	s := newStore(t)
+	for _, k := range []string{"a", "b1", "b2", "b3", "c"} {
+		assert.NoError(t, s.Put([]byte(k), []byte(k)))
+	}
+
+	for _, test := range []struct {
+		r    vtab.KVRange
+		want []string
+	}{
+		{vtab.KVRange{}, []string{"a", "b1", "b2", "b3", "c"}},
+		{vtab.KVRange{Reverse: true}, []string{"c", "b3", "b2", "b1", "a"}},
+		{vtab.KVRange{Start: []byte("b2")}, []string{"b2", "b3", "c"}},
+		{vtab.KVRange{Start: []byte("b25"), Reverse: true}, []string{"b2", "b1", "a"}},
+		{vtab.KVRange{Prefix: []byte("b")}, []string{"b1", "b2", "b3"}},
+		{vtab.KVRange{Prefix: []byte("b"), Reverse: true}, []string{"b3", "b2", "b1"}},
+		{vtab.KVRange{Prefix: []byte("b"), Start: []byte("a")}, []string{"b1", "b2", "b3"}},
+		{vtab.KVRange{Prefix: []byte("b"), Start: []byte("z"), Reverse: true}, []string{"b3", "b2", "b1"}},
+		{vtab.KVRange{Prefix: []byte("b"), Start: []byte("b2"), Reverse: true}, []string{"b2", "b1"}},
+		{vtab.KVRange{Prefix: []byte("d")}, nil},
+	} {
+		assert.Equal(t, test.want, keys(t, s, test.r), "%+v", test.r)
+	}
+}
+
+func TestScanBatches(t *testing.T) {
+	s := newStore(t)
+	var want []string
+	for i := 0; i < batch*2+10; i++ {
+		k := fmt.Sprintf("k%04d", i)
+		want = append(want, k)
+		assert.NoError(t, s.Put([]byte(k), []byte(k)))
+	}
+
+	assert.Equal(t, want, keys(t, s, vtab.KVRange{}))
+
+	reversed := make([]string, len(want))
+	for i, k := range want {
+		reversed[len(want)-1-i] = k
+	}
+	assert.Equal(t, reversed, keys(t, s, vtab.KVRange{Reverse: true}))
+
+	// the table may be written to between entries of a scan
+	n := 0
+	for entry, err := range s.Scan(vtab.KVRange{}) {
+		assert.NoError(t, err)
+		assert.NoError(t, s.Put(entry.Key, []byte("updated")))
+		n++
+	}
+	assert.Equal(t, len(want), n)
+}
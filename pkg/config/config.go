@@ -0,0 +1,302 @@
+// Package config provides table functions over the environment and common configuration file formats,
+// for comparing and debugging configuration:
+//
+//	SELECT value FROM env() WHERE name = 'HOME'
+//	SELECT section, key, value FROM ini_entries('/etc/php.ini') WHERE section = 'Session'
+//	SELECT path, value FROM yaml_tree('deploy.yaml') WHERE path LIKE '$.spec.template.%' AND type != 'object'
+//	SELECT path, value FROM toml_tree('Cargo.toml') WHERE path = '$.package.version'
+//
+// yaml_tree and toml_tree flatten a document into a row for each of its nodes, like SQLite's json_tree, with
+// the columns path (the full path of the node, such as $.servers[0].host), key (the object key or array index
+// of the node), value (the value of a scalar, or the JSON of an array or object) and type (one of null, true,
+// false, integer, real, text, array and object). Nodes are listed in document order. Constraints on path
+// (=, or LIKE and GLOB with a literal prefix) skip the parts of the document that can't match.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// tree is a node of a parsed document, in a form common to every format
+type tree struct {
+	// typ is one of the json_tree types, null, true, false, integer, real, text, array or object
+	typ string
+	// value is the value of a scalar, an int64, float64 or string (or nil)
+	value interface{}
+	// keys are the keys of an object's members, in document order
+	keys     []string
+	children []*tree
+}
+
+// writeJSON writes the JSON of t, with objects' members in document order
+func (t *tree) writeJSON(b *strings.Builder) {
+	switch t.typ {
+	case "array", "object":
+		open, close := "[", "]"
+		if t.typ == "object" {
+			open, close = "{", "}"
+		}
+		b.WriteString(open)
+		for c, child := range t.children {
+			if c > 0 {
+				b.WriteString(",")
+			}
+			if t.typ == "object" {
+				k, _ := json.Marshal(t.keys[c])
+				b.Write(k)
+				b.WriteString(":")
+			}
+			child.writeJSON(b)
+		}
+		b.WriteString(close)
+	case "true", "false", "null":
+		b.WriteString(t.typ)
+	default:
+		v, err := json.Marshal(t.value)
+		if err != nil {
+			// non-finite floats aren't valid JSON
+			v, _ = json.Marshal(fmt.Sprint(t.value))
+		}
+		b.Write(v)
+	}
+}
+
+// scalar returns the tree of a scalar value, as decoded by a format's parser
+func scalar(v interface{}) *tree {
+	switch v := v.(type) {
+	case nil:
+		return &tree{typ: "null"}
+	case bool:
+		if v {
+			return &tree{typ: "true", value: int64(1)}
+		}
+		return &tree{typ: "false", value: int64(0)}
+	case int:
+		return &tree{typ: "integer", value: int64(v)}
+	case int64:
+		return &tree{typ: "integer", value: v}
+	case uint64:
+		if v > math.MaxInt64 {
+			// past the integers of SQLite
+			return &tree{typ: "real", value: float64(v)}
+		}
+		return &tree{typ: "integer", value: int64(v)}
+	case float64:
+		return &tree{typ: "real", value: v}
+	case string:
+		return &tree{typ: "text", value: v}
+	case fmt.Stringer:
+		return &tree{typ: "text", value: v.String()}
+	default:
+		return &tree{typ: "text", value: fmt.Sprint(v)}
+	}
+}
+
+// keyEscaper escapes a key quoted in a path
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// memberPath returns the path of the member key of the object at path
+func memberPath(path, key string) string {
+	plain := key != ""
+	for _, r := range key {
+		if !(r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return path + "." + key
+	}
+	return path + `."` + keyEscaper.Replace(key) + `"`
+}
+
+// prefixes are the constraints on path, used to skip the subtrees that can't contain a matching path
+type prefixes []struct {
+	prefix string
+	fold   bool
+}
+
+func (p *prefixes) add(op sqlite.ConstraintOp, v string) {
+	fold := false
+	switch op {
+	case sqlite.INDEX_CONSTRAINT_GLOB:
+		if end := strings.IndexAny(v, "*?["); end >= 0 {
+			v = v[:end]
+		}
+	case sqlite.INDEX_CONSTRAINT_LIKE:
+		// LIKE is case-insensitive (for ASCII) so its prefix is compared case-insensitively
+		if end := strings.IndexAny(v, "%_"); end >= 0 {
+			v = v[:end]
+		}
+		v, fold = strings.ToLower(v), true
+	}
+	*p = append(*p, struct {
+		prefix string
+		fold   bool
+	}{v, fold})
+}
+
+// match reports whether the subtree at path may contain a path matching every prefix,
+// as it's either under the prefix or on the way to it
+func (p prefixes) match(path string) bool {
+	for _, prefix := range p {
+		path := path
+		if prefix.fold {
+			path = strings.ToLower(path)
+		}
+		if !strings.HasPrefix(path, prefix.prefix) && !strings.HasPrefix(prefix.prefix, path) {
+			return false
+		}
+	}
+	return true
+}
+
+// node is a row of a tree table
+type node struct {
+	path string
+	// key is the string key or int index of the node in its parent, or nil for the root
+	key  interface{}
+	tree *tree
+}
+
+var pathFilters = []*vtab.ColumnFilter{
+	{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_LIKE}, {Op: sqlite.INDEX_CONSTRAINT_GLOB},
+}
+
+var treeCols = []vtab.Column{
+	{Name: "path", Type: "TEXT", Filters: pathFilters},
+	{Name: "key", Type: ""},
+	{Name: "value", Type: ""},
+	{Name: "type", Type: "TEXT"},
+	{Name: "file", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+}
+
+// newTreeModule returns a tree table function (such as yaml_tree) of the documents parsed with parse
+func newTreeModule(name string, parse func(path string) (*tree, error)) sqlite.Module {
+	return vtab.NewTableFunc(name, treeCols, func(constraints []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+		var file string
+		var p prefixes
+		for _, constraint := range constraints {
+			switch treeCols[constraint.ColIndex].Name {
+			case "file":
+				file = constraint.Value.Text()
+			case "path":
+				p.add(constraint.Op, constraint.Value.Text())
+			}
+		}
+		if file == "" {
+			return nil, vtab.ColumnError(sqlite.SQLITE_ERROR, "file", fmt.Errorf("a file is required"))
+		}
+
+		t, err := parse(file)
+		if err != nil {
+			return nil, err
+		}
+		return &treeIter{file: file, prefixes: p, stack: []*node{{path: "$", tree: t}}}, nil
+	})
+}
+
+// treeIter walks a tree depth-first, in document order
+type treeIter struct {
+	file     string
+	prefixes prefixes
+	stack    []*node
+	current  *node
+}
+
+func (i *treeIter) Next() (vtab.Row, error) {
+	for len(i.stack) > 0 {
+		n := i.stack[len(i.stack)-1]
+		i.stack = i.stack[:len(i.stack)-1]
+		if !i.prefixes.match(n.path) {
+			continue
+		}
+
+		// push children in reverse, so that they're popped in order
+		for c := len(n.tree.children) - 1; c >= 0; c-- {
+			child := &node{tree: n.tree.children[c]}
+			if n.tree.typ == "object" {
+				child.key = n.tree.keys[c]
+				child.path = memberPath(n.path, n.tree.keys[c])
+			} else {
+				child.key = c
+				child.path = fmt.Sprintf("%s[%d]", n.path, c)
+			}
+			i.stack = append(i.stack, child)
+		}
+
+		i.current = n
+		return i, nil
+	}
+	return nil, io.EOF
+}
+
+func (i *treeIter) Column(ctx vtab.Context, c int) error {
+	n := i.current
+	switch treeCols[c].Name {
+	case "path":
+		ctx.ResultText(n.path)
+	case "key":
+		switch k := n.key.(type) {
+		case string:
+			ctx.ResultText(k)
+		case int:
+			ctx.ResultInt(k)
+		default:
+			ctx.ResultNull()
+		}
+	case "value":
+		switch v := n.tree.value.(type) {
+		case int64:
+			ctx.ResultInt64(v)
+		case float64:
+			ctx.ResultFloat(v)
+		case string:
+			ctx.ResultText(v)
+		default:
+			if n.tree.typ == "array" || n.tree.typ == "object" {
+				var b strings.Builder
+				n.tree.writeJSON(&b)
+				ctx.ResultText(b.String())
+			} else {
+				ctx.ResultNull()
+			}
+		}
+	case "type":
+		ctx.ResultText(n.tree.typ)
+	case "file":
+		ctx.ResultText(i.file)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// Modules returns the env, ini_entries, yaml_tree and toml_tree table functions, as created by Register
+func Modules() []*vtab.ModuleInfo {
+	return []*vtab.ModuleInfo{
+		{Name: "env", Module: NewEnvModule(), EponymousOnly: true, ReadOnly: true},
+		{Name: "ini_entries", Module: NewINIModule(), EponymousOnly: true, ReadOnly: true},
+		{Name: "yaml_tree", Module: NewYAMLModule(), EponymousOnly: true, ReadOnly: true},
+		{Name: "toml_tree", Module: NewTOMLModule(), EponymousOnly: true, ReadOnly: true},
+	}
+}
+
+func init() {
+	for _, info := range Modules() {
+		vtab.DefaultRegistry.Add(info)
+	}
+}
+
+// Register registers the env, ini_entries, yaml_tree and toml_tree table functions with api. They're also added to
+// vtab.DefaultRegistry.
+func Register(api *sqlite.ExtensionApi) error {
+	return vtab.CreateModules(api, Modules())
+}
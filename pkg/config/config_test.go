@@ -0,0 +1,291 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := Register(api); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func newDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func writeFile(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type treeRow struct {
+	Path  string         `db:"path"`
+	Key   sql.NullString `db:"key"`
+	Value sql.NullString `db:"value"`
+	Type  string         `db:"type"`
+}
+
+func TestEnv(t *testing.T) {
+	db := newDB(t)
+	t.Setenv("VTAB_TEST_VAR", "a=b")
+
+	var value string
+	if err := db.Get(&value, "select value from env() where name = 'VTAB_TEST_VAR'"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "a=b", value)
+
+	var count int
+	if err := db.Get(&count, "select count(*) from env() where name = 'VTAB_TEST_MISSING'"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+
+	if err := db.Get(&count, "select count(*) from env() where name like 'VTAB_TEST_%'"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count)
+
+	// variables are ordered by their names, not by NAME=VALUE
+	for _, name := range []string{"VTAB_ORDER1", "VTAB_ORDER-B", "VTAB_ORDER"} {
+		t.Setenv(name, "x")
+	}
+	var names []string
+	if err := db.Select(&names, "select name from env() where name like 'VTAB_ORDER%' order by name"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"VTAB_ORDER", "VTAB_ORDER-B", "VTAB_ORDER1"}, names)
+}
+
+const ini = `; global settings
+name = example
+
+[server]
+host = "0.0.0.0"
+port: 8080 ; the port
+debug
+
+[database]
+url = 'postgres://localhost/db'
+`
+
+func TestINI(t *testing.T) {
+	db := newDB(t)
+	path := writeFile(t, "app.ini", ini)
+
+	var entries []struct {
+		Path    string         `db:"path"`
+		Section sql.NullString `db:"section"`
+		Key     string         `db:"key"`
+		Value   sql.NullString `db:"value"`
+		Type    string         `db:"type"`
+		Line    int            `db:"line"`
+	}
+	if err := db.Select(&entries, "select path, section, key, value, type, line from ini_entries($1)", path); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, entries, 5) {
+		assert.Equal(t, "name", entries[0].Path)
+		assert.False(t, entries[0].Section.Valid)
+		assert.Equal(t, "server.host", entries[1].Path)
+		assert.Equal(t, "0.0.0.0", entries[1].Value.String)
+		assert.Equal(t, "8080", entries[2].Value.String)
+		assert.Equal(t, 6, entries[2].Line)
+		assert.Equal(t, "text", entries[2].Type)
+		assert.Equal(t, "debug", entries[3].Key)
+		assert.False(t, entries[3].Value.Valid)
+		assert.Equal(t, "null", entries[3].Type)
+		assert.Equal(t, "postgres://localhost/db", entries[4].Value.String)
+	}
+
+	var keys []string
+	if err := db.Select(&keys, "select key from ini_entries($1) where section = 'server'", path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"host", "port", "debug"}, keys)
+
+	var values []string
+	if err := db.Select(&values, "select value from ini_entries($1) where path like 'Server.%' and path glob '*o*'", path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"0.0.0.0", "8080"}, values)
+
+	values = nil
+	if err := db.Select(&values, "select value from ini_entries($1) where path = 'database.url'", path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"postgres://localhost/db"}, values)
+}
+
+const yml = `
+name: app
+replicas: 3
+ratio: 0.5
+enabled: true
+empty: null
+created: 2021-01-02
+defaults: &defaults
+  image: app:latest
+servers:
+  - host: a.example.com
+    ports: [80, 443]
+  - <<: *defaults
+    host: "b.example.com"
+"odd key": x
+`
+
+func TestYAML(t *testing.T) {
+	db := newDB(t)
+	path := writeFile(t, "app.yaml", yml)
+
+	var rows []treeRow
+	if err := db.Select(&rows, "select path, key, value, type from yaml_tree($1)", path); err != nil {
+		t.Fatal(err)
+	}
+
+	byPath := make(map[string]treeRow)
+	var paths []string
+	for _, row := range rows {
+		byPath[row.Path] = row
+		paths = append(paths, row.Path)
+	}
+
+	assert.Equal(t, []string{
+		"$", "$.name", "$.replicas", "$.ratio", "$.enabled", "$.empty", "$.created", "$.defaults", "$.defaults.image",
+		"$.servers", "$.servers[0]", "$.servers[0].host", "$.servers[0].ports", "$.servers[0].ports[0]", "$.servers[0].ports[1]",
+		"$.servers[1]", `$.servers[1]."<<"`, `$.servers[1]."<<".image`, "$.servers[1].host", `$."odd key"`,
+	}, paths)
+	assert.Equal(t, treeRow{"$.replicas", sql.NullString{String: "replicas", Valid: true}, sql.NullString{String: "3", Valid: true}, "integer"}, byPath["$.replicas"])
+	assert.Equal(t, "real", byPath["$.ratio"].Type)
+	assert.Equal(t, "true", byPath["$.enabled"].Type)
+	assert.Equal(t, "null", byPath["$.empty"].Type)
+	assert.Equal(t, "2021-01-02", byPath["$.created"].Value.String)
+	assert.Equal(t, "1", byPath["$.servers[0].ports[1]"].Key.String)
+	assert.Equal(t, `[80,443]`, byPath["$.servers[0].ports"].Value.String)
+	assert.Equal(t, "app:latest", byPath[`$.servers[1]."<<".image`].Value.String)
+
+	var values []string
+	if err := db.Select(&values, "select value from yaml_tree($1) where path like '$.servers[0].ports[%' ", path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"80", "443"}, values)
+}
+
+func TestYAMLAliasExpansion(t *testing.T) {
+	// each level doubles the nodes of the one before, so the document would expand to 2^40 nodes
+	var b strings.Builder
+	b.WriteString("l0: &l0 [x, x]\n")
+	for l := 1; l <= 40; l++ {
+		fmt.Fprintf(&b, "l%d: &l%d [*l%d, *l%d]\n", l, l, l-1, l-1)
+	}
+	path := writeFile(t, "laughs.yaml", b.String())
+
+	_, err := parseYAML(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "the document expands to more than")
+	}
+}
+
+const tml = `
+title = "example"
+
+[owner]
+name = "someone"
+dob = 1979-05-27T07:32:00-08:00
+birthday = 1979-05-27
+
+[[products]]
+name = "hammer"
+sku = 738594937
+
+[[products]]
+name = "nail"
+price = 0.05
+`
+
+func TestTOML(t *testing.T) {
+	db := newDB(t)
+	path := writeFile(t, "app.toml", tml)
+
+	var rows []treeRow
+	if err := db.Select(&rows, "select path, key, value, type from toml_tree($1)", path); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, row := range rows {
+		paths = append(paths, row.Path)
+	}
+	assert.Equal(t, []string{
+		"$", "$.title", "$.owner", "$.owner.name", "$.owner.dob", "$.owner.birthday",
+		"$.products", "$.products[0]", "$.products[0].name", "$.products[0].sku",
+		"$.products[1]", "$.products[1].name", "$.products[1].price",
+	}, paths)
+
+	var value string
+	if err := db.Get(&value, "select value from toml_tree($1) where path = '$.owner.dob'", path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1979-05-27T07:32:00-08:00", value)
+
+	if err := db.Get(&value, "select value from toml_tree($1) where path = '$.owner.birthday'", path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1979-05-27", value)
+}
+
+func TestPrefixes(t *testing.T) {
+	var p prefixes
+	p.add(sqlite.INDEX_CONSTRAINT_EQ, "$.servers[0].host")
+	assert.True(t, p.match("$"))
+	assert.True(t, p.match("$.servers"))
+	assert.True(t, p.match("$.servers[0].host"))
+	assert.False(t, p.match("$.servers[1]"))
+	assert.False(t, p.match("$.name"))
+
+	p = nil
+	p.add(sqlite.INDEX_CONSTRAINT_LIKE, "$.Servers%")
+	assert.True(t, p.match("$.servers[1].host"))
+	// [ starts a character class in GLOB, so the prefix ends before it
+	p.add(sqlite.INDEX_CONSTRAINT_GLOB, "$.servers[[]1]*")
+	assert.True(t, p.match("$.servers[0].host"))
+	p.add(sqlite.INDEX_CONSTRAINT_GLOB, "$.name*")
+	assert.False(t, p.match("$.servers[1].host"))
+}
+
+func TestScalar(t *testing.T) {
+	assert.Equal(t, &tree{typ: "integer", value: int64(42)}, scalar(uint64(42)))
+	// integers past those of SQLite are reals, rather than wrapping around
+	assert.Equal(t, &tree{typ: "real", value: float64(1 << 63)}, scalar(uint64(1<<63)))
+}
+
+func TestMemberPath(t *testing.T) {
+	assert.Equal(t, "$.servers", memberPath("$", "servers"))
+	assert.Equal(t, `$."a b"`, memberPath("$", "a b"))
+	assert.Equal(t, `$."say \"hi\""`, memberPath("$", `say "hi"`))
+	assert.Equal(t, `$."a\\b"`, memberPath("$", `a\b`))
+}
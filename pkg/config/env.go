@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+var envCols = []vtab.Column{
+	{Name: "name", Type: "TEXT", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}, OrderBy: vtab.ASC},
+	{Name: "value", Type: "TEXT"},
+}
+
+// NewEnvModule returns the env table function, of the environment variables of the process, ordered by name.
+// An = constraint on name looks up the single variable.
+func NewEnvModule() sqlite.Module {
+	return vtab.NewTableFunc("env", envCols, func(constraints []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+		for _, constraint := range constraints {
+			if constraint.ColIndex == 0 {
+				name := constraint.Value.Text()
+				if value, ok := os.LookupEnv(name); ok {
+					return &envIter{vars: []string{name + "=" + value}, current: -1}, nil
+				}
+				return &envIter{current: -1}, nil
+			}
+		}
+
+		// vars are ordered by name, as NAME=VALUE would order A1=x before A=x
+		vars := os.Environ()
+		sort.SliceStable(vars, func(a, b int) bool { return envName(vars[a]) < envName(vars[b]) })
+		return &envIter{vars: vars, current: -1}, nil
+	})
+}
+
+// envName returns the name of an environment variable NAME=VALUE
+func envName(v string) string {
+	name, _, _ := strings.Cut(v, "=")
+	return name
+}
+
+type envIter struct {
+	vars    []string
+	current int
+}
+
+func (i *envIter) Next() (vtab.Row, error) {
+	i.current++
+	if i.current >= len(i.vars) {
+		return nil, io.EOF
+	}
+	return i, nil
+}
+
+func (i *envIter) Column(ctx vtab.Context, c int) error {
+	name, value, _ := strings.Cut(i.vars[i.current], "=")
+	switch envCols[c].Name {
+	case "name":
+		ctx.ResultText(name)
+	case "value":
+		ctx.ResultText(value)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
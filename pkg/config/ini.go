@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+var iniCols = []vtab.Column{
+	{Name: "path", Type: "TEXT", Filters: pathFilters},
+	{Name: "section", Type: "TEXT", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	{Name: "key", Type: "TEXT"},
+	{Name: "value", Type: "TEXT"},
+	{Name: "type", Type: "TEXT"},
+	{Name: "line", Type: "INTEGER"},
+	{Name: "file", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+}
+
+// NewINIModule returns the ini_entries table function, of the key = value (or key: value) entries of an INI
+// file, with the path section.key (or just key, before the first section). Comments start with ; or #,
+// and quoted values are unquoted. A key without a value has a NULL value, of type null, and other values
+// are of type text. An = constraint on section skips the entries of other sections without parsing them,
+// as do constraints on path (=, or LIKE and GLOB with a literal prefix) for the entries of other paths.
+func NewINIModule() sqlite.Module {
+	return vtab.NewTableFunc("ini_entries", iniCols, func(constraints []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+		it := &iniIter{}
+		for _, constraint := range constraints {
+			switch iniCols[constraint.ColIndex].Name {
+			case "file":
+				it.file = constraint.Value.Text()
+			case "section":
+				section := constraint.Value.Text()
+				it.only = &section
+			case "path":
+				it.prefixes.add(constraint.Op, constraint.Value.Text())
+			}
+		}
+		if it.file == "" {
+			return nil, vtab.ColumnError(sqlite.SQLITE_ERROR, "file", fmt.Errorf("a file is required"))
+		}
+
+		f, err := os.Open(it.file)
+		if err != nil {
+			return nil, err
+		}
+		it.reader = f
+		it.scanner = bufio.NewScanner(f)
+		return it, nil
+	})
+}
+
+type iniIter struct {
+	file    string
+	reader  io.ReadCloser
+	scanner *bufio.Scanner
+	// only is the section to report the entries of, from an = constraint
+	only *string
+	// prefixes are the constraints on path
+	prefixes prefixes
+
+	line     int
+	section  string
+	key      string
+	value    string
+	hasValue bool
+}
+
+func (i *iniIter) Next() (vtab.Row, error) {
+	for i.scanner.Scan() {
+		i.line++
+		line := strings.TrimSpace(i.scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid section %q", i.file, i.line, line)
+			}
+			i.section = strings.TrimSpace(line[1:end])
+			continue
+		}
+		if i.only != nil && *i.only != i.section {
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			i.key, i.value, i.hasValue = line, "", false
+		} else {
+			i.key, i.value, i.hasValue = strings.TrimSpace(line[:sep]), unquote(strings.TrimSpace(line[sep+1:])), true
+		}
+		if !i.prefixes.match(i.path()) {
+			continue
+		}
+		return i, nil
+	}
+	if err := i.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// unquote removes the quotes around a value, or a trailing comment from an unquoted value
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		if v[0] == '"' {
+			if s, err := strconv.Unquote(v); err == nil {
+				return s
+			}
+		}
+		return v[1 : len(v)-1]
+	}
+	for _, comment := range []string{" ;", " #"} {
+		if c := strings.Index(v, comment); c >= 0 {
+			v = strings.TrimSpace(v[:c])
+		}
+	}
+	return v
+}
+
+// path returns the path of the current entry, section.key or just key before the first section
+func (i *iniIter) path() string {
+	if i.section == "" {
+		return i.key
+	}
+	return i.section + "." + i.key
+}
+
+func (i *iniIter) Close() error {
+	return i.reader.Close()
+}
+
+func (i *iniIter) Column(ctx vtab.Context, c int) error {
+	switch iniCols[c].Name {
+	case "path":
+		ctx.ResultText(i.path())
+	case "section":
+		if i.section == "" {
+			ctx.ResultNull()
+		} else {
+			ctx.ResultText(i.section)
+		}
+	case "key":
+		ctx.ResultText(i.key)
+	case "value":
+		if i.hasValue {
+			ctx.ResultText(i.value)
+		} else {
+			ctx.ResultNull()
+		}
+	case "type":
+		if i.hasValue {
+			ctx.ResultText("text")
+		} else {
+			ctx.ResultText("null")
+		}
+	case "line":
+		ctx.ResultInt(i.line)
+	case "file":
+		ctx.ResultText(i.file)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.riyazali.net/sqlite"
+)
+
+// NewTOMLModule returns the toml_tree table function, of the nodes of a TOML file.
+// Dates and times are reported as RFC 3339 text.
+func NewTOMLModule() sqlite.Module {
+	return newTreeModule("toml_tree", parseTOML)
+}
+
+func parseTOML(path string) (*tree, error) {
+	var doc map[string]interface{}
+	md, err := toml.DecodeFile(path, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the decoded tables are maps, so their keys are ordered by where they're first defined in the file
+	order := make(map[string]int)
+	for k, key := range md.Keys() {
+		if _, ok := order[key.String()]; !ok {
+			order[key.String()] = k
+		}
+	}
+	return tomlTree(doc, nil, order), nil
+}
+
+// tomlTree returns the tree of a decoded TOML value, at the key path key
+func tomlTree(v interface{}, key toml.Key, order map[string]int) *tree {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		t := &tree{typ: "object"}
+		for k := range v {
+			t.keys = append(t.keys, k)
+		}
+		sort.Slice(t.keys, func(a, b int) bool {
+			oa, aok := order[append(key[:len(key):len(key)], t.keys[a]).String()]
+			ob, bok := order[append(key[:len(key):len(key)], t.keys[b]).String()]
+			if aok != bok {
+				return aok
+			}
+			if oa != ob {
+				return oa < ob
+			}
+			return t.keys[a] < t.keys[b]
+		})
+		for _, k := range t.keys {
+			t.children = append(t.children, tomlTree(v[k], append(key[:len(key):len(key)], k), order))
+		}
+		return t
+	case []map[string]interface{}:
+		t := &tree{typ: "array"}
+		for _, item := range v {
+			t.children = append(t.children, tomlTree(item, key, order))
+		}
+		return t
+	case []interface{}:
+		t := &tree{typ: "array"}
+		for _, item := range v {
+			t.children = append(t.children, tomlTree(item, key, order))
+		}
+		return t
+	case time.Time:
+		// local dates and times are decoded into the local time zone, with these names
+		switch v.Location().String() {
+		case "date-local":
+			return scalar(v.Format("2006-01-02"))
+		case "time-local":
+			return scalar(v.Format("15:04:05.999999999"))
+		case "datetime-local":
+			return scalar(v.Format("2006-01-02T15:04:05.999999999"))
+		}
+		return scalar(v.Format(time.RFC3339Nano))
+	default:
+		return scalar(v)
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"go.riyazali.net/sqlite"
+	"gopkg.in/yaml.v3"
+)
+
+// NewYAMLModule returns the yaml_tree table function, of the nodes of the first document of a YAML file.
+// Aliases are expanded, up to maxYAMLNodes nodes in all, and timestamps and other tagged scalars are
+// reported as text.
+func NewYAMLModule() sqlite.Module {
+	return newTreeModule("yaml_tree", parseYAML)
+}
+
+func parseYAML(path string) (*tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var doc yaml.Node
+	if err := yaml.NewDecoder(f).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return (&yamlExpander{}).tree(&doc, 0)
+}
+
+const (
+	// maxAliasDepth bounds the expansion of aliases, which may refer to their own ancestors
+	maxAliasDepth = 64
+	// maxYAMLNodes bounds the nodes of a document with its aliases expanded, as a few aliases of aliases
+	// can expand exponentially (as in the "billion laughs" attack)
+	maxYAMLNodes = 1 << 20
+)
+
+// yamlExpander builds the tree of a YAML document, expanding its aliases
+type yamlExpander struct {
+	// nodes is the number of nodes of the tree so far
+	nodes int
+}
+
+func (e *yamlExpander) tree(n *yaml.Node, aliases int) (*tree, error) {
+	if e.nodes++; e.nodes > maxYAMLNodes {
+		return nil, fmt.Errorf("line %d: the document expands to more than %d nodes", n.Line, maxYAMLNodes)
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return &tree{typ: "null"}, nil
+		}
+		return e.tree(n.Content[0], aliases)
+	case yaml.AliasNode:
+		if aliases >= maxAliasDepth {
+			return nil, fmt.Errorf("line %d: aliases nested too deeply", n.Line)
+		}
+		return e.tree(n.Alias, aliases+1)
+	case yaml.SequenceNode:
+		t := &tree{typ: "array"}
+		for _, item := range n.Content {
+			child, err := e.tree(item, aliases)
+			if err != nil {
+				return nil, err
+			}
+			t.children = append(t.children, child)
+		}
+		return t, nil
+	case yaml.MappingNode:
+		t := &tree{typ: "object"}
+		for c := 0; c+1 < len(n.Content); c += 2 {
+			var key string
+			if err := n.Content[c].Decode(&key); err != nil {
+				key = n.Content[c].Value
+			}
+			child, err := e.tree(n.Content[c+1], aliases)
+			if err != nil {
+				return nil, err
+			}
+			t.keys = append(t.keys, key)
+			t.children = append(t.children, child)
+		}
+		return t, nil
+	default:
+		var v interface{}
+		switch n.ShortTag() {
+		case "!!null", "!!bool", "!!int", "!!float":
+			if err := n.Decode(&v); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n.Line, err)
+			}
+		default:
+			v = n.Value
+		}
+		return scalar(v), nil
+	}
+}
@@ -0,0 +1,442 @@
+// Package csv provides virtual table modules for reading CSV and TSV files.
+//
+// vtab_csv declares a table with a column for each field of the file, named from its header:
+//
+//	CREATE VIRTUAL TABLE t USING vtab_csv(path='data.csv', header=true, delimiter=',', sample=100)
+//
+// csv_read is a table-valued function producing one row per record, with the fields as JSON:
+//
+//	SELECT line, fields, record FROM csv_read('data.csv')
+//
+// Files are streamed, one record per row, so a query stops reading once SQLite has the rows it needs. The LIMIT of
+// a query without other constraints (or ORDER BY) is pushed down to the modules, which stop reading at it.
+package csv
+
+import (
+	stdcsv "encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// options are the arguments a CSV file is read with
+type options struct {
+	path      string
+	header    bool
+	delimiter rune
+	sample    int
+}
+
+// parseOptions parses the arguments of vtab_csv, see the package documentation
+func parseOptions(args map[string]string) (*options, error) {
+	opts := &options{path: args["path"], header: true, delimiter: ','}
+	if opts.path == "" {
+		return nil, errors.New("a path is required")
+	}
+	if strings.HasSuffix(strings.ToLower(opts.path), ".tsv") {
+		opts.delimiter = '\t'
+	}
+
+	if h, ok := args["header"]; ok {
+		header, err := strconv.ParseBool(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q", h)
+		}
+		opts.header = header
+	}
+
+	if d, ok := args["delimiter"]; ok {
+		delimiter, err := parseDelimiter(d)
+		if err != nil {
+			return nil, err
+		}
+		opts.delimiter = delimiter
+	}
+
+	if s, ok := args["sample"]; ok {
+		sample, err := strconv.Atoi(s)
+		if err != nil || sample < 0 {
+			return nil, fmt.Errorf("invalid sample %q", s)
+		}
+		opts.sample = sample
+	}
+
+	return opts, nil
+}
+
+func parseDelimiter(d string) (rune, error) {
+	switch d {
+	case `\t`, "tab", "\t":
+		return '\t', nil
+	}
+	r := []rune(d)
+	if len(r) != 1 {
+		return 0, fmt.Errorf("invalid delimiter %q", d)
+	}
+	return r[0], nil
+}
+
+// open opens the file at opts.path as a CSV reader
+func (opts *options) open() (*os.File, *stdcsv.Reader, error) {
+	f, err := os.Open(opts.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := stdcsv.NewReader(f)
+	r.Comma = opts.delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return f, r, nil
+}
+
+// NewModule returns the vtab_csv module, for use with CREATE VIRTUAL TABLE
+func NewModule() sqlite.Module {
+	return vtab.NewModule("vtab_csv", func(args []string) ([]vtab.Column, vtab.GetIteratorFunc, error) {
+		opts, err := parseOptions(vtab.ParseArgs(args))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		columns, err := readSchema(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return columns, func(constraints []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+			return newIterator(opts, columns, limit(constraints))
+		}, nil
+	}, vtab.PushDownLimit(true))
+}
+
+// limit returns the LIMIT of a scan, or -1 if it has none
+func limit(constraints []*vtab.Constraint) int64 {
+	for _, constraint := range constraints {
+		if constraint.Op == vtab.INDEX_CONSTRAINT_LIMIT {
+			return constraint.Value.Int64()
+		}
+	}
+	return -1
+}
+
+// readSchema reads the header (or first record) of a file to name its columns,
+// and samples the first opts.sample records to decide their types
+func readSchema(opts *options) ([]vtab.Column, error) {
+	f, r, err := opts.open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	first, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s is empty", opts.path)
+		}
+		return nil, err
+	}
+
+	columns := make([]vtab.Column, len(first))
+	seen := make(map[string]bool, len(first))
+	for c := range first {
+		name := fmt.Sprintf("c%d", c+1)
+		if opts.header {
+			name = columnName(first[c], c)
+		}
+		for seen[strings.ToLower(name)] {
+			name += "_"
+		}
+		seen[strings.ToLower(name)] = true
+		columns[c] = vtab.Column{Name: name, Type: "TEXT"}
+	}
+
+	if opts.sample == 0 {
+		return columns, nil
+	}
+
+	samples := make([][]string, 0, opts.sample)
+	if !opts.header {
+		samples = append(samples, first)
+	}
+	for len(samples) < opts.sample {
+		record, err := r.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		samples = append(samples, record)
+	}
+
+	for c := range columns {
+		columns[c].Type = sampleType(samples, c)
+	}
+	return columns, nil
+}
+
+// columnName turns a header field into a column name of letters, digits and _ (keywords, such as order,
+// are quoted in the declared schema)
+func columnName(field string, c int) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(field))
+	if name == "" {
+		return fmt.Sprintf("c%d", c+1)
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "_" + name
+	}
+	return name
+}
+
+// sampleType picks the narrowest type that every (non-empty) sampled value of column c parses as
+func sampleType(samples [][]string, c int) string {
+	typ := ""
+	for _, record := range samples {
+		if c >= len(record) || record[c] == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(record[c], 10, 64); err == nil {
+			if typ == "" {
+				typ = "INTEGER"
+			}
+			continue
+		}
+		if _, err := strconv.ParseFloat(record[c], 64); err == nil {
+			if typ == "" || typ == "INTEGER" {
+				typ = "REAL"
+			}
+			continue
+		}
+		return "TEXT"
+	}
+	if typ == "" {
+		return "TEXT"
+	}
+	return typ
+}
+
+type iter struct {
+	file    *os.File
+	reader  *stdcsv.Reader
+	columns []vtab.Column
+	// remaining is the number of records left to read before the LIMIT, or -1 if there's none
+	remaining int64
+}
+
+func newIterator(opts *options, columns []vtab.Column, limit int64) (*iter, error) {
+	f, r, err := opts.open()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.header {
+		if _, err := r.Read(); err != nil && !errors.Is(err, io.EOF) {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return &iter{f, r, columns, limit}, nil
+}
+
+func (i *iter) Next() (vtab.Row, error) {
+	if i.remaining == 0 {
+		return nil, io.EOF
+	}
+	i.remaining--
+	record, err := i.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	return &row{record, i.columns}, nil
+}
+
+func (i *iter) Close() error {
+	return i.file.Close()
+}
+
+type row struct {
+	record  []string
+	columns []vtab.Column
+}
+
+func (r *row) Column(ctx vtab.Context, c int) error {
+	if c >= len(r.record) {
+		ctx.ResultNull()
+		return nil
+	}
+	resultField(ctx, r.record[c], r.columns[c].Type)
+	return nil
+}
+
+// resultField reports a field as the given column type, falling back to text if it doesn't parse
+func resultField(ctx vtab.Context, field, typ string) {
+	switch typ {
+	case "INTEGER":
+		if field == "" {
+			ctx.ResultNull()
+			return
+		}
+		if v, err := strconv.ParseInt(field, 10, 64); err == nil {
+			ctx.ResultInt64(v)
+			return
+		}
+	case "REAL":
+		if field == "" {
+			ctx.ResultNull()
+			return
+		}
+		if v, err := strconv.ParseFloat(field, 64); err == nil {
+			ctx.ResultFloat(v)
+			return
+		}
+	}
+	ctx.ResultText(field)
+}
+
+var readCols = []vtab.Column{
+	{Name: "line", Type: "INTEGER", Description: "the line the record starts on"},
+	{Name: "fields", Type: "TEXT"},
+	{Name: "record", Type: "TEXT"},
+	{Name: "path", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "header", Type: "INTEGER", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "delimiter", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+}
+
+// NewReadFunc returns the csv_read table-valued function, csv_read(path, header, delimiter), which produces a row
+// for each record of the file with the number of the line it starts on (which differs from the number of the
+// record once a quoted field spans lines), its fields as a JSON array and, if the file has a header, the record
+// as a JSON object keyed by the header.
+func NewReadFunc() sqlite.Module {
+	return vtab.NewTableFunc("csv_read", readCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		args := make(map[string]string)
+		for _, constraint := range constraints {
+			if constraint.ColIndex >= 0 && constraint.Op == sqlite.INDEX_CONSTRAINT_EQ {
+				args[readCols[constraint.ColIndex].Name] = constraint.Value.Text()
+			}
+		}
+
+		opts, err := parseOptions(args)
+		if err != nil {
+			return nil, err
+		}
+		f, r, err := opts.open()
+		if err != nil {
+			return nil, err
+		}
+
+		it := &readIter{file: f, reader: r, opts: opts, remaining: limit(constraints)}
+		if opts.header {
+			header, err := r.Read()
+			if err != nil && !errors.Is(err, io.EOF) {
+				f.Close()
+				return nil, err
+			}
+			it.header = header
+		}
+		return it, nil
+	}, vtab.PushDownLimit(true))
+}
+
+type readIter struct {
+	file   *os.File
+	reader *stdcsv.Reader
+	opts   *options
+	header []string
+	line   int
+	record []string
+	// remaining is the number of records left to read before the LIMIT, or -1 if there's none
+	remaining int64
+}
+
+func (i *readIter) Next() (vtab.Row, error) {
+	if i.remaining == 0 {
+		return nil, io.EOF
+	}
+	i.remaining--
+	record, err := i.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	i.line, _ = i.reader.FieldPos(0)
+	i.record = record
+	return i, nil
+}
+
+func (i *readIter) Close() error {
+	return i.file.Close()
+}
+
+func (i *readIter) Column(ctx vtab.Context, c int) error {
+	switch readCols[c].Name {
+	case "line":
+		ctx.ResultInt(i.line)
+	case "fields":
+		b, err := json.Marshal(i.record)
+		if err != nil {
+			return err
+		}
+		ctx.ResultText(string(b))
+	case "record":
+		if i.header == nil {
+			ctx.ResultNull()
+			return nil
+		}
+		record := make(map[string]string, len(i.header))
+		for f, name := range i.header {
+			if f < len(i.record) {
+				record[name] = i.record[f]
+			}
+		}
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		ctx.ResultText(string(b))
+	case "path":
+		ctx.ResultText(i.opts.path)
+	case "header":
+		if i.opts.header {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case "delimiter":
+		ctx.ResultText(string(i.opts.delimiter))
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// Modules returns the vtab_csv module and csv_read table-valued function, as created by Register
+func Modules() []*vtab.ModuleInfo {
+	return []*vtab.ModuleInfo{
+		{Name: "vtab_csv", Module: NewModule(), ReadOnly: true},
+		{Name: "csv_read", Module: NewReadFunc(), EponymousOnly: true, ReadOnly: true},
+	}
+}
+
+func init() {
+	for _, info := range Modules() {
+		vtab.DefaultRegistry.Add(info)
+	}
+}
+
+// Register registers the vtab_csv module and csv_read table-valued function with api. They're also added to
+// vtab.DefaultRegistry.
+func Register(api *sqlite.ExtensionApi) error {
+	return vtab.CreateModules(api, Modules())
+}
@@ -0,0 +1,200 @@
+package csv_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/augmentable-dev/vtab/pkg/csv"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := csv.Register(api); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+const people = `name,age,height (m)
+alice,34,1.62
+bob,,1.80
+carol,29,1.7
+dave,41,1.75
+`
+
+func writeFile(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a virtual table only exists on the connection that created it
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestCSVModule(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	path := writeFile(t, "people.csv", people)
+	_, err := db.Exec(fmt.Sprintf("create virtual table people using vtab_csv(path='%s', sample=10)", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []struct {
+		Name   string        `db:"name"`
+		Age    sql.NullInt64 `db:"age"`
+		Height float64       `db:"height__m_"`
+	}
+	err = db.Select(&contents, "select * from people where height > 1.7 order by name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(contents))
+	assert.Equal(t, "bob", contents[0].Name)
+	assert.False(t, contents[0].Age.Valid)
+	assert.Equal(t, 1.75, contents[1].Height)
+
+	var types []string
+	err = db.Select(&types, "select type from pragma_table_info('people')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"TEXT", "INTEGER", "REAL"}, types)
+}
+
+func TestCSVModuleKeywordHeader(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	path := writeFile(t, "orders.csv", "order,group,from\n1,a,x\n2,b,y\n")
+	_, err := db.Exec(fmt.Sprintf("create virtual table orders using vtab_csv(path='%s', sample=10)", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups []string
+	err = db.Select(&groups, `select "group" from orders where "order" > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"b"}, groups)
+}
+
+func TestTSVModuleNoHeader(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	path := writeFile(t, "pairs.tsv", "a\t1\nb\t2\nc\t3\n")
+	_, err := db.Exec(fmt.Sprintf("create virtual table pairs using vtab_csv(path='%s', header=false)", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []string
+	err = db.Select(&contents, "select c1 || c2 from pairs limit 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"a1", "b2"}, contents)
+}
+
+func TestCSVModuleMissingPath(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	_, err := db.Exec("create virtual table nothing using vtab_csv(header=true)")
+	assert.Error(t, err)
+}
+
+func TestCSVRead(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	path := writeFile(t, "people.csv", people)
+
+	var records []string
+	err := db.Select(&records, "select record from csv_read(?) where line = 2", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{`{"age":"34","height (m)":"1.62","name":"alice"}`}, records)
+
+	var fields []string
+	err = db.Select(&fields, "select fields from csv_read(?, false) where line = 1", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{`["name","age","height (m)"]`}, fields)
+}
+
+func TestCSVReadMultilineFields(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	path := writeFile(t, "notes.csv", "id,note\n1,\"two\nlines\"\n2,one line\n")
+
+	var lines []int
+	if err := db.Select(&lines, "select line from csv_read(?)", path); err != nil {
+		t.Fatal(err)
+	}
+	// the lines the records start on, rather than the numbers of the records
+	assert.Equal(t, []int{2, 4}, lines)
+}
+
+func TestLimit(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	path := writeFile(t, "people.csv", people)
+	if _, err := db.Exec(fmt.Sprintf("create virtual table people using vtab_csv(path='%s')", path)); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	if err := db.Select(&names, "select name from people limit 2"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"alice", "bob"}, names)
+
+	var lines []int
+	if err := db.Select(&lines, "select line from csv_read(?) limit 3", path); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{2, 3, 4}, lines)
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	var names []string
+	for _, info := range vtab.DefaultRegistry.Modules() {
+		names = append(names, info.Name)
+	}
+	assert.Subset(t, names, []string{"vtab_csv", "csv_read"})
+
+	help, err := vtab.DefaultRegistry.Help("csv_read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, help, "csv_read(")
+}
@@ -0,0 +1,378 @@
+// Package federated provides a module that exposes a table or query of another database/sql database
+// (Postgres, MySQL, another SQLite file...) as a virtual table:
+//
+//	CREATE VIRTUAL TABLE users USING pg(table='public.users')
+//	CREATE VIRTUAL TABLE active USING pg(query='SELECT id, email FROM users WHERE active')
+//
+// The schema of each table is introspected from the remote when it's created. Constraints and ORDER BY that
+// the remote can evaluate are translated into its WHERE and ORDER BY clauses, with bound parameters, so that
+// fewer rows are transferred. SQLite checks the constraints again, as the remote may evaluate them differently
+// (as with MySQL's case-insensitive =), so a LIMIT is only passed to the remote for queries without constraints.
+package federated
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// Dialect describes the SQL of a remote database
+type Dialect struct {
+	// Placeholder returns the n-th (1-based) bound parameter of a query
+	Placeholder func(n int) string
+	// Quote quotes an identifier
+	Quote func(ident string) string
+	// Ops are the constraint operators the remote can evaluate, and their SQL. The rows they select must include
+	// those SQLite would, though they may include more (SQLite checks them again): as the collation of a remote
+	// column may not be SQLite's BINARY, only = and Ops other than the comparisons are used on text columns.
+	Ops map[sqlite.ConstraintOp]string
+	// NullsOrdering is whether ORDER BY needs NULLS FIRST / NULLS LAST to order NULLs as SQLite does (first)
+	NullsOrdering bool
+}
+
+func quoteWith(q string) func(string) string {
+	return func(ident string) string {
+		return q + strings.ReplaceAll(ident, q, q+q) + q
+	}
+}
+
+var comparisons = map[sqlite.ConstraintOp]string{
+	sqlite.INDEX_CONSTRAINT_EQ: "=",
+	sqlite.INDEX_CONSTRAINT_NE: "<>",
+	sqlite.INDEX_CONSTRAINT_GT: ">",
+	sqlite.INDEX_CONSTRAINT_GE: ">=",
+	sqlite.INDEX_CONSTRAINT_LT: "<",
+	sqlite.INDEX_CONSTRAINT_LE: "<=",
+}
+
+var (
+	// SQLite is the dialect of a remote SQLite database, which evaluates LIKE and GLOB as the local one does
+	// (as they ignore the collations of columns)
+	SQLite = Dialect{
+		Placeholder: func(int) string { return "?" },
+		Quote:       quoteWith(`"`),
+		Ops: map[sqlite.ConstraintOp]string{
+			sqlite.INDEX_CONSTRAINT_EQ: "=", sqlite.INDEX_CONSTRAINT_NE: "<>",
+			sqlite.INDEX_CONSTRAINT_GT: ">", sqlite.INDEX_CONSTRAINT_GE: ">=",
+			sqlite.INDEX_CONSTRAINT_LT: "<", sqlite.INDEX_CONSTRAINT_LE: "<=",
+			sqlite.INDEX_CONSTRAINT_LIKE: "LIKE", sqlite.INDEX_CONSTRAINT_GLOB: "GLOB",
+		},
+	}
+	// Postgres is the dialect of a remote Postgres database
+	Postgres = Dialect{
+		Placeholder:   func(n int) string { return fmt.Sprintf("$%d", n) },
+		Quote:         quoteWith(`"`),
+		Ops:           comparisons,
+		NullsOrdering: true,
+	}
+	// MySQL is the dialect of a remote MySQL (or MariaDB) database
+	MySQL = Dialect{
+		Placeholder: func(int) string { return "?" },
+		Quote:       quoteWith("`"),
+		Ops:         comparisons,
+	}
+)
+
+// Config is the remote database of a module
+type Config struct {
+	DB      *sql.DB
+	Dialect Dialect
+	// Log, if set, is called with every query made to the remote
+	Log func(query string, args []interface{})
+}
+
+// column is a column of a remote table
+type column struct {
+	remote string
+	typ    string
+	// boolean is whether the remote column is a boolean, which a remote such as Postgres won't compare to the
+	// integers SQLite compares it to
+	boolean bool
+}
+
+// NewModule returns a module (to be registered as name) over the remote database of cfg.
+// Each table is created with either a table='name' argument (optionally schema qualified)
+// or a query='SELECT ...' argument.
+func NewModule(name string, cfg Config) sqlite.Module {
+	return vtab.NewModule(name, func(args []string) ([]vtab.Column, vtab.GetIteratorFunc, error) {
+		parsed := vtab.ParseArgs(args)
+
+		var from string
+		switch {
+		case parsed["table"] != "":
+			parts := strings.Split(parsed["table"], ".")
+			for p := range parts {
+				parts[p] = cfg.Dialect.Quote(parts[p])
+			}
+			from = strings.Join(parts, ".")
+		case parsed["query"] != "":
+			from = "(" + parsed["query"] + ") AS t"
+		default:
+			return nil, nil, errors.New("a table or query is required")
+		}
+
+		remote, err := introspect(cfg, from)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		columns := make([]vtab.Column, len(remote))
+		seen := make(map[string]bool, len(remote))
+		for c, col := range remote {
+			name := columnName(col.remote, c)
+			for seen[strings.ToLower(name)] {
+				name += "_"
+			}
+			seen[strings.ToLower(name)] = true
+			columns[c] = vtab.Column{Name: name, Type: col.typ, Filters: filters(cfg.Dialect, col)}
+			// the remote orders text by its collation, which may not be SQLite's
+			if collated(col) {
+				continue
+			}
+			columns[c].OrderBy = vtab.ASC | vtab.DESC
+		}
+
+		return columns, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+			return newIterator(cfg, from, remote, constraints, order)
+		}, nil
+	}, vtab.PushDownLimit(true))
+}
+
+// collated returns whether a remote column may hold text, whose comparisons and order depend on its collation.
+// Columns of other types than INTEGER, REAL and BLOB are collated.
+func collated(col *column) bool {
+	switch col.typ {
+	case "INTEGER", "REAL", "BLOB":
+		return false
+	default:
+		return true
+	}
+}
+
+// filters returns the filters of a remote column, the Ops of d that the remote evaluates on it. Constraints on
+// booleans are left to SQLite.
+func filters(d Dialect, col *column) []*vtab.ColumnFilter {
+	if col.boolean {
+		return nil
+	}
+	filters := make([]*vtab.ColumnFilter, 0, len(d.Ops))
+	for op := range d.Ops {
+		if _, comparison := comparisons[op]; comparison && op != sqlite.INDEX_CONSTRAINT_EQ && collated(col) {
+			continue
+		}
+		filters = append(filters, &vtab.ColumnFilter{Op: op})
+	}
+	return filters
+}
+
+// introspect reads the columns of a remote table or query, without reading any rows
+func introspect(cfg Config, from string) ([]*column, error) {
+	rows, err := cfg.DB.Query("SELECT * FROM " + from + " WHERE 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]*column, len(types))
+	for c, t := range types {
+		columns[c] = &column{t.Name(), affinity(t.DatabaseTypeName()), strings.HasPrefix(strings.ToUpper(t.DatabaseTypeName()), "BOOL")}
+	}
+	return columns, rows.Err()
+}
+
+// affinity maps the type of a remote column to the SQLite type it's declared with, following
+// SQLite's rules for determining column affinity (with some additions for common remote types)
+func affinity(remote string) string {
+	t := strings.ToUpper(remote)
+	switch {
+	case t == "":
+		return ""
+	case strings.Contains(t, "INT"), strings.HasPrefix(t, "BOOL"), t == "BIT":
+		return "INTEGER"
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"),
+		strings.Contains(t, "JSON"), strings.Contains(t, "UUID"), strings.Contains(t, "DATE"),
+		strings.Contains(t, "TIME"), strings.HasPrefix(t, "ENUM"):
+		return "TEXT"
+	case strings.Contains(t, "BLOB"), strings.Contains(t, "BYTEA"), strings.Contains(t, "BINARY"):
+		return "BLOB"
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return "REAL"
+	default:
+		return "NUMERIC"
+	}
+}
+
+// columnName turns the name of a remote column into a column name of letters, digits and _
+func columnName(remote string, c int) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, remote)
+	if name == "" {
+		return fmt.Sprintf("c%d", c+1)
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "_" + name
+	}
+	return name
+}
+
+// value converts a constraint value to a query parameter
+func value(v *sqlite.Value) interface{} {
+	switch v.Type() {
+	case sqlite.SQLITE_INTEGER:
+		return v.Int64()
+	case sqlite.SQLITE_FLOAT:
+		return v.Float()
+	case sqlite.SQLITE_TEXT:
+		return v.Text()
+	case sqlite.SQLITE_BLOB:
+		return v.Blob()
+	default:
+		return nil
+	}
+}
+
+// query builds the remote query for the given constraints and order
+func query(d Dialect, from string, remote []*column, constraints []*vtab.Constraint, order []*sqlite.OrderBy) (string, []interface{}) {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	for c, col := range remote {
+		if c > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(d.Quote(col.remote))
+	}
+	b.WriteString(" FROM ")
+	b.WriteString(from)
+
+	var args []interface{}
+	var limit *sqlite.Value
+	for _, constraint := range constraints {
+		if constraint.Op == vtab.INDEX_CONSTRAINT_LIMIT {
+			limit = constraint.Value
+			continue
+		}
+		if len(args) == 0 {
+			b.WriteString(" WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		args = append(args, value(constraint.Value))
+		fmt.Fprintf(&b, "%s %s %s", d.Quote(remote[constraint.ColIndex].remote), d.Ops[constraint.Op], d.Placeholder(len(args)))
+	}
+
+	for o, ord := range order {
+		if o == 0 {
+			b.WriteString(" ORDER BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(d.Quote(remote[ord.ColumnIndex].remote))
+		switch {
+		case ord.Desc && d.NullsOrdering:
+			b.WriteString(" DESC NULLS LAST")
+		case ord.Desc:
+			b.WriteString(" DESC")
+		case d.NullsOrdering:
+			b.WriteString(" NULLS FIRST")
+		}
+	}
+
+	if limit != nil {
+		args = append(args, limit.Int64())
+		fmt.Fprintf(&b, " LIMIT %s", d.Placeholder(len(args)))
+	}
+	return b.String(), args
+}
+
+type iter struct {
+	cancel  context.CancelFunc
+	rows    *sql.Rows
+	columns []*column
+	values  []interface{}
+}
+
+func newIterator(cfg Config, from string, remote []*column, constraints []*vtab.Constraint, order []*sqlite.OrderBy) (*iter, error) {
+	q, args := query(cfg.Dialect, from, remote, constraints, order)
+	if cfg.Log != nil {
+		cfg.Log(q, args)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := cfg.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &iter{cancel, rows, remote, make([]interface{}, len(remote))}, nil
+}
+
+func (i *iter) Next() (vtab.Row, error) {
+	if !i.rows.Next() {
+		if err := i.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	dest := make([]interface{}, len(i.values))
+	for v := range i.values {
+		dest[v] = &i.values[v]
+	}
+	if err := i.rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Close stops the remote query, which may still have rows to send
+func (i *iter) Close() error {
+	defer i.cancel()
+	return i.rows.Close()
+}
+
+func (i *iter) Column(ctx vtab.Context, c int) error {
+	switch v := i.values[c].(type) {
+	case nil:
+		ctx.ResultNull()
+	case int64:
+		ctx.ResultInt64(v)
+	case float64:
+		ctx.ResultFloat(v)
+	case bool:
+		if v {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case []byte:
+		if i.columns[c].typ == "BLOB" {
+			vtab.ResultBlob(ctx, v)
+		} else {
+			ctx.ResultText(string(v))
+		}
+	case string:
+		ctx.ResultText(v)
+	case time.Time:
+		ctx.ResultText(v.Format(time.RFC3339Nano))
+	default:
+		ctx.ResultText(fmt.Sprint(v))
+	}
+	return nil
+}
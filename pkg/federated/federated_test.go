@@ -0,0 +1,203 @@
+package federated
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+// remote is the database the module federates, an in-memory SQLite database
+// (of a single connection, as each connection to :memory: is a different database)
+var remote *sql.DB
+
+// queries are the queries made to the remote
+var queries []string
+
+func init() {
+	var err error
+	remote, err = sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		panic(err)
+	}
+	remote.SetMaxOpenConns(1)
+	_, err = remote.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, "e-mail" VARCHAR(255), karma REAL, created DATETIME);
+		INSERT INTO users VALUES
+			(1, 'alice@example.com', 10.5, '2021-01-01'),
+			(2, 'bob@example.com', NULL, '2021-02-01'),
+			(3, 'carol@example.org', 3, '2021-03-01'),
+			(4, NULL, 7, '2021-04-01');
+		CREATE TABLE files (name TEXT, data BLOB);
+		INSERT INTO files VALUES ('a.bin', x'00ff'), ('b.txt', 'text');
+	`)
+	if err != nil {
+		panic(err)
+	}
+
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		m := NewModule("remote", Config{DB: remote, Dialect: SQLite, Log: func(query string, _ []interface{}) {
+			queries = append(queries, query)
+		}})
+		if err := api.CreateModule("remote", m, sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func newDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("create virtual table users using remote(table='users')"); err != nil {
+		t.Fatal(err)
+	}
+	queries = nil
+	return db
+}
+
+func TestSchema(t *testing.T) {
+	db := newDB(t)
+
+	var columns []struct {
+		Name string `db:"name"`
+		Type string `db:"type"`
+	}
+	if err := db.Select(&columns, "select name, type from pragma_table_info('users')"); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, columns, 4) {
+		assert.Equal(t, "id", columns[0].Name)
+		assert.Equal(t, "INTEGER", columns[0].Type)
+		assert.Equal(t, "e_mail", columns[1].Name)
+		assert.Equal(t, "TEXT", columns[1].Type)
+		assert.Equal(t, "REAL", columns[2].Type)
+		assert.Equal(t, "TEXT", columns[3].Type)
+	}
+}
+
+func TestPushDown(t *testing.T) {
+	db := newDB(t)
+
+	var ids []int
+	err := db.Select(&ids, "select id from users where e_mail like '%@example.com' and id >= 2 order by created desc limit 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{2}, ids)
+
+	// numbers are ordered by the remote, text isn't, nor compared other than by =, as it's collated
+	ids = nil
+	err = db.Select(&ids, "select id from users where id > 1 and e_mail > 'b' order by karma desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{3, 2}, ids)
+
+	assert.Equal(t, []string{
+		`SELECT "id", "e-mail", "karma", "created" FROM "users" WHERE "e-mail" LIKE ? AND "id" >= ?`,
+		`SELECT "id", "e-mail", "karma", "created" FROM "users" WHERE "id" > ? ORDER BY "karma" DESC`,
+	}, queries)
+}
+
+func TestBlobs(t *testing.T) {
+	db := newDB(t)
+	if _, err := db.Exec("create virtual table files using remote(table='files')"); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []struct {
+		Name string `db:"name"`
+		Type string `db:"type"`
+		Data []byte `db:"data"`
+	}
+	if err := db.Select(&files, "select name, typeof(data) as type, data from files order by name"); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, "blob", files[0].Type)
+		assert.Equal(t, []byte{0x00, 0xff}, files[0].Data)
+	}
+}
+
+func TestNulls(t *testing.T) {
+	db := newDB(t)
+
+	var karma []sql.NullFloat64
+	if err := db.Select(&karma, "select karma from users order by karma"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []sql.NullFloat64{{}, {Float64: 3, Valid: true}, {Float64: 7, Valid: true}, {Float64: 10.5, Valid: true}}, karma)
+
+	var count int
+	if err := db.Get(&count, "select count(*) from users where e_mail = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+}
+
+func TestQuery(t *testing.T) {
+	db := newDB(t)
+	if _, err := db.Exec("create virtual table domains using remote(query='select substr(\"e-mail\", instr(\"e-mail\", ''@'') + 1) as domain, count(*) as n from users group by 1')"); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.Get(&n, "select n from domains where domain = 'example.com'"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, n)
+}
+
+func TestDialects(t *testing.T) {
+	remote := []*column{{"id", "INTEGER", false}, {"name", "TEXT", false}}
+	constraints := []*vtab.Constraint{
+		{ColIndex: 1, Op: sqlite.INDEX_CONSTRAINT_NE, Value: &sqlite.Value{}},
+		{ColIndex: 0, Op: sqlite.INDEX_CONSTRAINT_LT, Value: &sqlite.Value{}},
+		{ColIndex: -1, Op: vtab.INDEX_CONSTRAINT_LIMIT, Value: &sqlite.Value{}},
+	}
+	order := []*sqlite.OrderBy{{ColumnIndex: 1}, {ColumnIndex: 0, Desc: true}}
+
+	q, args := query(Postgres, `"public"."users"`, remote, constraints, order)
+	assert.Equal(t, `SELECT "id", "name" FROM "public"."users" WHERE "name" <> $1 AND "id" < $2 ORDER BY "name" NULLS FIRST, "id" DESC NULLS LAST LIMIT $3`, q)
+	assert.Len(t, args, 3)
+
+	q, _ = query(MySQL, "`users`", remote, constraints[:1], nil)
+	assert.Equal(t, "SELECT `id`, `name` FROM `users` WHERE `name` <> ?", q)
+}
+
+func TestFilters(t *testing.T) {
+	ops := func(d Dialect, col *column) map[sqlite.ConstraintOp]bool {
+		ops := make(map[sqlite.ConstraintOp]bool)
+		for _, filter := range filters(d, col) {
+			ops[filter.Op] = true
+		}
+		return ops
+	}
+	assert.Len(t, ops(MySQL, &column{"id", "INTEGER", false}), 6)
+	assert.Equal(t, map[sqlite.ConstraintOp]bool{sqlite.INDEX_CONSTRAINT_EQ: true}, ops(MySQL, &column{"name", "TEXT", false}))
+	assert.Equal(t, map[sqlite.ConstraintOp]bool{
+		sqlite.INDEX_CONSTRAINT_EQ: true, sqlite.INDEX_CONSTRAINT_LIKE: true, sqlite.INDEX_CONSTRAINT_GLOB: true,
+	}, ops(SQLite, &column{"name", "", false}))
+	assert.Empty(t, ops(Postgres, &column{"active", "INTEGER", true}))
+}
+
+func TestAffinity(t *testing.T) {
+	for remote, want := range map[string]string{
+		"BIGINT": "INTEGER", "boolean": "INTEGER", "varchar": "TEXT", "TIMESTAMPTZ": "TEXT", "uuid": "TEXT",
+		"BYTEA": "BLOB", "DOUBLE PRECISION": "REAL", "NUMERIC": "NUMERIC", "DECIMAL(10,2)": "NUMERIC", "": "",
+	} {
+		assert.Equal(t, want, affinity(remote), remote)
+	}
+}
@@ -0,0 +1,330 @@
+// Package fswalk provides the fs_walk table-valued function, which lists the files under a directory:
+//
+//	SELECT path, size FROM fs_walk('/var/log', '*.log') WHERE path GLOB '/var/log/nginx/*' ORDER BY path
+//
+// Constraints on path (=, <, <=, >, >=, GLOB and LIKE with a literal prefix) are used to skip walking
+// directories that can't contain a match, and rows are produced in path order, so ORDER BY path is free.
+package fswalk
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+var pathFilters = []*vtab.ColumnFilter{
+	{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_GT}, {Op: sqlite.INDEX_CONSTRAINT_GE},
+	{Op: sqlite.INDEX_CONSTRAINT_LT}, {Op: sqlite.INDEX_CONSTRAINT_LE},
+	{Op: sqlite.INDEX_CONSTRAINT_GLOB}, {Op: sqlite.INDEX_CONSTRAINT_LIKE},
+}
+
+var cols = []vtab.Column{
+	{Name: "path", Type: "TEXT", Filters: pathFilters, OrderBy: vtab.ASC},
+	{Name: "name", Type: "TEXT"},
+	{Name: "size", Type: "INTEGER"},
+	{Name: "mode", Type: "TEXT"},
+	{Name: "mtime", Type: "TEXT"},
+	{Name: "is_dir", Type: "INTEGER"},
+	{Name: "contents", Type: "BLOB"},
+	{Name: "root", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "pattern", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+}
+
+// resolveFunc maps the root argument to the FS to walk, the path within it to start from,
+// and the prefix paths are reported with
+type resolveFunc func(root string) (fsys fs.FS, start string, prefix string, err error)
+
+// NewModule returns the fs_walk table-valued function over the local filesystem.
+// Paths are reported with the root argument as their prefix, which defaults to the working directory.
+func NewModule() sqlite.Module {
+	return newModule(func(root string) (fs.FS, string, string, error) {
+		return os.DirFS(root), ".", filepath.ToSlash(root), nil
+	})
+}
+
+// NewFSModule returns the fs_walk table-valued function over fsys, with the root argument a path within fsys
+func NewFSModule(fsys fs.FS) sqlite.Module {
+	return newModule(func(root string) (fs.FS, string, string, error) {
+		if !fs.ValidPath(root) {
+			return nil, "", "", fmt.Errorf("invalid root %q", root)
+		}
+		return fsys, root, root, nil
+	})
+}
+
+func newModule(resolve resolveFunc) sqlite.Module {
+	return vtab.NewTableFunc("fs_walk", cols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		root, pattern := ".", ""
+		b := &bounds{}
+		for _, constraint := range constraints {
+			switch cols[constraint.ColIndex].Name {
+			case "root":
+				root = constraint.Value.Text()
+			case "pattern":
+				pattern = constraint.Value.Text()
+			case "path":
+				b.add(constraint.Op, constraint.Value.Text())
+			}
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, vtab.ColumnError(sqlite.SQLITE_ERROR, "pattern", err)
+		}
+
+		fsys, start, prefix, err := resolve(root)
+		if err != nil {
+			return nil, vtab.ColumnError(sqlite.SQLITE_ERROR, "root", err)
+		}
+
+		info, err := fs.Stat(fsys, start)
+		if err != nil {
+			return nil, vtab.ColumnError(sqlite.SQLITE_NOTFOUND, "root", err)
+		}
+
+		w := &walker{fsys: fsys, root: root, start: start, prefix: prefix, pattern: pattern, bounds: b}
+		w.stack = []*item{{fsPath: start, entry: fs.FileInfoToDirEntry(info)}}
+		if info.IsDir() {
+			w.stack = append([]*item{{fsPath: start, subtree: true}}, w.stack...)
+		}
+		return w, nil
+	}, vtab.EarlyOrderByConstraintExit(true))
+}
+
+// bounds are the constraints on path used to skip directories that can't contain a match
+type bounds struct {
+	lower, upper         string
+	hasLower, hasUpper   bool
+	lowerIncl, upperIncl bool
+	prefix               string
+	foldPrefix           bool
+}
+
+func (b *bounds) add(op sqlite.ConstraintOp, v string) {
+	switch op {
+	case sqlite.INDEX_CONSTRAINT_EQ:
+		b.add(sqlite.INDEX_CONSTRAINT_GE, v)
+		b.add(sqlite.INDEX_CONSTRAINT_LE, v)
+	case sqlite.INDEX_CONSTRAINT_GT, sqlite.INDEX_CONSTRAINT_GE:
+		if !b.hasLower || v > b.lower {
+			b.lower, b.hasLower, b.lowerIncl = v, true, op == sqlite.INDEX_CONSTRAINT_GE
+		}
+	case sqlite.INDEX_CONSTRAINT_LT, sqlite.INDEX_CONSTRAINT_LE:
+		if !b.hasUpper || v < b.upper {
+			b.upper, b.hasUpper, b.upperIncl = v, true, op == sqlite.INDEX_CONSTRAINT_LE
+		}
+	case sqlite.INDEX_CONSTRAINT_GLOB:
+		if end := strings.IndexAny(v, "*?["); end >= 0 {
+			v = v[:end]
+		}
+		b.prefix, b.foldPrefix = v, false
+	case sqlite.INDEX_CONSTRAINT_LIKE:
+		// LIKE is case-insensitive (for ASCII) so its prefix is compared case-insensitively
+		if end := strings.IndexAny(v, "%_"); end >= 0 {
+			v = v[:end]
+		}
+		b.prefix, b.foldPrefix = strings.ToLower(v), true
+	}
+}
+
+// match reports whether p may satisfy the bounds
+func (b *bounds) match(p string) bool {
+	if b.hasLower && (p < b.lower || (p == b.lower && !b.lowerIncl)) {
+		return false
+	}
+	if b.hasUpper && (p > b.upper || (p == b.upper && !b.upperIncl)) {
+		return false
+	}
+	if b.foldPrefix {
+		p = strings.ToLower(p)
+	}
+	return strings.HasPrefix(p, b.prefix)
+}
+
+// matchSubtree reports whether any path under a directory may satisfy the bounds, given the prefix
+// shared by the paths of its entries
+func (b *bounds) matchSubtree(under string) bool {
+	if b.hasLower && under < b.lower && !strings.HasPrefix(b.lower, under) {
+		return false
+	}
+	if b.hasUpper && under > b.upper {
+		return false
+	}
+	if b.foldPrefix {
+		under = strings.ToLower(under)
+	}
+	return strings.HasPrefix(under, b.prefix) || strings.HasPrefix(b.prefix, under)
+}
+
+// item is an entry to report, or a directory whose entries are still to be listed
+type item struct {
+	fsPath  string
+	entry   fs.DirEntry
+	subtree bool
+}
+
+// walker walks a directory tree depth-first, in path order
+type walker struct {
+	fsys    fs.FS
+	root    string
+	start   string
+	prefix  string
+	pattern string
+	bounds  *bounds
+	stack   []*item
+}
+
+// display returns the path an entry is reported with
+func (w *walker) display(fsPath string) string {
+	if fsPath == w.start {
+		return w.prefix
+	}
+	rel := fsPath
+	if w.start != "." {
+		rel = strings.TrimPrefix(fsPath, w.start+"/")
+	}
+	return path.Join(w.prefix, rel)
+}
+
+// under returns the prefix shared by the reported paths of the entries of a directory
+func (w *walker) under(fsPath string) string {
+	display := w.display(fsPath)
+	switch {
+	case display == ".":
+		return ""
+	case strings.HasSuffix(display, "/"):
+		return display
+	default:
+		return display + "/"
+	}
+}
+
+func (w *walker) Next() (vtab.Row, error) {
+	for len(w.stack) > 0 {
+		it := w.stack[len(w.stack)-1]
+		w.stack = w.stack[:len(w.stack)-1]
+
+		if !it.subtree {
+			display := w.display(it.fsPath)
+			if !w.bounds.match(display) {
+				continue
+			}
+			if w.pattern != "" {
+				if ok, _ := path.Match(w.pattern, it.entry.Name()); !ok {
+					continue
+				}
+			}
+			return &row{w, it, display}, nil
+		}
+
+		if !w.bounds.matchSubtree(w.under(it.fsPath)) {
+			continue
+		}
+
+		entries, err := fs.ReadDir(w.fsys, it.fsPath)
+		if err != nil {
+			// unreadable directories are skipped, rather than failing the whole walk
+			continue
+		}
+
+		// a directory's own entry sorts by its name, and its subtree by its name followed by a slash,
+		// so that entries are produced in the order of their full paths (e.g. a, a.txt, a/b)
+		items := make([]*item, 0, len(entries)*2)
+		for _, entry := range entries {
+			p := path.Join(it.fsPath, entry.Name())
+			items = append(items, &item{fsPath: p, entry: entry})
+			if entry.IsDir() {
+				items = append(items, &item{fsPath: p, subtree: true})
+			}
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].key() > items[j].key() })
+		w.stack = append(w.stack, items...)
+	}
+	return nil, io.EOF
+}
+
+func (it *item) key() string {
+	if it.subtree {
+		return it.fsPath + "/"
+	}
+	return it.fsPath
+}
+
+type row struct {
+	walker  *walker
+	item    *item
+	display string
+}
+
+func (r *row) Column(ctx vtab.Context, c int) error {
+	switch cols[c].Name {
+	case "path":
+		ctx.ResultText(r.display)
+	case "name":
+		ctx.ResultText(r.item.entry.Name())
+	case "size", "mode", "mtime":
+		info, err := r.item.entry.Info()
+		if err != nil {
+			ctx.ResultNull()
+			return nil
+		}
+		switch cols[c].Name {
+		case "size":
+			ctx.ResultInt64(info.Size())
+		case "mode":
+			ctx.ResultText(info.Mode().String())
+		case "mtime":
+			ctx.ResultText(info.ModTime().UTC().Format(time.RFC3339Nano))
+		}
+	case "is_dir":
+		if r.item.entry.IsDir() {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case "contents":
+		// contents are only read if the column is requested
+		if r.item.entry.IsDir() {
+			ctx.ResultNull()
+			return nil
+		}
+		b, err := fs.ReadFile(r.walker.fsys, r.item.fsPath)
+		if err != nil {
+			return vtab.ColumnError(sqlite.SQLITE_IOERR, "contents", err)
+		}
+		vtab.ResultBlob(ctx, b)
+	case "root":
+		ctx.ResultText(r.walker.root)
+	case "pattern":
+		ctx.ResultText(r.walker.pattern)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// Modules returns the fs_walk table-valued function, as created by Register
+func Modules() []*vtab.ModuleInfo {
+	return []*vtab.ModuleInfo{
+		{Name: "fs_walk", Module: NewModule(), EponymousOnly: true, ReadOnly: true},
+	}
+}
+
+func init() {
+	for _, info := range Modules() {
+		vtab.DefaultRegistry.Add(info)
+	}
+}
+
+// Register registers the fs_walk table-valued function with api. It's also added to vtab.DefaultRegistry.
+func Register(api *sqlite.ExtensionApi) error {
+	return vtab.CreateModules(api, Modules())
+}
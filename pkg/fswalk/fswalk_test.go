@@ -0,0 +1,139 @@
+package fswalk
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+// countingFS counts the directories read from an FS
+type countingFS struct {
+	fstest.MapFS
+	reads map[string]int
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.reads[name]++
+	return c.MapFS.ReadDir(name)
+}
+
+var testFS = &countingFS{fstest.MapFS{
+	"a.txt":           {Data: []byte("hello")},
+	"a/b.txt":         {Data: []byte("b")},
+	"a/c/d.log":       {Data: []byte("d")},
+	"logs/app.log":    {Data: []byte("app")},
+	"logs/old/x.log":  {Data: []byte("x")},
+	"logs/readme.txt": {Data: []byte("readme")},
+	"z/last.txt":      {Data: []byte("last")},
+}, make(map[string]int)}
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("fs_walk", NewFSModule(testFS),
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestWalkOrder(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var paths []string
+	err = db.Select(&paths, "select path from fs_walk order by path")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{
+		".", "a", "a.txt", "a/b.txt", "a/c", "a/c/d.log",
+		"logs", "logs/app.log", "logs/old", "logs/old/x.log", "logs/readme.txt",
+		"z", "z/last.txt",
+	}, paths)
+}
+
+func TestWalkPrefixPushdown(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for k := range testFS.reads {
+		delete(testFS.reads, k)
+	}
+
+	var paths []string
+	err = db.Select(&paths, "select path from fs_walk where path glob 'logs/*' and is_dir = 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"logs/app.log", "logs/old/x.log", "logs/readme.txt"}, paths)
+	assert.Equal(t, 0, testFS.reads["a"])
+	assert.Equal(t, 0, testFS.reads["z"])
+	assert.Equal(t, 1, testFS.reads["logs/old"])
+}
+
+func TestWalkRootAndPattern(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []struct {
+		Name     string `db:"name"`
+		Size     int    `db:"size"`
+		Contents string `db:"contents"`
+	}
+	err = db.Select(&contents, "select name, size, contents from fs_walk('logs', '*.log')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(contents))
+	assert.Equal(t, "app.log", contents[0].Name)
+	assert.Equal(t, 3, contents[0].Size)
+	assert.Equal(t, "x", contents[1].Contents)
+
+	// contents may be binary, so they're reported as blobs
+	var types []string
+	if err := db.Select(&types, "select distinct typeof(contents) from fs_walk('logs', '*.log')"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"blob"}, types)
+}
+
+func TestWalkRangeEarlyExit(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for k := range testFS.reads {
+		delete(testFS.reads, k)
+	}
+
+	var paths []string
+	err = db.Select(&paths, "select path from fs_walk where path >= 'a/c' and path < 'logs/old' order by path")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"a/c", "a/c/d.log", "logs", "logs/app.log"}, paths)
+	assert.Equal(t, 0, testFS.reads["z"])
+}
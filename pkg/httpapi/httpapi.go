@@ -0,0 +1,396 @@
+// Package httpapi provides a generic module for exposing the results of a JSON HTTP API as a table.
+// Requests are built from a URL template whose fields are the table's hidden arguments, pages are
+// followed according to a pagination strategy, and each row is extracted from the response by JSON paths:
+//
+//	m, err := httpapi.NewModule(httpapi.Config{
+//		Name:       "gh_issues",
+//		URL:        "https://api.github.com/repos/{{ path .owner }}/{{ path .repo }}/issues?per_page=100",
+//		Args:       []string{"owner", "repo"},
+//		Columns:    []httpapi.Column{{Name: "number", Type: "INTEGER"}, {Name: "title", Type: "TEXT"}},
+//		Pagination: httpapi.LinkHeader(),
+//	})
+//
+//	SELECT number, title FROM gh_issues('augmentable-dev', 'vtab')
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/augmentable-dev/vtab/internal/jsonpath"
+	"go.riyazali.net/sqlite"
+)
+
+// Column is a column of the table, extracted from each row by a JSON path
+type Column struct {
+	Name string
+	Type string
+	// Path is the JSON path of the column's value within a row, defaults to $.<Name>
+	Path string
+}
+
+// Config describes an HTTP API table
+type Config struct {
+	// Name is the name of the module
+	Name string
+	// URL is a text/template for the URL of the first page. The hidden arguments are its fields (unset arguments
+	// are empty), and the path and query functions escape a value for use in a URL path or query respectively.
+	URL string
+	// Args are the names of the hidden argument columns, in the order they're passed to the table-valued function
+	Args []string
+	// Columns are the columns of each row
+	Columns []Column
+	// Rows is the JSON path of the array of rows in each response, defaults to $ (the whole response).
+	// If the value at the path isn't an array, it's taken as a single row.
+	Rows string
+	// Pagination decides the URL of the page after each response, defaults to a single page. A scan fails if it's
+	// given a URL it already fetched, rather than loop.
+	Pagination Paginator
+	// MaxPages is the maximum number of pages fetched by a scan, which fails past it. 0 means no maximum.
+	MaxPages int
+	// Header is added to every request, e.g. for authorization
+	Header http.Header
+	// Client is the client requests are made with, defaults to http.DefaultClient
+	Client *http.Client
+	// Interval is the minimum time between requests made by the module, to stay within an API's rate limit
+	Interval time.Duration
+	// Retries is the number of times a request that fails with a network error, a 429 or a 5xx is retried
+	Retries int
+	// Backoff is the delay before the first retry, which doubles for each subsequent retry. Defaults to 500ms.
+	// A Retry-After header (in seconds) takes precedence.
+	Backoff time.Duration
+}
+
+// Paginator is a strategy for following the pages of an API
+type Paginator interface {
+	// Next returns the URL of the page after the given response, or nil if it was the last page.
+	// body is the decoded response and rows is the number of rows it contained.
+	Next(req *http.Request, resp *http.Response, body interface{}, rows int) (*url.URL, error)
+}
+
+// PaginatorFunc adapts a function to a Paginator
+type PaginatorFunc func(req *http.Request, resp *http.Response, body interface{}, rows int) (*url.URL, error)
+
+func (f PaginatorFunc) Next(req *http.Request, resp *http.Response, body interface{}, rows int) (*url.URL, error) {
+	return f(req, resp, body, rows)
+}
+
+// LinkHeader follows the rel="next" URL of a response's Link header (RFC 8288), as used by e.g. GitHub
+func LinkHeader() Paginator {
+	return PaginatorFunc(func(req *http.Request, resp *http.Response, _ interface{}, _ int) (*url.URL, error) {
+		for _, header := range resp.Header.Values("Link") {
+			for _, link := range strings.Split(header, ",") {
+				parts := strings.Split(link, ";")
+				target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+				for _, param := range parts[1:] {
+					key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+					if key == "rel" && strings.Trim(value, `"`) == "next" {
+						return req.URL.Parse(target)
+					}
+				}
+			}
+		}
+		return nil, nil
+	})
+}
+
+// CursorField follows the cursor at the given JSON path of each response, by setting it as the given query
+// parameter of the request. Pagination ends when the cursor is missing, null or empty.
+func CursorField(path, param string) (Paginator, error) {
+	p, err := jsonpath.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	return PaginatorFunc(func(req *http.Request, _ *http.Response, body interface{}, _ int) (*url.URL, error) {
+		cursor, ok := p.Extract(body)
+		if !ok || cursor == nil || cursor == "" {
+			return nil, nil
+		}
+		return withParam(req.URL, param, fmt.Sprint(cursor)), nil
+	}), nil
+}
+
+// PageNumber requests successive page numbers, from start, in the given query parameter.
+// Pagination ends at the first page without any rows.
+func PageNumber(param string, start int) Paginator {
+	return PaginatorFunc(func(req *http.Request, _ *http.Response, _ interface{}, rows int) (*url.URL, error) {
+		if rows == 0 {
+			return nil, nil
+		}
+		page := start
+		if _, err := fmt.Sscan(req.URL.Query().Get(param), &page); err != nil {
+			page = start
+		}
+		return withParam(req.URL, param, fmt.Sprint(page+1)), nil
+	})
+}
+
+func withParam(u *url.URL, param, value string) *url.URL {
+	next := *u
+	q := next.Query()
+	q.Set(param, value)
+	next.RawQuery = q.Encode()
+	return &next
+}
+
+// NewModule returns a module for the API described by cfg
+func NewModule(cfg Config) (sqlite.Module, error) {
+	tmpl, err := template.New(cfg.Name).Funcs(template.FuncMap{
+		"path":  url.PathEscape,
+		"query": url.QueryEscape,
+	}).Option("missingkey=zero").Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := jsonpath.Path{}
+	if cfg.Rows != "" {
+		if rows, err = jsonpath.Parse(cfg.Rows); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make([]jsonpath.Path, len(cfg.Columns))
+	columns := make([]vtab.Column, 0, len(cfg.Columns)+len(cfg.Args))
+	for c, col := range cfg.Columns {
+		p := col.Path
+		if p == "" {
+			p = "$." + col.Name
+		}
+		if paths[c], err = jsonpath.Parse(p); err != nil {
+			return nil, err
+		}
+		columns = append(columns, vtab.Column{Name: col.Name, Type: col.Type})
+	}
+	for _, arg := range cfg.Args {
+		columns = append(columns, vtab.Column{
+			Name: arg, Type: "TEXT", Hidden: true,
+			Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}},
+		})
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+
+	api := &api{cfg: cfg, tmpl: tmpl, rows: rows, paths: paths}
+	return vtab.NewTableFunc(cfg.Name, columns, api.iterator), nil
+}
+
+// api is the state shared by every query of a module
+type api struct {
+	cfg   Config
+	tmpl  *template.Template
+	rows  jsonpath.Path
+	paths []jsonpath.Path
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (a *api) iterator(constraints []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+	args := make(map[string]string, len(a.cfg.Args))
+	for _, constraint := range constraints {
+		if arg := constraint.ColIndex - len(a.cfg.Columns); arg >= 0 {
+			args[a.cfg.Args[arg]] = constraint.Value.Text()
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := a.tmpl.Execute(&buf, args); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(buf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &iter{api: a, ctx: ctx, cancel: cancel, args: args, next: u, current: -1, fetched: make(map[string]bool)}, nil
+}
+
+// wait blocks until the module is allowed to make another request
+func (a *api) wait(ctx context.Context) error {
+	if a.cfg.Interval <= 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	next := a.last.Add(a.cfg.Interval)
+	now := time.Now()
+	if next.Before(now) {
+		next = now
+	}
+	a.last = next
+	a.mu.Unlock()
+
+	return sleep(ctx, time.Until(next))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetch requests a page, retrying as configured, and decodes the response
+func (a *api) fetch(ctx context.Context, u *url.URL) (*http.Request, *http.Response, interface{}, error) {
+	backoff := a.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := a.wait(ctx); err != nil {
+			return nil, nil, nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		for key, values := range a.cfg.Header {
+			req.Header[key] = values
+		}
+
+		resp, err := a.cfg.Client.Do(req)
+		retry := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if retry && attempt < a.cfg.Retries && ctx.Err() == nil {
+			delay := backoff
+			if resp != nil {
+				var secs int
+				if _, err := fmt.Sscan(resp.Header.Get("Retry-After"), &secs); err == nil {
+					delay = time.Duration(secs) * time.Second
+				}
+				resp.Body.Close()
+			}
+			if err := sleep(ctx, delay); err != nil {
+				return nil, nil, nil, err
+			}
+			backoff *= 2
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		body, err := decode(resp)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return req, resp, body, nil
+	}
+}
+
+func decode(resp *http.Response) (interface{}, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		code := sqlite.SQLITE_ERROR
+		if resp.StatusCode == http.StatusNotFound {
+			code = sqlite.SQLITE_NOTFOUND
+		}
+		return nil, vtab.Errorf(code, "%s %s: %s", resp.Request.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var body interface{}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid JSON response from %s: %v", resp.Request.URL, err)
+	}
+	return body, nil
+}
+
+type iter struct {
+	api     *api
+	ctx     context.Context
+	cancel  context.CancelFunc
+	args    map[string]string
+	next    *url.URL
+	rows    []interface{}
+	current int
+	// fetched are the URLs of the pages fetched by the scan
+	fetched map[string]bool
+}
+
+func (i *iter) Next() (vtab.Row, error) {
+	i.current++
+	for i.current >= len(i.rows) {
+		if i.next == nil {
+			return nil, io.EOF
+		}
+		if i.fetched[i.next.String()] {
+			return nil, fmt.Errorf("the page %s was already fetched, the pagination loops", i.next)
+		}
+		if max := i.api.cfg.MaxPages; max > 0 && len(i.fetched) >= max {
+			return nil, fmt.Errorf("the scan has more than %d pages", max)
+		}
+		i.fetched[i.next.String()] = true
+
+		req, resp, body, err := i.api.fetch(i.ctx, i.next)
+		if err != nil {
+			return nil, err
+		}
+
+		i.rows, i.current = nil, 0
+		if v, ok := i.api.rows.Extract(body); ok && v != nil {
+			if rows, ok := v.([]interface{}); ok {
+				i.rows = rows
+			} else {
+				i.rows = []interface{}{v}
+			}
+		}
+
+		i.next = nil
+		if i.api.cfg.Pagination != nil {
+			if i.next, err = i.api.cfg.Pagination.Next(req, resp, body, len(i.rows)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return i, nil
+}
+
+// Close cancels any request in flight, or any wait for the rate limit
+func (i *iter) Close() error {
+	i.cancel()
+	return nil
+}
+
+func (i *iter) Column(ctx vtab.Context, c int) error {
+	if arg := c - len(i.api.cfg.Columns); arg >= 0 {
+		v, ok := i.args[i.api.cfg.Args[arg]]
+		if !ok {
+			ctx.ResultNull()
+			return nil
+		}
+		ctx.ResultText(v)
+		return nil
+	}
+
+	v, ok := i.api.paths[c].Extract(i.rows[i.current])
+	if !ok {
+		ctx.ResultNull()
+		return nil
+	}
+	return jsonpath.Result(ctx, v)
+}
@@ -0,0 +1,256 @@
+package httpapi
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+var modules = map[string]*Config{}
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		for name, cfg := range modules {
+			m, err := NewModule(*cfg)
+			if err != nil {
+				return sqlite.SQLITE_ERROR, err
+			}
+			if err := api.CreateModule(name, m, sqlite.EponymousOnly(true), sqlite.ReadOnly(true)); err != nil {
+				return sqlite.SQLITE_ERROR, err
+			}
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+// server is the test API, set by each test before it queries the modules
+var server *httptest.Server
+
+// register adds a module for the test API, whose URL is a template that follows the server's address
+func register(name string, cfg Config) {
+	cfg.Name = name
+	cfg.URL = "{{ .base }}" + cfg.URL
+	cfg.Args = append(cfg.Args, "base")
+	modules[name] = &cfg
+}
+
+func init() {
+	cursor, err := CursorField("$.next", "cursor")
+	if err != nil {
+		panic(err)
+	}
+
+	users := []Column{{Name: "id", Type: "INTEGER"}, {Name: "login", Type: "TEXT"}, {Name: "city", Type: "TEXT", Path: "$.address.city"}}
+	register("api_link", Config{URL: "/link", Columns: users, Pagination: LinkHeader()})
+	register("api_cursor", Config{URL: "/cursor", Columns: users, Rows: "$.items", Pagination: cursor})
+	register("api_pages", Config{URL: "/pages?size=2", Columns: users, Pagination: PageNumber("page", 1)})
+	register("api_loop", Config{URL: "/loop", Columns: users, Pagination: LinkHeader()})
+	register("api_max_pages", Config{URL: "/link", Columns: users, Pagination: LinkHeader(), MaxPages: 2})
+	register("api_flaky", Config{URL: "/flaky", Columns: users, Retries: 2, Backoff: 1})
+	register("api_repo", Config{
+		URL:     "/repos/{{ path .owner }}/{{ path .repo }}?q={{ query .q }}",
+		Args:    []string{"owner", "repo", "q"},
+		Columns: []Column{{Name: "path", Type: "TEXT"}, {Name: "q", Type: "TEXT", Path: "$.query"}},
+	})
+}
+
+var people = []string{
+	`{"id": 1, "login": "alice", "address": {"city": "Paris"}}`,
+	`{"id": 2, "login": "bob"}`,
+	`{"id": 3, "login": "carol", "address": {"city": "Lima"}}`,
+	`{"id": 4, "login": "dave", "address": {"city": null}}`,
+	`{"id": 5, "login": "erin"}`,
+}
+
+// page returns the JSON array of people in the given (1-based) page of pages of size 2
+func page(n int) string {
+	start, end := (n-1)*2, n*2
+	if start > len(people) {
+		start = len(people)
+	}
+	if end > len(people) {
+		end = len(people)
+	}
+	s := "["
+	for i, p := range people[start:end] {
+		if i > 0 {
+			s += ","
+		}
+		s += p
+	}
+	return s + "]"
+}
+
+func newServer(t *testing.T) (*sqlx.DB, *int32) {
+	var flaky int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if n == 0 {
+			n = 1
+		}
+		if n*2 < len(people) {
+			w.Header().Add("Link", fmt.Sprintf(`</link?page=%d>; rel="next", </link?page=3>; rel="last"`, n+1))
+		}
+		fmt.Fprint(w, page(n))
+	})
+	mux.HandleFunc("/cursor", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		if n == 0 {
+			n = 1
+		}
+		next := "null"
+		if n*2 < len(people) {
+			next = fmt.Sprintf(`"%d"`, n+1)
+		}
+		fmt.Fprintf(w, `{"items": %s, "next": %s}`, page(n), next)
+	})
+	mux.HandleFunc("/pages", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("size") != "2" {
+			http.Error(w, "missing size", http.StatusBadRequest)
+			return
+		}
+		n, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if n == 0 {
+			n = 1
+		}
+		fmt.Fprint(w, page(n))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		// the next page is always the first
+		w.Header().Add("Link", `</loop>; rel="next"`)
+		fmt.Fprint(w, page(1))
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&flaky, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "oops", http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, page(1))
+		}
+	})
+	mux.HandleFunc("/repos/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"path": %q, "query": %q}`, r.URL.EscapedPath(), r.URL.Query().Get("q"))
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, &flaky
+}
+
+type user struct {
+	ID    int            `db:"id"`
+	Login string         `db:"login"`
+	City  sql.NullString `db:"city"`
+}
+
+func TestPagination(t *testing.T) {
+	db, _ := newServer(t)
+
+	for _, table := range []string{"api_link", "api_cursor", "api_pages"} {
+		t.Run(table, func(t *testing.T) {
+			var users []user
+			if err := db.Select(&users, fmt.Sprintf("select id, login, city from %s($1)", table), server.URL); err != nil {
+				t.Fatal(err)
+			}
+
+			if !assert.Len(t, users, len(people)) {
+				return
+			}
+			for i, u := range users {
+				assert.Equal(t, i+1, u.ID)
+			}
+			assert.Equal(t, "alice", users[0].Login)
+			assert.Equal(t, sql.NullString{String: "Paris", Valid: true}, users[0].City)
+			assert.False(t, users[1].City.Valid)
+			assert.False(t, users[3].City.Valid)
+		})
+	}
+}
+
+func TestLimitStopsPaging(t *testing.T) {
+	db, _ := newServer(t)
+
+	var requests int32
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler.ServeHTTP(w, r)
+	})
+
+	var logins []string
+	if err := db.Select(&logins, "select login from api_link($1) limit 2", server.URL); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"alice", "bob"}, logins)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&requests))
+}
+
+func TestPaginationLoops(t *testing.T) {
+	db, _ := newServer(t)
+
+	var logins []string
+	if err := db.Select(&logins, "select login from api_loop($1)", server.URL); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already fetched")
+	}
+	if err := db.Select(&logins, "select login from api_max_pages($1)", server.URL); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "more than 2 pages")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	db, flaky := newServer(t)
+
+	var count int
+	if err := db.Get(&count, "select count(*) from api_flaky($1)", server.URL); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, count)
+	assert.EqualValues(t, 3, atomic.LoadInt32(flaky))
+}
+
+func TestErrorStatus(t *testing.T) {
+	db, _ := newServer(t)
+
+	var count int
+	err := db.Get(&count, "select count(*) from api_pages($1 || '/missing')", server.URL)
+	assert.Error(t, err)
+}
+
+func TestArgs(t *testing.T) {
+	db, _ := newServer(t)
+
+	var rows []struct {
+		Path  string `db:"path"`
+		Q     string `db:"q"`
+		Owner string `db:"owner"`
+	}
+	err := db.Select(&rows, "select path, q, owner from api_repo('some org', 'a/b', 'x&y=z', $1)", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "/repos/some%20org/a%2Fb", rows[0].Path)
+		assert.Equal(t, "x&y=z", rows[0].Q)
+		assert.Equal(t, "some org", rows[0].Owner)
+	}
+}
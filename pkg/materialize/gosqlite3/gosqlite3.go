@@ -0,0 +1,44 @@
+// Package gosqlite3 adds the vtab_materialize function of package materialize to the connections of
+// github.com/mattn/go-sqlite3. It's apart from package materialize, so that the importers of that package
+// don't build go-sqlite3 (and the SQLite it embeds), such as extensions loaded into another SQLite.
+package gosqlite3
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/augmentable-dev/vtab/pkg/materialize"
+	"github.com/mattn/go-sqlite3"
+	"go.riyazali.net/sqlite"
+)
+
+// execer runs the statements of Materialize on a go-sqlite3 connection
+type execer struct{ conn *sqlite3.SQLiteConn }
+
+func (e execer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return e.conn.ExecContext(ctx, query, values)
+}
+
+// Register adds the vtab_materialize(source, target, args...) function to conn, which materializes source,
+// called with args, into target (see materialize.Materialize) on the connection, returning the number of rows
+// copied. modules are the modules registered on the connection by name, whose columns decide the indexes
+// created, when source is one of them.
+//
+// Unlike the Register funcs of the packages of modules, which add them through a *sqlite.ExtensionApi, it takes
+// the *sqlite3.SQLiteConn of a go-sqlite3 connection, to run the statements on, so it's meant to be called from
+// the ConnectHook of a sqlite3.SQLiteDriver.
+func Register(conn *sqlite3.SQLiteConn, modules map[string]sqlite.Module) error {
+	return conn.RegisterFunc("vtab_materialize", func(source, target string, args ...interface{}) (int64, error) {
+		var columns []vtab.Column
+		if m, ok := modules[source]; ok {
+			columns = vtab.ModuleColumns(m)
+		}
+		return materialize.Materialize(context.Background(), execer{conn}, source, target, columns, args...)
+	}, false)
+}
@@ -0,0 +1,87 @@
+package gosqlite3
+
+import (
+	"database/sql"
+	"io"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+var procCols = []vtab.Column{
+	{Name: "pid", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	{Name: "name", Type: "TEXT"},
+}
+
+// procsModule stands in for the module of the procs table, which the tests create as a plain table
+var procsModule = vtab.NewTableFunc("procs", procCols, func([]*vtab.Constraint, []*sqlite.OrderBy) (vtab.Iterator, error) {
+	return nil, io.EOF
+})
+
+func init() {
+	sql.Register("sqlite3_materialize", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return Register(conn, map[string]sqlite.Module{"procs": procsModule})
+		},
+	})
+}
+
+func indexes(t *testing.T, db *sqlx.DB, table string) []string {
+	var names []string
+	if err := db.Select(&names, "SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? ORDER BY name", table); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestMaterializeFunction(t *testing.T) {
+	db, err := sqlx.Open("sqlite3_materialize", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	db.MustExec("CREATE TABLE procs (pid INTEGER, name TEXT)")
+	db.MustExec("INSERT INTO procs VALUES (1, 'init'), (42, 'sshd'), (99, 'bash')")
+
+	var n int
+	if err := db.Get(&n, "SELECT vtab_materialize('procs', 'snapshot')"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"snapshot_pid"}, indexes(t, db, "snapshot"))
+
+	var name string
+	if err := db.Get(&name, "SELECT name FROM snapshot WHERE pid = 42"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "sshd", name)
+
+	// a source that isn't a known module is materialized without indexes, and its args are bound
+	if err := db.Get(&n, "SELECT vtab_materialize('json_each', 'temp.items', '[1, 2, 3]')"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, n)
+	var sum int
+	if err := db.Get(&sum, "SELECT sum(value) FROM temp.items"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 6, sum)
+
+	for _, source := range []string{
+		"(SELECT * FROM procs WHERE pid > 1)",
+		"procs; DROP TABLE procs",
+	} {
+		assert.Error(t, db.Get(&n, "SELECT vtab_materialize(?, 'others')", source), source)
+	}
+	assert.Error(t, db.Get(&n, "SELECT vtab_materialize('procs', 'x; DROP TABLE procs')"))
+	if err := db.Get(&n, "SELECT count(*) FROM procs"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, n)
+}
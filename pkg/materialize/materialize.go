@@ -0,0 +1,140 @@
+// Package materialize snapshots a virtual table (or any table or table-valued function) into a real table, with
+// indexes on the columns its module can filter by, for repeated analysis without rescanning an expensive source:
+//
+//	n, err := materialize.Materialize(ctx, db, "procs", "procs_snapshot", vtab.ModuleColumns(procsModule))
+//
+// or from SQL, once the Register func of package gosqlite3 has added the vtab_materialize function to a
+// go-sqlite3 connection:
+//
+//	SELECT vtab_materialize('procs', 'procs_snapshot')
+//	SELECT vtab_materialize('series', 'temp.numbers', 0, 100, 1)
+package materialize
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/augmentable-dev/vtab"
+)
+
+// Execer runs statements, such as a *sql.DB, *sql.Conn or *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+// name is a table name, optionally qualified by the name of a schema (such as temp or an attached database)
+var name = regexp.MustCompile(`^(?:([A-Za-z_][A-Za-z0-9_]*)\.)?([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// sourceName returns the quoted name of source, which must be a (possibly schema-qualified) name, as SQL
+func sourceName(source string) (string, error) {
+	m := name.FindStringSubmatch(source)
+	if m == nil {
+		return "", fmt.Errorf("invalid source %q, it must be the name of a table or table-valued function", source)
+	}
+	return qualified(m[1], m[2]), nil
+}
+
+// targetName returns the schema (if any) and the table of target, such as temp and snapshot of temp.snapshot
+func targetName(target string) (schema, table string, err error) {
+	m := name.FindStringSubmatch(target)
+	if m == nil {
+		return "", "", fmt.Errorf("invalid target %q, it must be the name of a table", target)
+	}
+	return m[1], m[2], nil
+}
+
+// qualified returns the quoted name of table in schema (if any)
+func qualified(schema, table string) string {
+	if schema == "" {
+		return quote(table)
+	}
+	return quote(schema) + "." + quote(table)
+}
+
+// statement is an SQL statement, with the values of its parameters
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+// statements returns the statements that materialize source (a quoted name) into table of schema, a table
+// created (with the columns of source) if it doesn't exist, and indexed on each of the columns that declare
+// Filters. Hidden columns, such as the arguments of a table-valued function, aren't materialized. args, if any,
+// are bound to the arguments of source, a table-valued function. The final statement copies the rows.
+func statements(source, schema, table string, columns []vtab.Column, args []interface{}) (setup []statement, insert statement) {
+	if len(args) > 0 {
+		source += "(" + strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ") + ")"
+	}
+	target := qualified(schema, table)
+	setup = []statement{
+		{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS SELECT * FROM %s WHERE 0", target, source), args},
+	}
+	for _, col := range columns {
+		if col.Hidden || len(col.Filters) == 0 {
+			continue
+		}
+		// the index is created in the schema of its table, which it names unqualified
+		setup = append(setup, statement{query: fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			qualified(schema, table+"_"+col.Name), quote(table), quote(col.Name))})
+	}
+	setup = append(setup, statement{query: fmt.Sprintf("DELETE FROM %s", target)})
+	return setup, statement{fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", target, source), args}
+}
+
+// Materialize replaces the rows of the table target with the rows of source, the name of a table or of a
+// table-valued function (such as series) called with args, streaming them from one to the other, and returns
+// the number of rows copied. Either name may be qualified by a schema, as in temp.snapshot. target is created if
+// it doesn't exist, with an index on each of the columns that declare Filters, see vtab.ModuleColumns. Pass a
+// *sql.Tx to replace the rows atomically. The table is created on the connection the statements run on, so to
+// materialize a table of a module registered on each connection into an in-memory database, db must have a
+// single connection.
+func Materialize(ctx context.Context, db Execer, source, target string, columns []vtab.Column, args ...interface{}) (int64, error) {
+	src, err := sourceName(source)
+	if err != nil {
+		return 0, err
+	}
+	schema, table, err := targetName(target)
+	if err != nil {
+		return 0, err
+	}
+
+	setup, insert := statements(src, schema, table, columns, args)
+	for _, stmt := range setup {
+		if _, err := db.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return 0, fmt.Errorf("materialize %s: %w", target, err)
+		}
+	}
+	res, err := db.ExecContext(ctx, insert.query, insert.args...)
+	if err != nil {
+		return 0, fmt.Errorf("materialize %s: %w", target, err)
+	}
+	return res.RowsAffected()
+}
+
+// Refresh materializes source, called with args, into target (see Materialize) every interval, until ctx is
+// done, reporting each failure to onError (if it's not nil). The first refresh is made after the first interval.
+func Refresh(ctx context.Context, db Execer, source, target string, columns []vtab.Column, interval time.Duration, onError func(error), args ...interface{}) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %s, it must be positive", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := Materialize(ctx, db, source, target, columns, args...); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package materialize
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+var procCols = []vtab.Column{
+	{Name: "pid", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	{Name: "name", Type: "TEXT"},
+	{Name: "host", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+}
+
+// procsModule stands in for the module of the procs table, which the tests create as a plain table
+var procsModule = vtab.NewTableFunc("procs", procCols, func([]*vtab.Constraint, []*sqlite.OrderBy) (vtab.Iterator, error) {
+	return nil, io.EOF
+})
+
+func open(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	db.MustExec("CREATE TABLE procs (pid INTEGER, name TEXT)")
+	db.MustExec("INSERT INTO procs VALUES (1, 'init'), (42, 'sshd'), (99, 'bash')")
+	return db
+}
+
+func indexes(t *testing.T, db *sqlx.DB, table string) []string {
+	var names []string
+	if err := db.Select(&names, "SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? ORDER BY name", table); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestMaterialize(t *testing.T) {
+	db := open(t)
+
+	n, err := Materialize(context.Background(), db, "procs", "procs_snapshot", vtab.ModuleColumns(procsModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, []string{"procs_snapshot_pid"}, indexes(t, db, "procs_snapshot"))
+
+	// materializing again replaces the rows
+	db.MustExec("DELETE FROM procs WHERE pid = 99")
+	n, err = Materialize(context.Background(), db, "procs", "procs_snapshot", vtab.ModuleColumns(procsModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(2), n)
+
+	var names []string
+	if err := db.Select(&names, "SELECT name FROM procs_snapshot ORDER BY pid"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"init", "sshd"}, names)
+}
+
+func TestMaterializeTemp(t *testing.T) {
+	db := open(t)
+
+	if _, err := Materialize(context.Background(), db, "main.procs", "temp.snapshot", vtab.ModuleColumns(procsModule)); err != nil {
+		t.Fatal(err)
+	}
+	var schema []string
+	if err := db.Select(&schema, "SELECT type || ' ' || name FROM temp.sqlite_master ORDER BY name"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"table snapshot", "index snapshot_pid"}, schema)
+	assert.Empty(t, indexes(t, db, "snapshot"), "nothing should be created in main")
+}
+
+func TestStatements(t *testing.T) {
+	setup, insert := statements(`"series"`, "temp", "numbers", []vtab.Column{
+		{Name: "value", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	}, []interface{}{0, 10})
+	assert.Equal(t, []statement{
+		{`CREATE TABLE IF NOT EXISTS "temp"."numbers" AS SELECT * FROM "series"(?, ?) WHERE 0`, []interface{}{0, 10}},
+		{query: `CREATE INDEX IF NOT EXISTS "temp"."numbers_value" ON "numbers" ("value")`},
+		{query: `DELETE FROM "temp"."numbers"`},
+	}, setup)
+	assert.Equal(t, statement{`INSERT INTO "temp"."numbers" SELECT * FROM "series"(?, ?)`, []interface{}{0, 10}}, insert)
+
+	for _, name := range []string{"", "a b", "a.b.c", "x)--", `"quoted"`} {
+		_, err := sourceName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	db := open(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var errs int32
+	done := make(chan error)
+	go func() {
+		done <- Refresh(ctx, db, "procs", "refreshed", nil, 10*time.Millisecond, func(error) { atomic.AddInt32(&errs, 1) })
+	}()
+
+	assert.Eventually(t, func() bool {
+		var n int
+		return db.Get(&n, "SELECT count(*) FROM refreshed") == nil && n == 3
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&errs))
+
+	assert.Error(t, Refresh(context.Background(), db, "procs", "refreshed", nil, 0, nil))
+}
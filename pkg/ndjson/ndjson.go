@@ -0,0 +1,204 @@
+// Package ndjson provides a virtual table module for reading JSON Lines (NDJSON) files,
+// with each column extracted from a line by a JSON path:
+//
+//	CREATE VIRTUAL TABLE logs USING vtab_ndjson(path='app.log', cols='ts:$.time:INTEGER,msg:$.message,user:$.ctx.user')
+//
+// A path of '-' reads from stdin. Equality constraints of text on columns without a type are checked against
+// the raw text of each line before it's parsed, so lines that can't match are skipped cheaply.
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/augmentable-dev/vtab/internal/jsonpath"
+	"go.riyazali.net/sqlite"
+)
+
+// column is a single column of the cols argument
+type column struct {
+	name string
+	path jsonpath.Path
+	typ  string
+}
+
+// parseColumns parses a column spec of comma separated name:path[:type] entries
+func parseColumns(spec string) ([]*column, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, errors.New("cols is required")
+	}
+
+	var columns []*column
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid column %q, expected name:path[:type]", entry)
+		}
+
+		path, err := jsonpath.Parse(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		col := &column{name: parts[0], path: path}
+		if len(parts) == 3 {
+			col.typ = strings.ToUpper(parts[2])
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// NewModule returns the vtab_ndjson module, for use with CREATE VIRTUAL TABLE
+func NewModule() sqlite.Module {
+	return vtab.NewModule("vtab_ndjson", func(args []string) ([]vtab.Column, vtab.GetIteratorFunc, error) {
+		parsed := vtab.ParseArgs(args)
+		path := parsed["path"]
+		if path == "" {
+			return nil, nil, errors.New("a path is required")
+		}
+
+		cols, err := parseColumns(parsed["cols"])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		columns := make([]vtab.Column, len(cols))
+		for c, col := range cols {
+			columns[c] = vtab.Column{Name: col.name, Type: col.typ, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}}
+		}
+
+		return columns, func(constraints []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+			return newIterator(path, cols, constraints)
+		}, nil
+	})
+}
+
+type iter struct {
+	reader  io.ReadCloser
+	scanner *bufio.Scanner
+	columns []*column
+	// needles are the raw text each line (without escapes) must contain to possibly satisfy the EQ constraints
+	needles [][]byte
+}
+
+func newIterator(path string, columns []*column, constraints []*vtab.Constraint) (*iter, error) {
+	var r io.ReadCloser = io.NopCloser(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var needles [][]byte
+	for _, constraint := range constraints {
+		if needle := needle(columns[constraint.ColIndex], constraint.Value); needle != nil {
+			needles = append(needles, needle)
+		}
+	}
+
+	return &iter{r, scanner, columns, needles}, nil
+}
+
+// needle returns the text a line must contain for a field of col to equal v, or nil if there's none.
+// Only text is looked for, JSON-encoded (without quotes), in columns without a type: SQLite compares
+// other values, and values of columns with an affinity, after converting them (as with JSON's true,
+// which is 1, or 1e1, which is 10), and numbers can be written in many ways. Lines with escapes are
+// always parsed, as any character of a string can be escaped.
+func needle(col *column, v *sqlite.Value) []byte {
+	if v.Type() != sqlite.SQLITE_TEXT || !noAffinity(col.typ) {
+		return nil
+	}
+	b, err := json.Marshal(v.Text())
+	if err != nil || bytes.ContainsRune(b, '\\') {
+		return nil
+	}
+	return b[1 : len(b)-1]
+}
+
+// noAffinity returns whether a column of type typ has no affinity (BLOB), by SQLite's rules
+func noAffinity(typ string) bool {
+	for _, other := range []string{"INT", "CHAR", "CLOB", "TEXT"} {
+		if strings.Contains(typ, other) {
+			return false
+		}
+	}
+	return typ == "" || strings.Contains(typ, "BLOB")
+}
+
+func (i *iter) Next() (vtab.Row, error) {
+scan:
+	for i.scanner.Scan() {
+		line := i.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if bytes.IndexByte(line, '\\') < 0 {
+			for _, needle := range i.needles {
+				if !bytes.Contains(line, needle) {
+					continue scan
+				}
+			}
+		}
+
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		return &row{doc, i.columns}, nil
+	}
+	if err := i.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (i *iter) Close() error {
+	return i.reader.Close()
+}
+
+type row struct {
+	doc     interface{}
+	columns []*column
+}
+
+func (r *row) Column(ctx vtab.Context, c int) error {
+	v, ok := r.columns[c].path.Extract(r.doc)
+	if !ok {
+		ctx.ResultNull()
+		return nil
+	}
+	return jsonpath.Result(ctx, v)
+}
+
+// Modules returns the vtab_ndjson module, as created by Register
+func Modules() []*vtab.ModuleInfo {
+	return []*vtab.ModuleInfo{
+		{Name: "vtab_ndjson", Module: NewModule(), ReadOnly: true},
+	}
+}
+
+func init() {
+	for _, info := range Modules() {
+		vtab.DefaultRegistry.Add(info)
+	}
+}
+
+// Register registers the vtab_ndjson module with api. It's also added to vtab.DefaultRegistry.
+func Register(api *sqlite.ExtensionApi) error {
+	return vtab.CreateModules(api, Modules())
+}
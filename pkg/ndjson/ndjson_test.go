@@ -0,0 +1,128 @@
+package ndjson
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := Register(api); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+const logs = `{"time": 1, "level": "info", "message": "starting", "ctx": {"user": "alice"}}
+{"time": 2, "level": "warn", "message": "slow request", "ctx": {"user": "bob", "tags": ["a", "b"]}}
+
+{"time": 3, "level": "info", "message": "done"}
+`
+
+func TestNDJSONModule(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(logs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`create virtual table logs using vtab_ndjson(path='%s', cols='ts:$.time:INTEGER,level:$.level,msg:$.message,user:$.ctx.user,tag:$.ctx.tags[1]')`, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []struct {
+		TS    int            `db:"ts"`
+		Level string         `db:"level"`
+		Msg   string         `db:"msg"`
+		User  sql.NullString `db:"user"`
+		Tag   sql.NullString `db:"tag"`
+	}
+	err = db.Select(&contents, "select * from logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, len(contents))
+	assert.Equal(t, "alice", contents[0].User.String)
+	assert.Equal(t, "b", contents[1].Tag.String)
+	assert.False(t, contents[2].User.Valid)
+
+	var msgs []string
+	err = db.Select(&msgs, "select msg from logs where level = 'info'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"starting", "done"}, msgs)
+}
+
+func TestNDJSONModuleInvalidCols(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`create virtual table logs using vtab_ndjson(path='-', cols='ts')`)
+	assert.Error(t, err)
+}
+
+const flags = `{"id": 1, "flag": true, "n": 10, "name": "café", "tag": "x"}
+{"id": 2, "flag": false, "n": 1e1, "name": "caf\u00e9", "tag": "y"}
+{"id": 3, "flag": 1, "n": 10.0, "name": "cafe", "tag": "x"}
+`
+
+func TestNDJSONModuleEquivalentValues(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	path := filepath.Join(t.TempDir(), "flags.log")
+	if err := os.WriteFile(path, []byte(flags), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`create virtual table flags using vtab_ndjson(path='%s', cols='id:$.id,flag:$.flag,n:$.n,name:$.name,tag:$.tag,label:$.tag:TEXT')`, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lines are only skipped before they're parsed if they can't hold the value, however it's written
+	for _, tt := range []struct {
+		where string
+		ids   []int
+	}{
+		{"flag = 1", []int{1, 3}},
+		{"flag = 0", []int{2}},
+		{"n = 10", []int{1, 2, 3}},
+		{"name = 'café'", []int{1, 2}},
+		{"tag = 'x'", []int{1, 3}},
+		{"label = 'y'", []int{2}},
+	} {
+		var ids []int
+		err = db.Select(&ids, "select id from flags where "+tt.where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tt.ids, ids, tt.where)
+	}
+}
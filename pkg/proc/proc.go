@@ -0,0 +1,378 @@
+// Package proc provides tables of the processes and sockets of a Linux system, parsed from /proc:
+//
+//	SELECT pid, cmdline FROM procs WHERE name LIKE 'postgres%'
+//	SELECT fd, target FROM proc_fds WHERE pid = 1234
+//	SELECT value FROM proc_env WHERE pid = 1234 AND name = 'PATH'
+//	SELECT * FROM net_tcp WHERE state = 'LISTEN'
+//
+// An equality constraint on pid reads only the /proc/<pid> directory of that process. Every table reads from
+// an fs.FS rooted at /proc, so that parsing can be tested against fixture trees.
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// ReadLinkFS is an fs.FS that can read the target of symbolic links, as needed for proc_fds
+type ReadLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// dirFS is the local /proc, with support for symbolic links
+type dirFS struct {
+	fs.FS
+	root string
+}
+
+func (d *dirFS) ReadLink(name string) (string, error) {
+	return os.Readlink(path.Join(d.root, name))
+}
+
+// Root returns the fs.FS of the local /proc
+func Root() fs.FS {
+	return &dirFS{os.DirFS("/proc"), "/proc"}
+}
+
+// readLink reads the target of a link in fsys. For an fsys that doesn't support links (such as fstest.MapFS)
+// the contents of the file are taken as the target.
+func readLink(fsys fs.FS, name string) (string, error) {
+	if rl, ok := fsys.(ReadLinkFS); ok {
+		return rl.ReadLink(name)
+	}
+	b, err := fs.ReadFile(fsys, name)
+	return string(b), err
+}
+
+var pidFilters = []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}
+
+// pids returns the process ids to read, just the one if there's an EQ constraint on the pid column
+func pids(fsys fs.FS, constraints []*vtab.Constraint, pidCol int) ([]int, error) {
+	for _, constraint := range constraints {
+		if constraint.ColIndex == pidCol && constraint.Op == sqlite.INDEX_CONSTRAINT_EQ {
+			return []int{constraint.Value.Int()}, nil
+		}
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// gone reports whether err means that a process has exited, or can't be inspected,
+// in which case it's skipped rather than failing the query
+func gone(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
+
+// process is a single process, as parsed from /proc/<pid>/status and /proc/<pid>/cmdline
+type process struct {
+	pid     int
+	ppid    int
+	name    string
+	state   string
+	uid     int
+	threads int
+	rss     int64
+	cmdline string
+}
+
+// parseProcess parses the process with the given pid
+func parseProcess(fsys fs.FS, pid int) (*process, error) {
+	dir := strconv.Itoa(pid)
+	status, err := fs.ReadFile(fsys, path.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &process{pid: pid}
+	s := bufio.NewScanner(bytes.NewReader(status))
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "Name":
+			p.name = strings.TrimSpace(value)
+		case "State":
+			p.state = fields[0]
+		case "PPid":
+			p.ppid, _ = strconv.Atoi(fields[0])
+		case "Uid":
+			p.uid, _ = strconv.Atoi(fields[0])
+		case "Threads":
+			p.threads, _ = strconv.Atoi(fields[0])
+		case "VmRSS":
+			kb, _ := strconv.ParseInt(fields[0], 10, 64)
+			p.rss = kb * 1024
+		}
+	}
+
+	// kernel threads have an empty cmdline, and a process may exit between reads
+	if cmdline, err := fs.ReadFile(fsys, path.Join(dir, "cmdline")); err == nil {
+		p.cmdline = strings.TrimSpace(strings.ReplaceAll(string(bytes.TrimRight(cmdline, "\x00")), "\x00", " "))
+	}
+	return p, nil
+}
+
+var procsCols = []vtab.Column{
+	{Name: "pid", Type: "INTEGER", Filters: pidFilters, OrderBy: vtab.ASC},
+	{Name: "ppid", Type: "INTEGER"},
+	{Name: "name", Type: "TEXT"},
+	{Name: "state", Type: "TEXT"},
+	{Name: "uid", Type: "INTEGER"},
+	{Name: "threads", Type: "INTEGER"},
+	{Name: "rss", Type: "INTEGER"},
+	{Name: "cmdline", Type: "TEXT"},
+}
+
+// NewProcsModule returns the procs table over fsys, a /proc tree
+func NewProcsModule(fsys fs.FS) sqlite.Module {
+	return vtab.NewTableFunc("procs", procsCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		pids, err := pids(fsys, constraints, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &procsIter{fsys, pids, -1}, nil
+	})
+}
+
+type procsIter struct {
+	fsys    fs.FS
+	pids    []int
+	current int
+}
+
+func (i *procsIter) Next() (vtab.Row, error) {
+	for i.current++; i.current < len(i.pids); i.current++ {
+		p, err := parseProcess(i.fsys, i.pids[i.current])
+		if err != nil {
+			if gone(err) {
+				continue
+			}
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, io.EOF
+}
+
+func (p *process) Column(ctx vtab.Context, c int) error {
+	switch procsCols[c].Name {
+	case "pid":
+		ctx.ResultInt(p.pid)
+	case "ppid":
+		ctx.ResultInt(p.ppid)
+	case "name":
+		ctx.ResultText(p.name)
+	case "state":
+		ctx.ResultText(p.state)
+	case "uid":
+		ctx.ResultInt(p.uid)
+	case "threads":
+		ctx.ResultInt(p.threads)
+	case "rss":
+		ctx.ResultInt64(p.rss)
+	case "cmdline":
+		ctx.ResultText(p.cmdline)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+var fdsCols = []vtab.Column{
+	{Name: "pid", Type: "INTEGER", Filters: pidFilters, OrderBy: vtab.ASC},
+	{Name: "fd", Type: "INTEGER"},
+	{Name: "target", Type: "TEXT"},
+}
+
+// NewFdsModule returns the proc_fds table over fsys, a /proc tree
+func NewFdsModule(fsys fs.FS) sqlite.Module {
+	return vtab.NewTableFunc("proc_fds", fdsCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		pids, err := pids(fsys, constraints, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &fdsIter{fsys: fsys, pids: pids, current: -1}, nil
+	})
+}
+
+type fdsIter struct {
+	fsys    fs.FS
+	pids    []int
+	current int
+	fds     []int
+	fd      int
+	target  string
+}
+
+func (i *fdsIter) Next() (vtab.Row, error) {
+	for {
+		for len(i.fds) > 0 {
+			i.fd, i.fds = i.fds[0], i.fds[1:]
+			target, err := readLink(i.fsys, path.Join(strconv.Itoa(i.pids[i.current]), "fd", strconv.Itoa(i.fd)))
+			if err != nil {
+				// the descriptor may have been closed since it was listed
+				if gone(err) {
+					continue
+				}
+				return nil, err
+			}
+			i.target = target
+			return i, nil
+		}
+
+		i.current++
+		if i.current >= len(i.pids) {
+			return nil, io.EOF
+		}
+
+		entries, err := fs.ReadDir(i.fsys, path.Join(strconv.Itoa(i.pids[i.current]), "fd"))
+		if err != nil {
+			if gone(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if fd, err := strconv.Atoi(entry.Name()); err == nil {
+				i.fds = append(i.fds, fd)
+			}
+		}
+		sort.Ints(i.fds)
+	}
+}
+
+func (i *fdsIter) Column(ctx vtab.Context, c int) error {
+	switch fdsCols[c].Name {
+	case "pid":
+		ctx.ResultInt(i.pids[i.current])
+	case "fd":
+		ctx.ResultInt(i.fd)
+	case "target":
+		ctx.ResultText(i.target)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+var envCols = []vtab.Column{
+	{Name: "pid", Type: "INTEGER", Filters: pidFilters, OrderBy: vtab.ASC},
+	{Name: "name", Type: "TEXT"},
+	{Name: "value", Type: "TEXT"},
+}
+
+// NewEnvModule returns the proc_env table over fsys, a /proc tree
+func NewEnvModule(fsys fs.FS) sqlite.Module {
+	return vtab.NewTableFunc("proc_env", envCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		pids, err := pids(fsys, constraints, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &envIter{fsys: fsys, pids: pids, current: -1}, nil
+	})
+}
+
+type envIter struct {
+	fsys    fs.FS
+	pids    []int
+	current int
+	vars    []string
+	name    string
+	value   string
+}
+
+func (i *envIter) Next() (vtab.Row, error) {
+	for {
+		for len(i.vars) > 0 {
+			v := i.vars[0]
+			i.vars = i.vars[1:]
+			if v == "" {
+				continue
+			}
+			i.name, i.value, _ = strings.Cut(v, "=")
+			return i, nil
+		}
+
+		i.current++
+		if i.current >= len(i.pids) {
+			return nil, io.EOF
+		}
+
+		environ, err := fs.ReadFile(i.fsys, path.Join(strconv.Itoa(i.pids[i.current]), "environ"))
+		if err != nil {
+			if gone(err) {
+				continue
+			}
+			return nil, err
+		}
+		i.vars = strings.Split(string(environ), "\x00")
+	}
+}
+
+func (i *envIter) Column(ctx vtab.Context, c int) error {
+	switch envCols[c].Name {
+	case "pid":
+		ctx.ResultInt(i.pids[i.current])
+	case "name":
+		ctx.ResultText(i.name)
+	case "value":
+		ctx.ResultText(i.value)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// Modules returns the procs, proc_fds, proc_env and net_tcp tables over the local /proc, as created by Register
+func Modules() []*vtab.ModuleInfo {
+	root := Root()
+	return []*vtab.ModuleInfo{
+		{Name: "procs", Module: NewProcsModule(root), EponymousOnly: true, ReadOnly: true},
+		{Name: "proc_fds", Module: NewFdsModule(root), EponymousOnly: true, ReadOnly: true},
+		{Name: "proc_env", Module: NewEnvModule(root), EponymousOnly: true, ReadOnly: true},
+		{Name: "net_tcp", Module: NewTCPModule(root), EponymousOnly: true, ReadOnly: true},
+	}
+}
+
+func init() {
+	for _, info := range Modules() {
+		vtab.DefaultRegistry.Add(info)
+	}
+}
+
+// Register registers the procs, proc_fds, proc_env and net_tcp tables over the local /proc with api. They're also
+// added to vtab.DefaultRegistry.
+func Register(api *sqlite.ExtensionApi) error {
+	return vtab.CreateModules(api, Modules())
+}
@@ -0,0 +1,189 @@
+package proc
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+// link is a symbolic link in a fixture tree
+func link(target string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(target), Mode: fs.ModeSymlink | 0o777}
+}
+
+var fixture = fstest.MapFS{
+	"1/status":  {Data: []byte("Name:\tinit\nState:\tS (sleeping)\nPPid:\t0\nUid:\t0\t0\t0\t0\nThreads:\t1\nVmRSS:\t  1024 kB\n")},
+	"1/cmdline": {Data: []byte("/sbin/init\x00splash\x00")},
+	"1/environ": {Data: []byte("HOME=/\x00TERM=linux\x00")},
+	"1/fd/0":    link("/dev/null"),
+	"1/fd/1":    link("/dev/console"),
+
+	"4242/status":  {Data: []byte("Name:\tpostgres\nState:\tR (running)\nPPid:\t1\nUid:\t999\t999\t999\t999\nThreads:\t4\nVmRSS:\t  2048 kB\n")},
+	"4242/cmdline": {Data: []byte("postgres\x00-D\x00/var/lib/postgresql\x00")},
+	"4242/environ": {Data: []byte("PGDATA=/var/lib/postgresql\x00")},
+	"4242/fd/3":    link("socket:[12345]"),
+
+	"self": link("4242"),
+
+	"net/tcp": {Data: []byte(strings.Join([]string{
+		"  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode",
+		"   0: 0100007F:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 12345 1 0000000000000000 100 0 0 10 0",
+		"   1: 0100007F:A1B2 0100007F:1538 01 00000000:00000000 00:00000000 00000000  1000        0 23456 1 0000000000000000 20 4 30 10 -1",
+	}, "\n"))},
+	"net/tcp6": {Data: []byte(strings.Join([]string{
+		"  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode",
+		"   0: 00000000000000000000000001000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 34567 1 0000000000000000 100 0 0 10 0",
+	}, "\n"))},
+}
+
+// ipv4Fixture is a /proc tree without net/tcp6, as with IPv6 disabled
+var ipv4Fixture = fstest.MapFS{"net/tcp": fixture["net/tcp"]}
+
+// brokenFixture is a /proc tree of an unexpected net/tcp format
+var brokenFixture = fstest.MapFS{"net/tcp": {Data: []byte("header\n0: 0100007F 00000000:0000 0A 0 0 0 0 0 0 0\n")}}
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		for _, m := range []struct {
+			name   string
+			module sqlite.Module
+		}{
+			{"procs", NewProcsModule(fixture)},
+			{"proc_fds", NewFdsModule(fixture)},
+			{"proc_env", NewEnvModule(fixture)},
+			{"net_tcp", NewTCPModule(fixture)},
+			{"net_tcp_ipv4", NewTCPModule(ipv4Fixture)},
+			{"net_tcp_broken", NewTCPModule(brokenFixture)},
+		} {
+			if err := api.CreateModule(m.name, m.module, sqlite.EponymousOnly(true), sqlite.ReadOnly(true)); err != nil {
+				return sqlite.SQLITE_ERROR, err
+			}
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestParseProcess(t *testing.T) {
+	p, err := parseProcess(fixture, 4242)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &process{
+		pid: 4242, ppid: 1, name: "postgres", state: "R", uid: 999, threads: 4, rss: 2048 * 1024,
+		cmdline: "postgres -D /var/lib/postgresql",
+	}, p)
+}
+
+func TestParseAddress(t *testing.T) {
+	addr, port, err := parseAddress("0100007F:1538")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "127.0.0.1", addr)
+	assert.Equal(t, 5432, port)
+
+	addr, port, err = parseAddress("00000000000000000000000001000000:0050")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "::1", addr)
+	assert.Equal(t, 80, port)
+}
+
+func TestProcs(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var pids []int
+	err = db.Select(&pids, "select pid from procs where name like 'postgres%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int{4242}, pids)
+
+	var names []string
+	err = db.Select(&names, "select name from procs where pid = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"init"}, names)
+
+	err = db.Select(&names, "select name from procs where pid = 999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, names)
+}
+
+func TestProcFdsAndEnv(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var targets []string
+	err = db.Select(&targets, "select target from proc_fds where pid = 1 order by fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"/dev/null", "/dev/console"}, targets)
+
+	var values []string
+	err = db.Select(&values, "select value from proc_env where pid = 4242 and name = 'PGDATA'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"/var/lib/postgresql"}, values)
+}
+
+func TestNetTCP(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var listening []struct {
+		Family string `db:"family"`
+		Addr   string `db:"local_address"`
+		Port   int    `db:"local_port"`
+	}
+	err = db.Select(&listening, "select family, local_address, local_port from net_tcp where state = 'LISTEN' order by local_port")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(listening))
+	assert.Equal(t, "::1", listening[0].Addr)
+	assert.Equal(t, 5432, listening[1].Port)
+}
+
+func TestNetTCPErrors(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.Get(&n, "select count(*) from net_tcp_ipv4"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, n)
+
+	if err := db.Get(&n, "select count(*) from net_tcp_broken"); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `invalid address "0100007F"`)
+	}
+}
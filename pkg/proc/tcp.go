@@ -0,0 +1,145 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// tcpStates are the names of the socket states in /proc/net/tcp, as in include/net/tcp_states.h
+var tcpStates = map[int64]string{
+	0x01: "ESTABLISHED", 0x02: "SYN_SENT", 0x03: "SYN_RECV", 0x04: "FIN_WAIT1", 0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT", 0x07: "CLOSE", 0x08: "CLOSE_WAIT", 0x09: "LAST_ACK", 0x0A: "LISTEN", 0x0B: "CLOSING",
+}
+
+// socket is a single line of /proc/net/tcp or /proc/net/tcp6
+type socket struct {
+	family     string
+	localAddr  string
+	localPort  int
+	remoteAddr string
+	remotePort int
+	state      string
+	uid        int
+	inode      int64
+}
+
+// parseAddress parses an address such as 0100007F:0050, with the IP in host (little-endian) byte order
+func parseAddress(s string) (string, int, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+
+	b, err := hex.DecodeString(ipHex)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	// the address is a sequence of 32-bit words, each in little-endian order
+	for w := 0; w < len(b); w += 4 {
+		b[w], b[w+1], b[w+2], b[w+3] = b[w+3], b[w+2], b[w+1], b[w]
+	}
+
+	port, err := strconv.ParseInt(portHex, 16, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", s)
+	}
+	return net.IP(b).String(), int(port), nil
+}
+
+// parseSockets parses the sockets of a /proc/net/tcp style file
+func parseSockets(r io.Reader, family string) ([]*socket, error) {
+	var sockets []*socket
+	s := bufio.NewScanner(r)
+	for line := 0; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		// the first line is a header
+		if line == 0 || len(fields) < 10 {
+			continue
+		}
+
+		sock := &socket{family: family}
+		var err error
+		if sock.localAddr, sock.localPort, err = parseAddress(fields[1]); err != nil {
+			return nil, err
+		}
+		if sock.remoteAddr, sock.remotePort, err = parseAddress(fields[2]); err != nil {
+			return nil, err
+		}
+		state, err := strconv.ParseInt(fields[3], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state %q", fields[3])
+		}
+		sock.state = tcpStates[state]
+		sock.uid, _ = strconv.Atoi(fields[7])
+		sock.inode, _ = strconv.ParseInt(fields[9], 10, 64)
+		sockets = append(sockets, sock)
+	}
+	return sockets, s.Err()
+}
+
+var tcpCols = []vtab.Column{
+	{Name: "family", Type: "TEXT"},
+	{Name: "local_address", Type: "TEXT"},
+	{Name: "local_port", Type: "INTEGER"},
+	{Name: "remote_address", Type: "TEXT"},
+	{Name: "remote_port", Type: "INTEGER"},
+	{Name: "state", Type: "TEXT"},
+	{Name: "uid", Type: "INTEGER"},
+	{Name: "inode", Type: "INTEGER"},
+}
+
+// NewTCPModule returns the net_tcp table over fsys, a /proc tree, listing both IPv4 and IPv6 sockets
+func NewTCPModule(fsys fs.FS) sqlite.Module {
+	return vtab.NewSliceTableErr("net_tcp", tcpCols, func() ([]*socket, error) {
+		var sockets []*socket
+		for _, f := range []struct{ path, family string }{{"net/tcp", "tcp"}, {"net/tcp6", "tcp6"}} {
+			b, err := fs.ReadFile(fsys, f.path)
+			if f.family == "tcp6" && errors.Is(err, fs.ErrNotExist) {
+				// tcp6 is missing if IPv6 is disabled
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := parseSockets(bytes.NewReader(b), f.family)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.path, err)
+			}
+			sockets = append(sockets, parsed...)
+		}
+		return sockets, nil
+	}, func(ctx vtab.Context, sock *socket, c int) error {
+		switch tcpCols[c].Name {
+		case "family":
+			ctx.ResultText(sock.family)
+		case "local_address":
+			ctx.ResultText(sock.localAddr)
+		case "local_port":
+			ctx.ResultInt(sock.localPort)
+		case "remote_address":
+			ctx.ResultText(sock.remoteAddr)
+		case "remote_port":
+			ctx.ResultInt(sock.remotePort)
+		case "state":
+			ctx.ResultText(sock.state)
+		case "uid":
+			ctx.ResultInt(sock.uid)
+		case "inode":
+			ctx.ResultInt64(sock.inode)
+		default:
+			return fmt.Errorf("unknown column")
+		}
+		return nil
+	})
+}
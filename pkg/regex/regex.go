@@ -0,0 +1,261 @@
+// Package regex provides virtual table modules for matching regular expressions (in Go's RE2 syntax).
+//
+// regexp_matches is a table-valued function producing a row for each match of a pattern in some text:
+//
+//	SELECT matched, match_start, match_end, captures FROM regexp_matches('a1 b22 c333', '([a-z])(\d+)')
+//
+// regexp_log splits a file into rows of the named capture groups of a pattern, one row per matching line:
+//
+//	CREATE VIRTUAL TABLE access USING regexp_log(path='access.log', pattern='^(?P<ip>\S+) \S+ \S+ \[(?P<ts>[^\]]+)\]')
+//
+// Compiled patterns are cached, so repeated queries (and correlated subqueries) don't recompile them.
+package regex
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// maxCachedPatterns bounds the number of compiled patterns kept in the cache
+const maxCachedPatterns = 128
+
+// maxLineSize is the size of the longest line regexp_log reads
+const maxLineSize = 16 * 1024 * 1024
+
+var cache = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// compile returns the compiled pattern, from the cache if it's been compiled before
+func compile(pattern string) (*regexp.Regexp, error) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	if re, ok := cache.patterns[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// rather than tracking usage, the cache is simply emptied once it's full
+	if len(cache.patterns) >= maxCachedPatterns {
+		cache.patterns = make(map[string]*regexp.Regexp)
+	}
+	cache.patterns[pattern] = re
+	return re, nil
+}
+
+var matchesCols = []vtab.Column{
+	{Name: "matched", Type: "TEXT"},
+	{Name: "match_start", Type: "INTEGER"},
+	{Name: "match_end", Type: "INTEGER"},
+	{Name: "captures", Type: "TEXT"},
+	{Name: "text", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "pattern", Type: "TEXT", Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+}
+
+// NewMatchesFunc returns the regexp_matches(text, pattern) table-valued function. match_start and match_end
+// are 1-based character offsets (end exclusive) so that substr(text, match_start, match_end - match_start)
+// is the match, and captures is a JSON array of the capture groups (null for those that didn't participate).
+func NewMatchesFunc() sqlite.Module {
+	return vtab.NewTableFunc("regexp_matches", matchesCols, func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+		var text, pattern string
+		hasPattern := false
+		for _, constraint := range constraints {
+			switch matchesCols[constraint.ColIndex].Name {
+			case "text":
+				text = constraint.Value.Text()
+			case "pattern":
+				pattern, hasPattern = constraint.Value.Text(), !constraint.Value.IsNil()
+			}
+		}
+		if !hasPattern {
+			return nil, vtab.ColumnError(sqlite.SQLITE_ERROR, "pattern", errors.New("a pattern is required"))
+		}
+
+		re, err := compile(pattern)
+		if err != nil {
+			return nil, vtab.ColumnError(sqlite.SQLITE_ERROR, "pattern", err)
+		}
+
+		return &matchesIter{text: text, pattern: pattern, matches: re.FindAllStringSubmatchIndex(text, -1), current: -1}, nil
+	})
+}
+
+type matchesIter struct {
+	text    string
+	pattern string
+	matches [][]int
+	current int
+}
+
+func (i *matchesIter) Next() (vtab.Row, error) {
+	i.current++
+	if i.current >= len(i.matches) {
+		return nil, io.EOF
+	}
+	return i, nil
+}
+
+func (i *matchesIter) Column(ctx vtab.Context, c int) error {
+	match := i.matches[i.current]
+	switch matchesCols[c].Name {
+	case "matched":
+		ctx.ResultText(i.text[match[0]:match[1]])
+	case "match_start":
+		ctx.ResultInt(utf8.RuneCountInString(i.text[:match[0]]) + 1)
+	case "match_end":
+		ctx.ResultInt(utf8.RuneCountInString(i.text[:match[1]]) + 1)
+	case "captures":
+		captures := make([]*string, 0, len(match)/2-1)
+		for g := 2; g < len(match); g += 2 {
+			if match[g] < 0 {
+				captures = append(captures, nil)
+				continue
+			}
+			capture := i.text[match[g]:match[g+1]]
+			captures = append(captures, &capture)
+		}
+		b, err := json.Marshal(captures)
+		if err != nil {
+			return err
+		}
+		ctx.ResultText(string(b))
+	case "text":
+		ctx.ResultText(i.text)
+	case "pattern":
+		ctx.ResultText(i.pattern)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// NewLogModule returns the regexp_log module, for use with CREATE VIRTUAL TABLE. The table has a line column
+// (the 1-based line number) followed by a column for each named capture group of the pattern argument,
+// which is NULL when its group doesn't take part in the match. Lines that don't match the pattern are skipped.
+// Groups can't be named line, nor share a name (ignoring case).
+func NewLogModule() sqlite.Module {
+	return vtab.NewModule("regexp_log", func(args []string) ([]vtab.Column, vtab.GetIteratorFunc, error) {
+		parsed := vtab.ParseArgs(args)
+		path := parsed["path"]
+		if path == "" {
+			return nil, nil, errors.New("a path is required")
+		}
+
+		if parsed["pattern"] == "" {
+			return nil, nil, errors.New("a pattern is required")
+		}
+		re, err := compile(parsed["pattern"])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		columns := []vtab.Column{{Name: "line", Type: "INTEGER"}}
+		groups := []int{-1}
+		names := map[string]bool{"line": true}
+		for g, name := range re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			if names[strings.ToLower(name)] {
+				return nil, nil, fmt.Errorf("the capture group %s clashes with another column", name)
+			}
+			names[strings.ToLower(name)] = true
+			columns = append(columns, vtab.Column{Name: name, Type: "TEXT"})
+			groups = append(groups, g)
+		}
+		if len(columns) == 1 {
+			return nil, nil, errors.New("the pattern has no named capture groups")
+		}
+
+		return columns, func(_ []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+			return &logIter{f, scanner, re, groups, 0, "", nil}, nil
+		}, nil
+	})
+}
+
+type logIter struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	re      *regexp.Regexp
+	groups  []int
+	line    int
+	text    string
+	// match holds the start and end of each group in text, -1 for groups not taking part in the match
+	match []int
+}
+
+func (i *logIter) Next() (vtab.Row, error) {
+	for i.scanner.Scan() {
+		i.line++
+		text := i.scanner.Text()
+		if match := i.re.FindStringSubmatchIndex(text); match != nil {
+			i.text, i.match = text, match
+			return i, nil
+		}
+	}
+	if err := i.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (i *logIter) Close() error {
+	return i.file.Close()
+}
+
+func (i *logIter) Column(ctx vtab.Context, c int) error {
+	if c == 0 {
+		ctx.ResultInt(i.line)
+		return nil
+	}
+	g := i.groups[c]
+	if start, end := i.match[2*g], i.match[2*g+1]; start >= 0 {
+		ctx.ResultText(i.text[start:end])
+	} else {
+		ctx.ResultNull()
+	}
+	return nil
+}
+
+// Modules returns the regexp_matches table-valued function and regexp_log module, as created by Register
+func Modules() []*vtab.ModuleInfo {
+	return []*vtab.ModuleInfo{
+		{Name: "regexp_matches", Module: NewMatchesFunc(), EponymousOnly: true, ReadOnly: true},
+		{Name: "regexp_log", Module: NewLogModule(), ReadOnly: true},
+	}
+}
+
+func init() {
+	for _, info := range Modules() {
+		vtab.DefaultRegistry.Add(info)
+	}
+}
+
+// Register registers the regexp_matches table-valued function and regexp_log module with api. They're also added
+// to vtab.DefaultRegistry.
+func Register(api *sqlite.ExtensionApi) error {
+	return vtab.CreateModules(api, Modules())
+}
@@ -0,0 +1,177 @@
+package regex
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := Register(api); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestCompileCache(t *testing.T) {
+	a, err := compile(`\d+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := compile(`\d+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Same(t, a, b)
+
+	_, err = compile(`(`)
+	assert.Error(t, err)
+}
+
+func TestRegexpMatches(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []struct {
+		Matched  string `db:"matched"`
+		Start    int    `db:"match_start"`
+		End      int    `db:"match_end"`
+		Captures string `db:"captures"`
+	}
+	err = db.Select(&contents, `select matched, match_start, match_end, captures from regexp_matches('é1 b22 c333', '([a-zé])(\d+)(x)?')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, len(contents))
+	assert.Equal(t, "é1", contents[0].Matched)
+	assert.Equal(t, 1, contents[0].Start)
+	assert.Equal(t, 3, contents[0].End)
+	assert.Equal(t, `["é","1",null]`, contents[0].Captures)
+	assert.Equal(t, "b22", contents[1].Matched)
+	assert.Equal(t, 4, contents[1].Start)
+}
+
+func TestRegexpMatchesInvalidPattern(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []string
+	err = db.Select(&contents, `select matched from regexp_matches('abc', '(')`)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "regexp_matches: pattern:")
+	}
+	for _, query := range []string{
+		`select matched from regexp_matches('abc')`,
+		`select matched from regexp_matches('abc', NULL)`,
+	} {
+		err = db.Select(&contents, query)
+		if assert.Error(t, err, query) {
+			assert.Contains(t, err.Error(), "regexp_matches: pattern: a pattern is required")
+		}
+	}
+}
+
+func TestRegexpLog(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	log := "10.0.0.1 GET /index.html 200\nnot a request\n10.0.0.2 POST /login 401\n"
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`create virtual table access using regexp_log(path='%s', pattern='^(?P<ip>\S+) (?P<method>[A-Z]+) (?P<path>\S+) (?P<status>\d+)$')`, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []struct {
+		Line   int    `db:"line"`
+		IP     string `db:"ip"`
+		Method string `db:"method"`
+		Status string `db:"status"`
+	}
+	err = db.Select(&contents, "select line, ip, method, status from access")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, len(contents))
+	assert.Equal(t, 3, contents[1].Line)
+	assert.Equal(t, "10.0.0.2", contents[1].IP)
+	assert.Equal(t, "401", contents[1].Status)
+}
+
+func TestRegexpLogGroups(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	path := filepath.Join(t.TempDir(), "orders.log")
+	log := "order 1 from alice\norder 2\n" + strings.Repeat("x", 100*1024) + "\norder 3 from bob\n"
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// groups named as keywords are columns, NULL when they don't take part in a match, and long lines are read
+	_, err = db.Exec(fmt.Sprintf(`create virtual table orders using regexp_log(path='%s', pattern='^order (?P<order>\d+)(?: from (?P<from>\w+))?$')`, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []struct {
+		Line  int            `db:"line"`
+		Order string         `db:"order"`
+		From  sql.NullString `db:"from"`
+	}
+	err = db.Select(&contents, `select line, "order", "from" from orders`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 3, len(contents)) {
+		assert.Equal(t, "alice", contents[0].From.String)
+		assert.False(t, contents[1].From.Valid)
+		assert.Equal(t, 4, contents[2].Line)
+		assert.Equal(t, "3", contents[2].Order)
+	}
+
+	for _, args := range []string{"path='%s'", "path='%s', pattern=''"} {
+		_, err = db.Exec(fmt.Sprintf(`create virtual table nopattern using regexp_log(`+args+`)`, path))
+		if assert.Error(t, err, args) {
+			assert.Contains(t, err.Error(), "a pattern is required")
+		}
+	}
+
+	for _, pattern := range []string{`(?P<line>\d+)`, `(?P<a>\d+) (?P<A>\d+)`} {
+		_, err = db.Exec(fmt.Sprintf(`create virtual table clash using regexp_log(path='%s', pattern='%s')`, path, pattern))
+		if assert.Error(t, err, pattern) {
+			assert.Contains(t, err.Error(), "clashes with another column")
+		}
+	}
+}
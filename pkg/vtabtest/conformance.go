@@ -0,0 +1,523 @@
+package vtabtest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/jmoiron/sqlx"
+)
+
+// Table is a table checked by Conformance
+type Table struct {
+	// From is the table expression queried, such as a table-valued function call (series(0, 100, 1))
+	// or the name of a table created by Setup
+	From string
+	// Setup are statements run before the table is queried, such as a CREATE VIRTUAL TABLE
+	Setup []string
+	// Columns are the columns filtered and ordered by, defaults to every (non-hidden) column
+	Columns []string
+	// Samples is the number of values of each column used in constraints, defaults to 3
+	Samples int
+}
+
+// Failure is a query whose results differ from the results expected from a full scan of the table
+type Failure struct {
+	Query string
+	// Problem describes the difference, and its likely cause
+	Problem string
+}
+
+func (f *Failure) String() string {
+	return fmt.Sprintf("%s\n\t%s", f.Query, f.Problem)
+}
+
+// Conformance checks the results of a battery of generated queries of a table against a full scan of it,
+// reporting each query with unexpected results as a test error. See Check.
+func Conformance(t *testing.T, db *sqlx.DB, table Table) {
+	t.Helper()
+
+	failures, err := Check(db, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range failures {
+		t.Errorf("%s: %s", table.From, f)
+	}
+}
+
+// Check runs a battery of generated queries of a table, with filters (=, !=, <, <=, >, >=, IS NULL, LIKE and
+// GLOB) on each column, ORDER BY each column and pair of columns in either direction, LIMIT, and joins on each
+// column, returning the queries whose results differ from the results of the same query evaluated in Go over
+// a full scan of the table. Such differences are usually a constraint that's marked OmitCheck but isn't
+// applied by the iterator, an early exit that ends a scan too soon, or an ORDER BY that's consumed but
+// not followed. The table is expected not to change while it's checked.
+func Check(db *sqlx.DB, table Table) ([]*Failure, error) {
+	c, err := newChecker(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := table.Samples
+	if samples <= 0 {
+		samples = 3
+	}
+	for col := range c.columns {
+		c.checkColumn(col, samples)
+	}
+	c.checkOrders()
+	return c.failures, nil
+}
+
+// value is a value of a row, as returned by SQLite's quote(), which is also its SQL literal
+type value string
+
+// parsed returns the value as a nil, int64, float64, string or []byte
+func (v value) parsed() interface{} {
+	s := string(v)
+	switch {
+	case s == "NULL":
+		return nil
+	case strings.HasPrefix(s, "'"):
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	case strings.HasPrefix(s, "X'"):
+		b, _ := hex.DecodeString(s[2 : len(s)-1])
+		return b
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+type row []value
+
+func (r row) key() string {
+	parts := make([]string, len(r))
+	for i, v := range r {
+		parts[i] = string(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// newChecker runs the Setup of table, and scans it
+func newChecker(db *sqlx.DB, table Table) (c *checker, err error) {
+	for _, stmt := range table.Setup {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := table.Columns
+	if columns == nil {
+		rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", table.From))
+		if err != nil {
+			return nil, err
+		}
+		columns, err = rows.Columns()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s has no columns", table.From)
+	}
+
+	c = &checker{db: db, from: table.From, columns: columns}
+	if c.all, err = c.query(c.sql("", "", "")); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type checker struct {
+	db       *sqlx.DB
+	from     string
+	columns  []string
+	all      []row
+	failures []*Failure
+}
+
+// sql returns a query of every column of the table (through quote()) with the given clauses
+func (c *checker) sql(where, orderBy, limit string) string {
+	quoted := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		quoted[i] = fmt.Sprintf("quote(%s)", vtab.QuoteIdent(col))
+	}
+	q := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), c.from)
+	if where != "" {
+		q += " WHERE " + where
+	}
+	if orderBy != "" {
+		q += " ORDER BY " + orderBy
+	}
+	if limit != "" {
+		q += " LIMIT " + limit
+	}
+	return q
+}
+
+func (c *checker) query(q string) ([]row, error) {
+	rows, err := c.db.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []row
+	for rows.Next() {
+		r := make(row, len(c.columns))
+		dest := make([]interface{}, len(r))
+		for i := range r {
+			dest[i] = &r[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// order is a term of an ORDER BY
+type order struct {
+	col  int
+	desc bool
+}
+
+// run runs a query with the given clauses, comparing its results with the rows of the full scan that match.
+// If limit is positive, the results are expected to be the first limit of the matching rows.
+func (c *checker) run(where string, match func(row) bool, orders []order, limit int) {
+	var orderBy []string
+	for _, o := range orders {
+		term := vtab.QuoteIdent(c.columns[o.col])
+		if o.desc {
+			term += " DESC"
+		}
+		orderBy = append(orderBy, term)
+	}
+	var limitSQL string
+	if limit > 0 {
+		limitSQL = strconv.Itoa(limit)
+	}
+	q := c.sql(where, strings.Join(orderBy, ", "), limitSQL)
+
+	got, err := c.query(q)
+	if err != nil {
+		c.failures = append(c.failures, &Failure{q, fmt.Sprintf("query failed: %v", err)})
+		return
+	}
+
+	var want []row
+	for _, r := range c.all {
+		if match == nil || match(r) {
+			want = append(want, r)
+		}
+	}
+	sortRows(want, orders)
+
+	if problem := compare(got, want, orders, limit); problem != "" {
+		c.failures = append(c.failures, &Failure{q, problem})
+	}
+}
+
+// compare compares the rows of a query with the rows expected, sorted by orders
+func compare(got, want []row, orders []order, limit int) string {
+	expected := len(want)
+	if limit > 0 && limit < expected {
+		expected = limit
+	}
+	if len(got) != expected {
+		hint := "rows are missing, as if a constraint or an early exit skipped rows that match"
+		if len(got) > expected {
+			hint = "there are extra rows, as if a constraint marked OmitCheck wasn't applied"
+		}
+		return fmt.Sprintf("got %d rows, want %d: %s", len(got), expected, hint)
+	}
+
+	// every row must be an expected row (the first expected rows, by the ORDER BY, with a LIMIT)
+	counts := make(map[string]int)
+	for _, r := range want {
+		counts[r.key()]++
+	}
+	for _, r := range got {
+		if counts[r.key()] == 0 {
+			return fmt.Sprintf("unexpected row (%s): a constraint marked OmitCheck may not have been applied", r.key())
+		}
+		counts[r.key()]--
+	}
+
+	for i := range got {
+		if compareRows(got[i], want[i], orders) != 0 {
+			return fmt.Sprintf("row %d (%s) is out of order, want (%s): an ORDER BY may have been consumed but not followed", i, got[i].key(), want[i].key())
+		}
+		if i > 0 && limit <= 0 && compareRows(got[i-1], got[i], orders) > 0 {
+			return fmt.Sprintf("row %d (%s) is out of order", i, got[i].key())
+		}
+	}
+	return ""
+}
+
+func sortRows(rows []row, orders []order) {
+	sort.SliceStable(rows, func(a, b int) bool {
+		return compareRows(rows[a], rows[b], orders) < 0
+	})
+}
+
+func compareRows(a, b row, orders []order) int {
+	for _, o := range orders {
+		cmp := compareValues(a[o.col].parsed(), b[o.col].parsed())
+		if o.desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// checkColumn checks filters on a column, with and without ORDER BY, and joins on it
+func (c *checker) checkColumn(col, samples int) {
+	name := vtab.QuoteIdent(c.columns[col])
+	values := c.samples(col, samples)
+
+	c.run(name+" IS NULL", func(r row) bool { return r[col] == "NULL" }, nil, 0)
+	c.run(name+" IS NOT NULL", func(r row) bool { return r[col] != "NULL" }, nil, 0)
+
+	ops := []string{"=", "!=", "<", "<=", ">", ">="}
+	for _, v := range values {
+		v := v
+		for _, op := range ops {
+			op := op
+			match := func(r row) bool {
+				cmp, ok := compareSQL(r[col].parsed(), v.parsed())
+				return ok && matchOp(cmp, op)
+			}
+			where := fmt.Sprintf("%s %s %s", name, op, v)
+			c.run(where, match, nil, 0)
+			c.run(where, match, []order{{col, false}}, 0)
+			c.run(where, match, []order{{col, true}}, 0)
+			c.run(where, match, []order{{col, true}}, 2)
+		}
+
+		// ranges, which may end early in either direction
+		if lower, upper := values[0], values[len(values)-1]; lower != upper {
+			match := func(r row) bool {
+				lo, ok1 := compareSQL(r[col].parsed(), lower.parsed())
+				hi, ok2 := compareSQL(r[col].parsed(), upper.parsed())
+				return ok1 && ok2 && lo > 0 && hi <= 0
+			}
+			where := fmt.Sprintf("%s > %s AND %s <= %s", name, lower, name, upper)
+			c.run(where, match, []order{{col, false}}, 0)
+			c.run(where, match, []order{{col, true}}, 0)
+		}
+
+		// LIKE and GLOB on prefixes of text values, of columns of only text (LIKE and GLOB compare numbers as text)
+		if s, ok := v.parsed().(string); ok && s != "" && c.text(col) {
+			prefix := string([]rune(s)[:1])
+			if !strings.ContainsAny(prefix, "%_*?[]'\\") {
+				c.run(fmt.Sprintf("%s LIKE '%s%%'", name, prefix), func(r row) bool {
+					t, ok := r[col].parsed().(string)
+					return ok && strings.HasPrefix(strings.ToLower(t), strings.ToLower(prefix))
+				}, []order{{col, false}}, 0)
+				c.run(fmt.Sprintf("%s GLOB '%s*'", name, prefix), func(r row) bool {
+					t, ok := r[col].parsed().(string)
+					return ok && strings.HasPrefix(t, prefix)
+				}, nil, 0)
+			}
+		}
+	}
+
+	// a join passes the values of the other table as constraints, filtering the table once per value
+	if len(values) > 0 {
+		literals := make([]string, len(values))
+		for i, v := range values {
+			literals[i] = fmt.Sprintf("(%s)", v)
+		}
+		quoted := make([]string, len(c.columns))
+		for i, column := range c.columns {
+			quoted[i] = fmt.Sprintf("quote(t.%s)", vtab.QuoteIdent(column))
+		}
+		q := fmt.Sprintf("SELECT %s FROM (VALUES %s) AS v CROSS JOIN %s AS t ON t.%s = v.column1",
+			strings.Join(quoted, ", "), strings.Join(literals, ", "), c.from, name)
+
+		got, err := c.query(q)
+		if err != nil {
+			c.failures = append(c.failures, &Failure{q, fmt.Sprintf("query failed: %v", err)})
+			return
+		}
+		var want []row
+		for _, v := range values {
+			for _, r := range c.all {
+				if cmp, ok := compareSQL(r[col].parsed(), v.parsed()); ok && cmp == 0 {
+					want = append(want, r)
+				}
+			}
+		}
+		// the join's order isn't defined
+		sortRows(got, c.allOrders())
+		sortRows(want, c.allOrders())
+		if problem := compare(got, want, c.allOrders(), 0); problem != "" {
+			c.failures = append(c.failures, &Failure{q, problem})
+		}
+	}
+}
+
+// allOrders orders by every column, for comparing unordered results
+func (c *checker) allOrders() []order {
+	orders := make([]order, len(c.columns))
+	for i := range c.columns {
+		orders[i] = order{col: i}
+	}
+	return orders
+}
+
+// checkOrders checks ORDER BY each column and pair of columns, with and without a LIMIT
+func (c *checker) checkOrders() {
+	half := len(c.all) / 2
+	for a := range c.columns {
+		for _, desc := range []bool{false, true} {
+			c.run("", nil, []order{{a, desc}}, 0)
+			if half > 0 {
+				c.run("", nil, []order{{a, desc}}, half)
+			}
+			for b := range c.columns {
+				if a != b {
+					c.run("", nil, []order{{a, desc}, {b, !desc}}, 0)
+				}
+			}
+		}
+	}
+	if half > 0 {
+		c.run("", nil, nil, half)
+	}
+}
+
+// samples returns up to n distinct, non-NULL values of a column, sorted, including its smallest and largest
+func (c *checker) samples(col, n int) []value {
+	seen := make(map[value]bool)
+	var distinct []value
+	for _, r := range c.all {
+		if v := r[col]; v != "NULL" && !seen[v] {
+			seen[v] = true
+			distinct = append(distinct, v)
+		}
+	}
+	sort.Slice(distinct, func(a, b int) bool {
+		return compareValues(distinct[a].parsed(), distinct[b].parsed()) < 0
+	})
+	if len(distinct) <= n {
+		return distinct
+	}
+
+	values := make([]value, 0, n)
+	for i := 0; i < n; i++ {
+		values = append(values, distinct[i*(len(distinct)-1)/(n-1)])
+	}
+	return values
+}
+
+// text reports whether every value of a column is text (or NULL)
+func (c *checker) text(col int) bool {
+	for _, r := range c.all {
+		switch r[col].parsed().(type) {
+		case nil, string:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// typeOrder is the order of the storage classes of values in SQLite: NULL, then numbers, text and blobs
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64, float64:
+		return 1
+	case string:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// compareValues compares two values the way SQLite orders them, with the BINARY collation
+func compareValues(a, b interface{}) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		if ta < tb {
+			return -1
+		}
+		return 1
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+		return compareFloats(float64(a), b.(float64))
+	case float64:
+		if b, ok := b.(int64); ok {
+			return compareFloats(a, float64(b))
+		}
+		return compareFloats(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	default:
+		return bytes.Compare(a.([]byte), b.([]byte))
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareSQL compares two values in a WHERE clause, where a comparison with NULL is never true
+func compareSQL(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	return compareValues(a, b), true
+}
+
+// matchOp reports whether the result of a comparison satisfies the operator op
+func matchOp(cmp int, op string) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package vtabtest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/jmoiron/sqlx"
+	"go.riyazali.net/sqlite"
+)
+
+// ops are the constraint operators generated by IndexInfo
+var ops = []sqlite.ConstraintOp{
+	sqlite.INDEX_CONSTRAINT_EQ, sqlite.INDEX_CONSTRAINT_GT, sqlite.INDEX_CONSTRAINT_LE, sqlite.INDEX_CONSTRAINT_LT,
+	sqlite.INDEX_CONSTRAINT_GE, sqlite.INDEX_CONSTRAINT_MATCH, sqlite.INDEX_CONSTRAINT_LIKE, sqlite.INDEX_CONSTRAINT_GLOB,
+	sqlite.INDEX_CONSTRAINT_REGEXP, sqlite.INDEX_CONSTRAINT_NE, sqlite.INDEX_CONSTRAINT_ISNOT,
+	sqlite.INDEX_CONSTRAINT_ISNOTNULL, sqlite.INDEX_CONSTRAINT_ISNULL, sqlite.INDEX_CONSTRAINT_IS,
+	vtab.INDEX_CONSTRAINT_LIMIT, vtab.INDEX_CONSTRAINT_OFFSET,
+}
+
+// bytesReader reads the fuzzer's input, as zeros once it runs out
+type bytesReader []byte
+
+func (r *bytesReader) next() int {
+	if len(*r) == 0 {
+		return 0
+	}
+	b := (*r)[0]
+	*r = (*r)[1:]
+	return int(b)
+}
+
+// IndexInfo returns the input to BestIndex described by data, of constraints and ORDER BYs on the columns of a
+// table of the given number of columns (and on its rowid, the column -1). Constraints are usable unless
+// data says otherwise, and LIMIT and OFFSET constraints have no column, as SQLite passes them.
+func IndexInfo(data []byte, columns int) *sqlite.IndexInfoInput {
+	r := bytesReader(data)
+	column := func() int { return r.next()%(columns+1) - 1 }
+
+	input := &sqlite.IndexInfoInput{}
+	for n := r.next() % 8; n > 0; n-- {
+		op := ops[r.next()%len(ops)]
+		constraint := &sqlite.IndexConstraint{ColumnIndex: column(), Op: op, Usable: r.next()%8 != 0}
+		if op == vtab.INDEX_CONSTRAINT_LIMIT || op == vtab.INDEX_CONSTRAINT_OFFSET {
+			constraint.ColumnIndex = -1
+		}
+		input.Constraints = append(input.Constraints, constraint)
+	}
+	for n := r.next() % 4; n > 0; n-- {
+		input.OrderBy = append(input.OrderBy, &sqlite.OrderBy{ColumnIndex: column(), Desc: r.next()%2 == 1})
+	}
+	if r.next()%2 == 1 {
+		used := uint64(r.next())<<8 | uint64(r.next())
+		input.ColUsed = &used
+	}
+	return input
+}
+
+// CheckBestIndex calls the BestIndex of table with input, and checks that its output is a plan SQLite can use:
+// that there is a usage for every constraint, that the constraints used are usable and numbered from 1 with
+// no gaps or repeats (as they're passed to Filter in that order), and that only constraints used are omitted.
+// BestIndex may reject the input with SQLITE_CONSTRAINT. If the plan is a table-func's (see vtab.DecodeIndex),
+// it also checks that each constraint passed to Filter is the constraint SQLite passes at its position,
+// and that the ORDER BY is passed to the iterator whenever it's consumed.
+func CheckBestIndex(table sqlite.VirtualTable, input *sqlite.IndexInfoInput) error {
+	output, err := table.BestIndex(input)
+	if err != nil {
+		if errors.Is(err, sqlite.SQLITE_CONSTRAINT) {
+			return nil
+		}
+		return fmt.Errorf("BestIndex: %w", err)
+	}
+
+	if len(output.ConstraintUsage) != len(input.Constraints) {
+		return fmt.Errorf("%d constraint usages for %d constraints", len(output.ConstraintUsage), len(input.Constraints))
+	}
+
+	// argv is the constraint passed to Filter at each position
+	argv := make(map[int]*sqlite.IndexConstraint)
+	for c, usage := range output.ConstraintUsage {
+		if usage == nil || usage.ArgvIndex == 0 {
+			if usage != nil && usage.Omit {
+				return fmt.Errorf("constraint %d is omitted but not used", c)
+			}
+			continue
+		}
+		if !input.Constraints[c].Usable {
+			return fmt.Errorf("constraint %d is used but not usable", c)
+		}
+		if other, ok := argv[usage.ArgvIndex]; ok {
+			return fmt.Errorf("constraints %v and %v are both passed to Filter as argument %d", other, input.Constraints[c], usage.ArgvIndex)
+		}
+		argv[usage.ArgvIndex] = input.Constraints[c]
+	}
+	for a := 1; a <= len(argv); a++ {
+		if _, ok := argv[a]; !ok {
+			return fmt.Errorf("no constraint is passed to Filter as argument %d of %d", a, len(argv))
+		}
+	}
+
+	constraints, orders, err := vtab.DecodeIndex(output.IndexString)
+	if err != nil {
+		// not a table-func's plan
+		return nil
+	}
+	if len(constraints) != len(argv) {
+		return fmt.Errorf("the plan has %d constraints, but %d arguments are passed to Filter", len(constraints), len(argv))
+	}
+	for c, constraint := range constraints {
+		passed := argv[c+1]
+		if constraint.Op != passed.Op || (constraint.Op != vtab.INDEX_CONSTRAINT_LIMIT && constraint.ColIndex != passed.ColumnIndex) {
+			return fmt.Errorf("constraint %d of the plan is %d on column %d, but is passed the value of %d on column %d",
+				c, constraint.Op, constraint.ColIndex, passed.Op, passed.ColumnIndex)
+		}
+	}
+	if output.OrderByConsumed {
+		if len(orders) != len(input.OrderBy) {
+			return fmt.Errorf("the ORDER BY is consumed, but %d of its %d terms are passed to the iterator", len(orders), len(input.OrderBy))
+		}
+		for o, order := range orders {
+			if *order != *input.OrderBy[o] {
+				return fmt.Errorf("the ORDER BY is consumed, but term %d is passed to the iterator as %v", o, *order)
+			}
+		}
+	}
+	return nil
+}
+
+// FuzzBestIndex fuzzes the BestIndex of the table m connects to with args, of the given number of columns
+// (including hidden ones), checking each plan with CheckBestIndex. The table is connected to without a
+// connection, as the tables of vtab's modules are.
+func FuzzBestIndex(f *testing.F, m sqlite.Module, columns int, args ...string) {
+	table, err := m.Connect(nil, args, func(string) error { return nil })
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 1, 1, 1, 1, 0})
+	f.Add([]byte{3, 1, 1, 1, 3, 2, 1, 14, 0, 1, 2, 1, 1, 2, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		input := IndexInfo(data, columns)
+		if err := CheckBestIndex(table, input); err != nil {
+			t.Fatalf("%s: %v", describe(input), err)
+		}
+	})
+}
+
+func describe(input *sqlite.IndexInfoInput) string {
+	var parts []string
+	for _, c := range input.Constraints {
+		parts = append(parts, fmt.Sprintf("{col %d op %d usable %t}", c.ColumnIndex, c.Op, c.Usable))
+	}
+	for _, o := range input.OrderBy {
+		parts = append(parts, fmt.Sprintf("{order by %d desc %t}", o.ColumnIndex, o.Desc))
+	}
+	return strings.Join(parts, " ")
+}
+
+// query returns the query of table described by data, with up to 3 constraints of (=, !=, <, <=, >, >=,
+// IS NULL or IS NOT NULL) on sample values of its columns, up to 2 ORDER BY terms and a LIMIT, along with
+// the clauses to evaluate it by. values are the sample values of each column.
+func query(data []byte, columns []string, values [][]value) (where string, match func(row) bool, orders []order, limit int) {
+	r := bytesReader(data)
+	ops := []string{"=", "!=", "<", "<=", ">", ">=", "IS NULL", "IS NOT NULL"}
+
+	var terms []string
+	var matches []func(row) bool
+	for n := r.next() % 4; n > 0; n-- {
+		col := r.next() % len(columns)
+		op := ops[r.next()%len(ops)]
+		switch {
+		case op == "IS NULL":
+			terms = append(terms, columns[col]+" IS NULL")
+			matches = append(matches, func(r row) bool { return r[col] == "NULL" })
+		case op == "IS NOT NULL":
+			terms = append(terms, columns[col]+" IS NOT NULL")
+			matches = append(matches, func(r row) bool { return r[col] != "NULL" })
+		case len(values[col]) > 0:
+			v := values[col][r.next()%len(values[col])]
+			terms = append(terms, fmt.Sprintf("%s %s %s", columns[col], op, v))
+			matches = append(matches, func(r row) bool {
+				cmp, ok := compareSQL(r[col].parsed(), v.parsed())
+				return ok && matchOp(cmp, op)
+			})
+		}
+	}
+	for n := r.next() % 3; n > 0; n-- {
+		orders = append(orders, order{col: r.next() % len(columns), desc: r.next()%2 == 1})
+	}
+	limit = r.next() % 8
+
+	match = func(r row) bool {
+		for _, m := range matches {
+			if !m(r) {
+				return false
+			}
+		}
+		return true
+	}
+	return strings.Join(terms, " AND "), match, orders, limit
+}
+
+// FuzzQueries fuzzes queries of a table, with constraints on its columns, ORDER BY and LIMIT, checking their
+// results against the results of a full scan of the table, as Conformance does. Each column's values are
+// sampled as in Conformance, so the constraints generated match rows of the table. The table is scanned
+// (after running its Setup) when the first input is run, and is expected not to change afterwards.
+func FuzzQueries(f *testing.F, db *sqlx.DB, table Table) {
+	var once sync.Once
+	var c *checker
+	var values [][]value
+	var err error
+
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 4, 1, 1, 0, 0, 3})
+	f.Add([]byte{2, 0, 2, 2, 0, 5, 0, 2, 0, 1, 0, 0, 2})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		once.Do(func() {
+			c, err = newChecker(db, table)
+			if err != nil {
+				return
+			}
+			samples := table.Samples
+			if samples <= 0 {
+				samples = 3
+			}
+			for col := range c.columns {
+				values = append(values, c.samples(col, samples))
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		where, match, orders, limit := query(data, c.columns, values)
+		c.failures = nil
+		c.run(where, match, orders, limit)
+		for _, failure := range c.failures {
+			t.Errorf("%s: %s", table.From, failure)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+// Package vtabtest provides utilities for testing virtual table modules: registering a module for a test
+// database, counting the rows its cursors read, and a conformance harness that checks the results of generated
+// queries (with filters, ORDER BY, LIMIT and joins) against a naive full scan of the table:
+//
+//	func TestSeries(t *testing.T) {
+//		db, stats := vtabtest.Open(t, "series", seriesModule, sqlite.EponymousOnly(true))
+//		vtabtest.Conformance(t, db, vtabtest.Table{From: "series(0, 100, 1)"})
+//
+//		stats.Reset()
+//		db.Select(&values, "select value from series(0, 100, 1) where value < 10 order by value")
+//		assert.Equal(t, 10, stats.Rows())
+//	}
+package vtabtest
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"go.riyazali.net/sqlite"
+)
+
+// registered are the modules registered with Open, created on every new connection
+var registered = struct {
+	sync.Mutex
+	once    sync.Once
+	modules map[string]*module
+}{modules: make(map[string]*module)}
+
+// Open registers m as name, for every connection opened afterwards (replacing any module registered with
+// the same name), and returns a new in-memory database of a single connection, closed when the test ends.
+// The returned Stats count the use of the module's cursors.
+func Open(t testing.TB, name string, m sqlite.Module, opts ...sqlite.ModuleOption) (*sqlx.DB, *Stats) {
+	t.Helper()
+
+	stats := &Stats{}
+	registered.Lock()
+	registered.modules[name] = &module{m, opts, stats}
+	registered.Unlock()
+
+	registered.once.Do(func() {
+		sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+			registered.Lock()
+			defer registered.Unlock()
+			for name, m := range registered.modules {
+				if err := api.CreateModule(name, m, m.opts...); err != nil {
+					return sqlite.SQLITE_ERROR, err
+				}
+			}
+			return sqlite.SQLITE_OK, nil
+		})
+	})
+
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection to :memory: is a different database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db, stats
+}
+
+// Stats counts the use of a module's cursors, across every connection
+type Stats struct {
+	filters int64
+	rows    int64
+}
+
+// Filters returns the number of times a cursor was filtered, the number of scans of the table
+func (s *Stats) Filters() int { return int(atomic.LoadInt64(&s.filters)) }
+
+// Rows returns the number of rows the cursors moved through, the calls to Filter and Next (including
+// the call that reached the end of a scan), which is the number of times a vtab.Iterator's Next is called
+func (s *Stats) Rows() int { return int(atomic.LoadInt64(&s.rows)) }
+
+// Reset resets the counts
+func (s *Stats) Reset() {
+	atomic.StoreInt64(&s.filters, 0)
+	atomic.StoreInt64(&s.rows, 0)
+}
+
+// module wraps a module, to count the use of its cursors
+type module struct {
+	sqlite.Module
+	opts  []sqlite.ModuleOption
+	stats *Stats
+}
+
+func (m *module) Connect(conn *sqlite.Conn, args []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	t, err := m.Module.Connect(conn, args, declare)
+	if err != nil {
+		return nil, err
+	}
+	if w, ok := t.(sqlite.WriteableVirtualTable); ok {
+		return &writeableTable{w, &table{t, m.stats}}, nil
+	}
+	return &table{t, m.stats}, nil
+}
+
+type table struct {
+	sqlite.VirtualTable
+	stats *Stats
+}
+
+func (t *table) Open() (sqlite.VirtualCursor, error) {
+	c, err := t.VirtualTable.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &cursor{c, t.stats}, nil
+}
+
+type writeableTable struct {
+	sqlite.WriteableVirtualTable
+	*table
+}
+
+func (t *writeableTable) BestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	return t.table.BestIndex(input)
+}
+
+func (t *writeableTable) Open() (sqlite.VirtualCursor, error) { return t.table.Open() }
+func (t *writeableTable) Disconnect() error                   { return t.table.Disconnect() }
+func (t *writeableTable) Destroy() error                      { return t.table.Destroy() }
+
+type cursor struct {
+	sqlite.VirtualCursor
+	stats *Stats
+}
+
+func (c *cursor) Filter(idxNum int, idxName string, values ...sqlite.Value) error {
+	atomic.AddInt64(&c.stats.filters, 1)
+	atomic.AddInt64(&c.stats.rows, 1)
+	return c.VirtualCursor.Filter(idxNum, idxName, values...)
+}
+
+func (c *cursor) Next() error {
+	atomic.AddInt64(&c.stats.rows, 1)
+	return c.VirtualCursor.Next()
+}
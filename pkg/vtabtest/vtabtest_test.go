@@ -0,0 +1,190 @@
+package vtabtest
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+type planet struct {
+	Name  string
+	Moons int
+	Ring  *bool
+}
+
+var yes, no = true, false
+
+var planets = []planet{
+	{"mercury", 0, &no}, {"venus", 0, &no}, {"earth", 1, &no}, {"mars", 2, nil},
+	{"jupiter", 95, &yes}, {"saturn", 146, &yes}, {"uranus", 28, &yes}, {"neptune", 16, &yes},
+}
+
+var planetCols = []vtab.Column{
+	{Name: "name", Type: "TEXT"},
+	{Name: "moons", Type: "INTEGER"},
+	{Name: "ring", Type: "INTEGER"},
+}
+
+func planetColumn(ctx vtab.Context, p planet, col int) error {
+	switch planetCols[col].Name {
+	case "name":
+		ctx.ResultText(p.Name)
+	case "moons":
+		ctx.ResultInt(p.Moons)
+	case "ring":
+		if p.Ring == nil {
+			ctx.ResultNull()
+		} else if *p.Ring {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+}
+
+// brokenIter claims to filter moons, but doesn't
+type brokenIter struct {
+	index int
+}
+
+func (i *brokenIter) Next() (vtab.Row, error) {
+	i.index++
+	if i.index > len(planets) {
+		return nil, io.EOF
+	}
+	return i, nil
+}
+
+func (i *brokenIter) Column(ctx vtab.Context, col int) error {
+	return planetColumn(ctx, planets[i.index-1], col)
+}
+
+var brokenCols = []vtab.Column{
+	{Name: "name", Type: "TEXT"},
+	{Name: "moons", Type: "INTEGER", Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "ring", Type: "INTEGER"},
+}
+
+func TestConformance(t *testing.T) {
+	db, stats := Open(t, "planets", vtab.NewSliceTable("planets", planetCols, func() []planet {
+		return planets
+	}, planetColumn), sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+
+	Conformance(t, db, Table{From: "planets"})
+	assert.Greater(t, stats.Filters(), 0)
+}
+
+func TestConformanceFailures(t *testing.T) {
+	db, _ := Open(t, "broken_planets", vtab.NewTableFunc("broken_planets", brokenCols, func(_ []*vtab.Constraint, _ []*sqlite.OrderBy) (vtab.Iterator, error) {
+		return &brokenIter{}, nil
+	}), sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+
+	failures, err := Check(db, Table{From: "broken_planets"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.NotEmpty(t, failures) {
+		return
+	}
+	assert.Contains(t, failures[0].Query, "moons = ")
+	assert.Contains(t, failures[0].Problem, "OmitCheck")
+}
+
+type purchase struct {
+	Order int
+	Group string
+}
+
+var orderCols = []vtab.Column{
+	{Name: "order", Type: "INTEGER"},
+	{Name: "group", Type: "TEXT"},
+}
+
+func TestConformanceKeywordColumns(t *testing.T) {
+	orders := []purchase{{1, "a"}, {2, "b"}, {3, "a"}}
+	db, _ := Open(t, "orders", vtab.NewSliceTable("orders", orderCols, func() []purchase {
+		return orders
+	}, func(ctx vtab.Context, o purchase, col int) error {
+		if col == 0 {
+			ctx.ResultInt(o.Order)
+		} else {
+			ctx.ResultText(o.Group)
+		}
+		return nil
+	}), sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+
+	failures, err := Check(db, Table{From: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, failures)
+}
+
+func TestStats(t *testing.T) {
+	db, stats := Open(t, "counted_planets", vtab.NewSliceTable("counted_planets", planetCols, func() []planet {
+		return planets
+	}, planetColumn), sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+
+	var names []string
+	if err := db.Select(&names, "select name from counted_planets"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, names, len(planets))
+	assert.Equal(t, 1, stats.Filters())
+	assert.Equal(t, len(planets)+1, stats.Rows())
+
+	stats.Reset()
+	assert.Equal(t, 0, stats.Rows())
+}
+
+func TestCompareValues(t *testing.T) {
+	ordered := []value{"NULL", "-1.5", "0", "1", "1.5", "2", "'A'", "'a'", "'b'", "X'00'", "X'01'"}
+	for a := range ordered {
+		for b := range ordered {
+			want := 0
+			if a < b {
+				want = -1
+			} else if a > b {
+				want = 1
+			}
+			assert.Equal(t, want, compareValues(ordered[a].parsed(), ordered[b].parsed()), "%s, %s", ordered[a], ordered[b])
+		}
+	}
+	assert.Equal(t, "it's", value("'it''s'").parsed())
+}
+
+// swappedTable passes the values of its two constraints to Filter in the wrong order, for the plan it decodes
+type swappedTable struct{ sqlite.VirtualTable }
+
+func (swappedTable) BestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	return &sqlite.IndexInfoOutput{
+		IndexString:     `{"Constraints":[{"ColIndex":0,"Op":2},{"ColIndex":1,"Op":4}]}`,
+		ConstraintUsage: []*sqlite.ConstraintUsage{{ArgvIndex: 2}, {ArgvIndex: 1}},
+	}, nil
+}
+
+func TestCheckBestIndex(t *testing.T) {
+	input := &sqlite.IndexInfoInput{Constraints: []*sqlite.IndexConstraint{
+		{ColumnIndex: 0, Op: sqlite.INDEX_CONSTRAINT_EQ, Usable: true},
+		{ColumnIndex: 1, Op: sqlite.INDEX_CONSTRAINT_GT, Usable: true},
+	}}
+	err := CheckBestIndex(swappedTable{}, input)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "constraint 0 of the plan")
+	}
+
+	table, err := vtab.NewTableFunc("planets", brokenCols, nil).Connect(nil, nil, func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{{}, {2, 1, 2, 1, 0, 1, 1}, {7, 14, 0, 1, 15, 0, 1, 0, 1, 2, 1, 0, 1}} {
+		assert.NoError(t, CheckBestIndex(table, IndexInfo(data, len(brokenCols))))
+	}
+}
@@ -0,0 +1,250 @@
+package vtab
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.riyazali.net/sqlite"
+)
+
+// opNames are the SQL of the constraint operators, as reported in plans
+var opNames = map[sqlite.ConstraintOp]string{
+	sqlite.INDEX_CONSTRAINT_EQ:        "=",
+	sqlite.INDEX_CONSTRAINT_GT:        ">",
+	sqlite.INDEX_CONSTRAINT_LE:        "<=",
+	sqlite.INDEX_CONSTRAINT_LT:        "<",
+	sqlite.INDEX_CONSTRAINT_GE:        ">=",
+	sqlite.INDEX_CONSTRAINT_MATCH:     "MATCH",
+	sqlite.INDEX_CONSTRAINT_LIKE:      "LIKE",
+	sqlite.INDEX_CONSTRAINT_GLOB:      "GLOB",
+	sqlite.INDEX_CONSTRAINT_REGEXP:    "REGEXP",
+	sqlite.INDEX_CONSTRAINT_NE:        "!=",
+	sqlite.INDEX_CONSTRAINT_ISNOT:     "IS NOT",
+	sqlite.INDEX_CONSTRAINT_ISNOTNULL: "IS NOT NULL",
+	sqlite.INDEX_CONSTRAINT_ISNULL:    "IS NULL",
+	sqlite.INDEX_CONSTRAINT_IS:        "IS",
+	sqlite.INDEX_CONSTRAINT_FUNCTION:  "FUNCTION",
+	INDEX_CONSTRAINT_LIMIT:            "LIMIT",
+	INDEX_CONSTRAINT_OFFSET:           "OFFSET",
+}
+
+// OpName returns the SQL of a constraint operator, such as >= or LIKE
+func OpName(op sqlite.ConstraintOp) string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("op %d", op)
+}
+
+// RecordPlans tells the table-func to record the plan chosen by each call to its BestIndex in r,
+// along with the use of its cursors with each plan.
+func RecordPlans(r *PlanRecorder) OptFunc {
+	return func(opts *options) { opts.plans = r }
+}
+
+// Plan is a plan chosen by a table-func's BestIndex
+type Plan struct {
+	ID int64
+	// Table is the name of the table-func's module
+	Table string
+	// Constraints are the constraints SQLite offered BestIndex, and whether each was used
+	Constraints []PlanConstraint
+	// OrderBy is the ORDER BY SQLite offered BestIndex
+	OrderBy         []PlanOrder
+	OrderByConsumed bool
+	Cost            float64
+
+	filters int64
+	nexts   int64
+}
+
+// PlanConstraint is a constraint offered to BestIndex. LIMIT and OFFSET constraints have no Column.
+type PlanConstraint struct {
+	Column string `json:"column,omitempty"`
+	Op     string `json:"op"`
+	Usable bool   `json:"usable"`
+	// Used is whether the constraint is passed to the iterator
+	Used bool `json:"used"`
+	// Omit is whether SQLite skips checking the constraint on the rows of the iterator
+	Omit bool `json:"omit,omitempty"`
+}
+
+// PlanOrder is an ORDER BY term offered to BestIndex
+type PlanOrder struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+// Filters returns the number of times a cursor was filtered with the plan, the number of scans using it
+func (p *Plan) Filters() int64 { return atomic.LoadInt64(&p.filters) }
+
+// Nexts returns the number of times a cursor using the plan moved to the next row
+func (p *Plan) Nexts() int64 { return atomic.LoadInt64(&p.nexts) }
+
+// Used returns the constraints passed to the iterator, in order, as SQL such as value > ?, LIMIT ?
+func (p *Plan) Used() string {
+	var used []string
+	for _, constraint := range p.Constraints {
+		if constraint.Used {
+			used = append(used, strings.TrimSpace(constraint.Column+" "+constraint.Op+" ?"))
+		}
+	}
+	return strings.Join(used, ", ")
+}
+
+// PlanRecorder keeps the most recent plans chosen by table-funcs created with RecordPlans. It's safe for
+// concurrent use, by any number of table-funcs and connections.
+type PlanRecorder struct {
+	mu    sync.Mutex
+	max   int
+	next  int64
+	plans []*Plan
+}
+
+// NewPlanRecorder returns a PlanRecorder keeping the most recent max plans (1000, if max isn't positive)
+func NewPlanRecorder(max int) *PlanRecorder {
+	if max <= 0 {
+		max = 1000
+	}
+	return &PlanRecorder{max: max}
+}
+
+// Plans returns the plans recorded, oldest first
+func (r *PlanRecorder) Plans() []*Plan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Plan(nil), r.plans...)
+}
+
+// Reset discards the plans recorded
+func (r *PlanRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.plans = nil
+}
+
+// record records plan, giving it an ID
+func (r *PlanRecorder) record(plan *Plan) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next++
+	plan.ID = r.next
+	if len(r.plans) >= r.max {
+		r.plans = append(r.plans[:0], r.plans[len(r.plans)-r.max+1:]...)
+	}
+	r.plans = append(r.plans, plan)
+	return plan.ID
+}
+
+// plan returns the plan with id, or nil if it's no longer kept
+func (r *PlanRecorder) plan(id int64) *Plan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// plans are kept in the order of their IDs
+	for p := len(r.plans) - 1; p >= 0; p-- {
+		if r.plans[p].ID == id {
+			return r.plans[p]
+		}
+		if r.plans[p].ID < id {
+			break
+		}
+	}
+	return nil
+}
+
+// newPlan returns the plan of a table-func's BestIndex, with nothing used if output is nil (as BestIndex failed)
+func (m *tableFuncModule) newPlan(input *sqlite.IndexInfoInput, output *sqlite.IndexInfoOutput) *Plan {
+	name := func(col int) string {
+		if col < 0 || col >= len(m.columns) {
+			return "rowid"
+		}
+		return m.columns[col].Name
+	}
+
+	plan := &Plan{Table: m.name}
+	if output != nil {
+		plan.OrderByConsumed, plan.Cost = output.OrderByConsumed, output.EstimatedCost
+	}
+	for c, constraint := range input.Constraints {
+		pc := PlanConstraint{Op: OpName(constraint.Op), Usable: constraint.Usable}
+		if constraint.Op != INDEX_CONSTRAINT_LIMIT && constraint.Op != INDEX_CONSTRAINT_OFFSET {
+			pc.Column = name(constraint.ColumnIndex)
+		}
+		if output != nil && c < len(output.ConstraintUsage) && output.ConstraintUsage[c] != nil {
+			pc.Used = output.ConstraintUsage[c].ArgvIndex > 0
+			pc.Omit = output.ConstraintUsage[c].Omit
+		}
+		plan.Constraints = append(plan.Constraints, pc)
+	}
+	for _, order := range input.OrderBy {
+		plan.OrderBy = append(plan.OrderBy, PlanOrder{name(order.ColumnIndex), order.Desc})
+	}
+	return plan
+}
+
+var planCols = []Column{
+	{Name: "id", Type: "INTEGER"},
+	{Name: "module", Type: "TEXT"},
+	{Name: "constraints", Type: "TEXT"},
+	{Name: "order_by", Type: "TEXT"},
+	{Name: "used", Type: "TEXT"},
+	{Name: "order_by_consumed", Type: "INTEGER"},
+	{Name: "cost", Type: "REAL"},
+	{Name: "filter_calls", Type: "INTEGER"},
+	{Name: "next_calls", Type: "INTEGER"},
+}
+
+// Module returns the vtab_plans table of the plans recorded, to be registered as an eponymous-only module:
+//
+//	api.CreateModule("vtab_plans", recorder.Module(), sqlite.EponymousOnly(true), sqlite.ReadOnly(true))
+//
+// constraints and order_by are JSON arrays of the constraints and ORDER BY offered to BestIndex, used is the
+// constraints passed to the iterator (see Plan.Used), and filter_calls and next_calls count the use of
+// the plan by cursors.
+func (r *PlanRecorder) Module() sqlite.Module {
+	return NewSliceTable("vtab_plans", planCols, r.Plans, func(ctx Context, plan *Plan, col int) error {
+		switch planCols[col].Name {
+		case "id":
+			ctx.ResultInt64(plan.ID)
+		case "module":
+			ctx.ResultText(plan.Table)
+		case "constraints":
+			return resultJSON(ctx, plan.Constraints)
+		case "order_by":
+			return resultJSON(ctx, plan.OrderBy)
+		case "used":
+			ctx.ResultText(plan.Used())
+		case "order_by_consumed":
+			if plan.OrderByConsumed {
+				ctx.ResultInt(1)
+			} else {
+				ctx.ResultInt(0)
+			}
+		case "cost":
+			ctx.ResultFloat(plan.Cost)
+		case "filter_calls":
+			ctx.ResultInt64(plan.Filters())
+		case "next_calls":
+			ctx.ResultInt64(plan.Nexts())
+		default:
+			return fmt.Errorf("unknown column")
+		}
+		return nil
+	})
+}
+
+// resultJSON reports v as JSON text, [] for an empty slice
+func resultJSON(ctx Context, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if string(b) == "null" {
+		b = []byte("[]")
+	}
+	ctx.ResultText(string(b))
+	return nil
+}
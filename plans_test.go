@@ -0,0 +1,97 @@
+package vtab_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+var plans = vtab.NewPlanRecorder(10)
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("planned_services", vtab.NewSliceTable("planned_services", serviceCols, func() []service {
+			return services
+		}, vtab.StructColumns[service](serviceCols), vtab.RecordPlans(plans)),
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("vtab_plans", plans.Module(),
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestPlans(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	plans.Reset()
+	var names []string
+	err = db.Select(&names, "select name from planned_services where port > 1000 order by port desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"api", "cache", "queue", "db"}, names)
+
+	var recorded []struct {
+		Module          string
+		Constraints     string
+		OrderBy         string `db:"order_by"`
+		Used            string
+		OrderByConsumed bool `db:"order_by_consumed"`
+		FilterCalls     int  `db:"filter_calls"`
+		NextCalls       int  `db:"next_calls"`
+	}
+	err = db.Select(&recorded, "select module, constraints, order_by, used, order_by_consumed, filter_calls, next_calls from vtab_plans where filter_calls > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, recorded, 1) {
+		return
+	}
+
+	plan := recorded[0]
+	assert.Equal(t, "planned_services", plan.Module)
+	assert.Equal(t, "port > ?", plan.Used)
+	assert.True(t, plan.OrderByConsumed)
+	assert.Equal(t, 1, plan.FilterCalls)
+	assert.Equal(t, len(names), plan.NextCalls)
+
+	var constraints []vtab.PlanConstraint
+	if err := json.Unmarshal([]byte(plan.Constraints), &constraints); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []vtab.PlanConstraint{{Column: "port", Op: ">", Usable: true, Used: true}}, constraints)
+	assert.JSONEq(t, `[{"column": "port", "desc": true}]`, plan.OrderBy)
+}
+
+func TestPlanRecorderMax(t *testing.T) {
+	recorder := vtab.NewPlanRecorder(2)
+	table, err := vtab.NewTableFunc("recorded", serviceCols, nil, vtab.RecordPlans(recorder)).Connect(nil, nil, func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := table.BestIndex(&sqlite.IndexInfoInput{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ids []int64
+	for _, plan := range recorder.Plans() {
+		ids = append(ids, plan.ID)
+	}
+	assert.Equal(t, []int64{2, 3}, ids)
+}
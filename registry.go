@@ -0,0 +1,186 @@
+package vtab
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.riyazali.net/sqlite"
+)
+
+// ModulesTable is the name of the table of a Registry's modules, see Registry.Register
+const ModulesTable = "vtab_modules"
+
+// ModuleInfo is a module added to a Registry, with the options it's created with and its description
+type ModuleInfo struct {
+	// Name is the name the module is created with
+	Name   string
+	Module sqlite.Module
+	// Description describes the module, by default the description given to it with Describe
+	Description string
+	// EponymousOnly and ReadOnly are passed to CreateModule, as sqlite.EponymousOnly and sqlite.ReadOnly
+	EponymousOnly bool
+	ReadOnly      bool
+}
+
+// Arguments returns the names of the arguments of the module, its hidden columns with an = filter, in order,
+// as in series(start, stop, step). It's nil for a module whose columns are decided by each table (see NewModule).
+func (info *ModuleInfo) Arguments() []string {
+	var args []string
+	for _, col := range ModuleColumns(info.Module) {
+		if isArgument(col) {
+			args = append(args, col.Name)
+		}
+	}
+	return args
+}
+
+// Registry is a set of modules, to be created together on each connection by Register:
+//
+//	registry := vtab.NewRegistry()
+//	registry.Add(&vtab.ModuleInfo{Name: "series", Module: seriesModule, EponymousOnly: true, ReadOnly: true})
+//	sqlite.Register(registry.Register)
+//
+// It's safe for concurrent use. DefaultRegistry is a registry packages add their modules to, in init.
+type Registry struct {
+	mu      sync.Mutex
+	modules map[string]*ModuleInfo
+}
+
+// DefaultRegistry is a Registry shared by packages, which add their modules to it when imported, as do the
+// packages of this module's modules (such as pkg/csv). sqlite.Register(vtab.DefaultRegistry.Register) creates
+// them all, along with vtab_modules, vtab_columns and vtab_help, in place of the Register funcs of the packages
+// (which create the same modules, so mustn't be used along with it).
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{modules: make(map[string]*ModuleInfo)}
+}
+
+// Add adds a module to the registry. As with sql.Register, it panics if a module of the same name
+// was already added, or the module is nil.
+func (r *Registry) Add(info *ModuleInfo) {
+	if info == nil || info.Module == nil {
+		panic("vtab: Add of a nil module")
+	}
+	switch info.Name {
+	case ModulesTable, ColumnsTable:
+		panic("vtab: Add of the reserved module " + info.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.modules[info.Name]; ok {
+		panic("vtab: Add called twice for module " + info.Name)
+	}
+	r.modules[info.Name] = info
+}
+
+// Modules returns the modules added, ordered by name
+func (r *Registry) Modules() []*ModuleInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	modules := make([]*ModuleInfo, 0, len(r.modules))
+	for _, info := range r.modules {
+		modules = append(modules, info)
+	}
+	sort.Slice(modules, func(a, b int) bool { return modules[a].Name < modules[b].Name })
+	return modules
+}
+
+// CreateModules creates each of modules with api, with their options. It's how the packages of modules
+// implement their Register funcs, creating the modules they add to DefaultRegistry.
+func CreateModules(api *sqlite.ExtensionApi, modules []*ModuleInfo) error {
+	for _, info := range modules {
+		if err := api.CreateModule(info.Name, info.Module,
+			sqlite.EponymousOnly(info.EponymousOnly),
+			sqlite.ReadOnly(info.ReadOnly)); err != nil {
+			return fmt.Errorf("vtab: creating module %s: %w", info.Name, err)
+		}
+	}
+	return nil
+}
+
+// Register creates each of the registry's modules with api, along with the vtab_modules table listing them
+// (see Module), the vtab_columns table of their columns (see ColumnsModule) and the vtab_help function
+// describing one (see Help). It's an extension function, to be passed to sqlite.Register.
+func (r *Registry) Register(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+	if err := CreateModules(api, r.Modules()); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
+	for _, m := range []struct {
+		name   string
+		module sqlite.Module
+	}{
+		{ModulesTable, r.Module()},
+		{ColumnsTable, r.ColumnsModule()},
+	} {
+		if err := api.CreateModule(m.name, m.module, sqlite.EponymousOnly(true), sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, fmt.Errorf("vtab: creating module %s: %w", m.name, err)
+		}
+	}
+	if err := api.CreateFunction(HelpFunction, &helpFunction{r}); err != nil {
+		return sqlite.SQLITE_ERROR, fmt.Errorf("vtab: creating function %s: %w", HelpFunction, err)
+	}
+	return sqlite.SQLITE_OK, nil
+}
+
+var moduleCols = []Column{
+	{Name: "name", Type: "TEXT"},
+	{Name: "description", Type: "TEXT"},
+	{Name: "eponymous_only", Type: "INTEGER"},
+	{Name: "read_only", Type: "INTEGER"},
+	{Name: "columns", Type: "TEXT"},
+	{Name: "arguments", Type: "TEXT"},
+}
+
+// moduleColumn is a column of a module, as listed by vtab_modules
+type moduleColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Module returns the vtab_modules table of the registry's modules, created by Register. columns is a JSON array
+// of the name and type of each of a module's columns (other than hidden ones), and arguments a JSON array
+// of the names of its arguments (see ModuleInfo.Arguments), both NULL for modules whose columns are decided
+// by each table.
+func (r *Registry) Module() sqlite.Module {
+	return NewSliceTable(ModulesTable, moduleCols, r.Modules, func(ctx Context, info *ModuleInfo, col int) error {
+		columns := ModuleColumns(info.Module)
+		switch moduleCols[col].Name {
+		case "name":
+			ctx.ResultText(info.Name)
+		case "description":
+			if description := info.description(); description == "" {
+				ctx.ResultNull()
+			} else {
+				ctx.ResultText(description)
+			}
+		case "eponymous_only":
+			return resultValue(ctx, info.EponymousOnly)
+		case "read_only":
+			return resultValue(ctx, info.ReadOnly)
+		case "columns":
+			if columns == nil {
+				ctx.ResultNull()
+				return nil
+			}
+			var cols []moduleColumn
+			for _, c := range columns {
+				if !c.Hidden {
+					cols = append(cols, moduleColumn{c.Name, c.Type})
+				}
+			}
+			return resultJSON(ctx, cols)
+		case "arguments":
+			if columns == nil {
+				ctx.ResultNull()
+				return nil
+			}
+			return resultJSON(ctx, info.Arguments())
+		default:
+			return fmt.Errorf("unknown column")
+		}
+		return nil
+	})
+}
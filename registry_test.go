@@ -0,0 +1,87 @@
+package vtab_test
+
+import (
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+var registry = vtab.NewRegistry()
+
+func init() {
+	registry.Add(&vtab.ModuleInfo{
+		Name:          "registry_series",
+		Module:        seriesModule,
+		Description:   "a series of integers, from start to stop by step",
+		EponymousOnly: true,
+		ReadOnly:      true,
+	})
+	registry.Add(&vtab.ModuleInfo{
+		Name: "registry_echo",
+		Module: vtab.NewModule("registry_echo", func(args []string) ([]vtab.Column, vtab.GetIteratorFunc, error) {
+			seq := func([]*vtab.Constraint, []*sqlite.OrderBy) (iter.Seq[string], error) { return slices.Values(args), nil }
+			return []vtab.Column{{Name: "arg", Type: "TEXT"}}, vtab.FromSeq(seq, func(ctx vtab.Context, arg string, col int) error {
+				ctx.ResultText(arg)
+				return nil
+			}), nil
+		}),
+	})
+	sqlite.Register(registry.Register)
+}
+
+func TestRegistry(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.Get(&count, "SELECT count(*) FROM registry_series(1, 10, 1)"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 9, count)
+
+	type module struct {
+		Name          string  `db:"name"`
+		Description   *string `db:"description"`
+		EponymousOnly bool    `db:"eponymous_only"`
+		ReadOnly      bool    `db:"read_only"`
+		Columns       *string `db:"columns"`
+		Arguments     *string `db:"arguments"`
+	}
+	var modules []module
+	if err := db.Select(&modules, "SELECT * FROM vtab_modules WHERE name IN ('registry_echo', 'registry_series')"); err != nil {
+		t.Fatal(err)
+	}
+	description := "a series of integers, from start to stop by step"
+	columns, arguments := `[{"name":"value","type":"INTEGER"}]`, `["start","stop","step"]`
+	assert.Equal(t, []module{
+		{Name: "registry_echo"},
+		{Name: "registry_series", Description: &description, EponymousOnly: true, ReadOnly: true, Columns: &columns, Arguments: &arguments},
+	}, modules)
+}
+
+func TestRegistryModules(t *testing.T) {
+	r := vtab.NewRegistry()
+	r.Add(&vtab.ModuleInfo{Name: "b", Module: seriesModule})
+	r.Add(&vtab.ModuleInfo{Name: "a", Module: alphabetModule})
+
+	var names []string
+	for _, info := range r.Modules() {
+		names = append(names, info.Name)
+	}
+	assert.Equal(t, []string{"a", "b"}, names)
+	assert.Equal(t, []string{"start", "stop", "step"}, r.Modules()[1].Arguments())
+
+	assert.Panics(t, func() { r.Add(&vtab.ModuleInfo{Name: "a", Module: alphabetModule}) })
+	assert.Panics(t, func() { r.Add(&vtab.ModuleInfo{Name: vtab.ModulesTable, Module: alphabetModule}) })
+	assert.Panics(t, func() { r.Add(&vtab.ModuleInfo{Name: "c"}) })
+}
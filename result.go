@@ -0,0 +1,90 @@
+package vtab
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// BlobContext is a Context that can report blobs, as can the contexts passed to Row.Column by the table-funcs.
+// It's apart from Context so that the implementations of Context that can't don't break.
+type BlobContext interface {
+	Context
+	ResultBlob(v []byte)
+}
+
+// ResultBlob reports v as a BLOB through ctx, or as TEXT if ctx isn't a BlobContext
+func ResultBlob(ctx Context, v []byte) {
+	if blobs, ok := ctx.(BlobContext); ok {
+		blobs.ResultBlob(v)
+	} else {
+		ctx.ResultText(string(v))
+	}
+}
+
+// resultValue reports an arbitrary Go value through ctx, converting it to the closest SQLite type.
+// Pointers are dereferenced (nil becomes NULL), bools become 0 or 1, time.Time becomes RFC 3339 text,
+// []byte a BLOB, unsigned integers beyond the range of an INTEGER a REAL and anything implementing
+// fmt.Stringer is reported as its string.
+func resultValue(ctx Context, v interface{}) error {
+	// a nil pointer is NULL, even if its type implements fmt.Stringer (with a method that would panic)
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		ctx.ResultNull()
+		return nil
+	}
+
+	switch v := v.(type) {
+	case nil:
+		ctx.ResultNull()
+		return nil
+	case time.Time:
+		if v.IsZero() {
+			ctx.ResultNull()
+		} else {
+			ctx.ResultText(v.Format(time.RFC3339Nano))
+		}
+		return nil
+	case []byte:
+		if v == nil {
+			ctx.ResultNull()
+		} else {
+			ResultBlob(ctx, v)
+		}
+		return nil
+	case fmt.Stringer:
+		ctx.ResultText(v.String())
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			ctx.ResultNull()
+			return nil
+		}
+		return resultValue(ctx, rv.Elem().Interface())
+	case reflect.Bool:
+		if rv.Bool() {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		ctx.ResultInt64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			ctx.ResultFloat(float64(u))
+		} else {
+			ctx.ResultInt64(int64(u))
+		}
+	case reflect.Float32, reflect.Float64:
+		ctx.ResultFloat(rv.Float())
+	case reflect.String:
+		ctx.ResultText(rv.String())
+	default:
+		return fmt.Errorf("unsupported column value of type %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package vtab
+
+import (
+	"math"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultValue(t *testing.T) {
+	var nilURL *url.URL
+	for _, tt := range []struct {
+		v    interface{}
+		want interface{}
+	}{
+		{nilURL, nil},
+		{&url.URL{Scheme: "https", Host: "example.com"}, "https://example.com"},
+		{[]byte("abc"), []byte("abc")},
+		{[]byte(nil), nil},
+		{true, 1},
+		{uint64(42), int64(42)},
+		{uint64(math.MaxUint64), float64(math.MaxUint64)},
+	} {
+		getter := &valueGetter{}
+		if err := resultValue(getter, tt.v); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(getter.value, tt.want) {
+			t.Errorf("resultValue(%#v): wanted: %#v, got: %#v", tt.v, tt.want, getter.value)
+		}
+	}
+}
+
+type owner struct {
+	Owner string
+}
+
+type pet struct {
+	Name string
+	*owner
+}
+
+func TestStructColumnsNilEmbedded(t *testing.T) {
+	column := StructColumns[pet]([]Column{{Name: "name"}, {Name: "owner"}})
+	for _, tt := range []struct {
+		pet  pet
+		want interface{}
+	}{
+		{pet{"rex", &owner{"ann"}}, "ann"},
+		// the field promoted through a nil pointer is NULL
+		{pet{"tom", nil}, nil},
+	} {
+		getter := &valueGetter{}
+		if err := column(getter, tt.pet, 1); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(getter.value, tt.want) {
+			t.Errorf("owner of %s: wanted: %#v, got: %#v", tt.pet.Name, tt.want, getter.value)
+		}
+	}
+}
+
+// textContext is a Context that can't report blobs
+type textContext struct{ valueGetter }
+
+func (textContext) ResultBlob() {}
+
+func TestResultBlob(t *testing.T) {
+	getter := &valueGetter{}
+	ResultBlob(getter, []byte("abc"))
+	assert.Equal(t, []byte("abc"), getter.value)
+
+	text := &textContext{}
+	ResultBlob(text, []byte("abc"))
+	assert.Equal(t, "abc", text.value)
+}
@@ -0,0 +1,147 @@
+package vtab
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"reflect"
+	"strings"
+
+	"go.riyazali.net/sqlite"
+)
+
+// ColumnFunc reports the value of column col for item, much like Row.Column
+type ColumnFunc[T any] func(ctx Context, item T, col int) error
+
+// SeqFunc produces the sequence of items for a query, given its constraints and orders
+type SeqFunc[T any] func(constraints []*Constraint, order []*sqlite.OrderBy) (iter.Seq[T], error)
+
+// Seq2Func produces the sequence of items (and errors) for a query, given its constraints and orders
+type Seq2Func[T any] func(constraints []*Constraint, order []*sqlite.OrderBy) (iter.Seq2[T, error], error)
+
+// FromSeq builds a GetIteratorFunc from an iter.Seq factory, with each item mapped to a row using column.
+// The sequence is pulled one item per row and is stopped when the cursor is closed, even if it's not exhausted.
+func FromSeq[T any](newSeq SeqFunc[T], column ColumnFunc[T]) GetIteratorFunc {
+	return func(constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error) {
+		seq, err := newSeq(constraints, order)
+		if err != nil {
+			return nil, err
+		}
+
+		next, stop := iter.Pull(seq)
+		return &seqIterator[T]{func() (T, error, bool) {
+			item, ok := next()
+			return item, nil, ok
+		}, stop, column}, nil
+	}
+}
+
+// FromSeq2 builds a GetIteratorFunc from an iter.Seq2 factory, with each item mapped to a row using column.
+// A non-nil error in the sequence ends the query with that error.
+func FromSeq2[T any](newSeq Seq2Func[T], column ColumnFunc[T]) GetIteratorFunc {
+	return func(constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error) {
+		seq, err := newSeq(constraints, order)
+		if err != nil {
+			return nil, err
+		}
+
+		next, stop := iter.Pull2(seq)
+		return &seqIterator[T]{func() (T, error, bool) {
+			return next()
+		}, stop, column}, nil
+	}
+}
+
+type seqIterator[T any] struct {
+	next   func() (T, error, bool)
+	stop   func()
+	column ColumnFunc[T]
+}
+
+func (i *seqIterator[T]) Next() (Row, error) {
+	item, err, ok := i.next()
+	if !ok {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &seqRow[T]{item, i.column}, nil
+}
+
+func (i *seqIterator[T]) Close() error {
+	i.stop()
+	return nil
+}
+
+type seqRow[T any] struct {
+	item   T
+	column ColumnFunc[T]
+}
+
+func (r *seqRow[T]) Column(ctx Context, col int) error {
+	return r.column(ctx, r.item, col)
+}
+
+// StructColumns derives a ColumnFunc for struct type T (or a pointer to one) from columns. Each column is
+// matched to the field tagged `vtab:"<name>"`, or otherwise the field whose name matches case-insensitively.
+// It panics if T isn't a struct, or a column has no matching field.
+func StructColumns[T any](columns []Column) ColumnFunc[T] {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	ptr := typ.Kind() == reflect.Ptr
+	if ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("vtab: StructColumns requires a struct type, got %s", typ))
+	}
+
+	fields := make([][]int, len(columns))
+	for c, col := range columns {
+		fields[c] = structField(typ, col.Name)
+		if fields[c] == nil {
+			panic(fmt.Sprintf("vtab: no field in %s for column %q", typ, col.Name))
+		}
+	}
+
+	return func(ctx Context, item T, col int) error {
+		if col < 0 || col >= len(fields) || fields[col] == nil {
+			return fmt.Errorf("unknown column")
+		}
+		v := reflect.ValueOf(item)
+		if ptr {
+			if v.IsNil() {
+				ctx.ResultNull()
+				return nil
+			}
+			v = v.Elem()
+		}
+		field, err := v.FieldByIndexErr(fields[col])
+		if err != nil {
+			// the field is promoted through a nil embedded pointer
+			ctx.ResultNull()
+			return nil
+		}
+		return resultValue(ctx, field.Interface())
+	}
+}
+
+// structField finds the index of the exported field of typ for the named column
+func structField(typ reflect.Type, name string) []int {
+	var byName []int
+	for _, f := range reflect.VisibleFields(typ) {
+		if f.PkgPath != "" || f.Anonymous {
+			continue
+		}
+		if tag, ok := f.Tag.Lookup("vtab"); ok {
+			if strings.Split(tag, ",")[0] == name {
+				return f.Index
+			}
+			continue
+		}
+		if byName == nil && strings.EqualFold(f.Name, name) {
+			byName = f.Index
+		}
+	}
+	return byName
+}
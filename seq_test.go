@@ -0,0 +1,131 @@
+package vtab_test
+
+import (
+	"errors"
+	"iter"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+type planet struct {
+	Name   string
+	Moons  int
+	Ringed bool `vtab:"has_rings"`
+}
+
+var planets = []planet{
+	{"mercury", 0, false}, {"venus", 0, false}, {"earth", 1, false}, {"mars", 2, false},
+	{"jupiter", 95, true}, {"saturn", 146, true}, {"uranus", 28, true}, {"neptune", 16, true},
+}
+
+var planetCols = []vtab.Column{
+	{Name: "name", Type: "TEXT"},
+	{Name: "moons", Type: "INTEGER"},
+	{Name: "has_rings", Type: "INTEGER"},
+}
+
+// planetsStopped counts the sequences that have been stopped (whether exhausted or not)
+var planetsStopped int
+
+var planetsModule = vtab.NewTableFunc("planets", planetCols, vtab.FromSeq(func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (iter.Seq[planet], error) {
+	return func(yield func(planet) bool) {
+		defer func() { planetsStopped++ }()
+		for _, p := range planets {
+			if !yield(p) {
+				return
+			}
+		}
+	}, nil
+}, vtab.StructColumns[planet](planetCols)))
+
+var planetsErrModule = vtab.NewTableFunc("planets_err", planetCols, vtab.FromSeq2(func(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (iter.Seq2[*planet, error], error) {
+	return func(yield func(*planet, error) bool) {
+		for p := range planets {
+			if p == 3 {
+				yield(nil, errors.New("lost contact"))
+				return
+			}
+			if !yield(&planets[p], nil) {
+				return
+			}
+		}
+	}, nil
+}, vtab.StructColumns[*planet](planetCols)))
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("planets", planetsModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("planets_err", planetsErrModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestSeqSimple(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []struct {
+		Name     string `db:"name"`
+		Moons    int    `db:"moons"`
+		HasRings bool   `db:"has_rings"`
+	}
+	err = db.Select(&contents, "select * from planets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 8, len(contents))
+	assert.Equal(t, "mercury", contents[0].Name)
+	assert.Equal(t, 146, contents[5].Moons)
+	assert.True(t, contents[5].HasRings)
+	assert.False(t, contents[2].HasRings)
+}
+
+func TestSeqStopsEarly(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stoppedBefore := planetsStopped
+
+	var contents []string
+	err = db.Select(&contents, "select name from planets limit 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"mercury", "venus"}, contents)
+	assert.Equal(t, 1, planetsStopped-stoppedBefore)
+}
+
+func TestSeq2Error(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var contents []string
+	err = db.Select(&contents, "select name from planets_err")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "lost contact")
+	}
+}
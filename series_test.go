@@ -247,3 +247,21 @@ func TestSeriesAscLE(t *testing.T) {
 	assert.Equal(t, "49", contents[48])
 	assert.Equal(t, "50", contents[49])
 }
+
+func TestSeriesAscLTFractional(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the scan ends past 50.5, not at 50
+	var contents []string
+	err = db.Select(&contents, "select value from series(0, 100, 1) where value < 50.5 order by value asc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 50, len(contents))
+	assert.Equal(t, "50", contents[49])
+}
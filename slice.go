@@ -0,0 +1,165 @@
+package vtab
+
+import (
+	"io"
+	"sort"
+
+	"go.riyazali.net/sqlite"
+)
+
+// MapEntry is a single key/value pair of a map exposed with NewMapTable
+type MapEntry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// NewSliceTable returns a module exposing the slice returned by items as a table, with each element mapped
+// to a row using column (see StructColumns). items is called once per query. Every column supports
+// the =, >, >=, < and <= constraints and ORDER BY in either direction, handled in Go, unless the column
+// declares its own Filters or OrderBy.
+func NewSliceTable[T any](name string, columns []Column, items func() []T, column ColumnFunc[T], opts ...OptFunc) sqlite.Module {
+	return NewSliceTableErr(name, columns, func() ([]T, error) { return items(), nil }, column, opts...)
+}
+
+// NewSliceTableErr is NewSliceTable, for items that may fail to be listed, failing the query with their error
+func NewSliceTableErr[T any](name string, columns []Column, items func() ([]T, error), column ColumnFunc[T], opts ...OptFunc) sqlite.Module {
+	return NewTableFunc(name, sliceColumns(columns), func(constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error) {
+		listed, err := items()
+		if err != nil {
+			return nil, err
+		}
+		return newSliceIterator(listed, column, constraints, order)
+	}, append([]OptFunc{EarlyOrderByConstraintExit(true)}, opts...)...)
+}
+
+// NewMapTable returns a module exposing the map returned by items as a table, with each entry mapped
+// to a row using column. It otherwise behaves like NewSliceTable.
+func NewMapTable[K comparable, V any](name string, columns []Column, items func() map[K]V, column ColumnFunc[MapEntry[K, V]], opts ...OptFunc) sqlite.Module {
+	return NewSliceTable(name, columns, func() []MapEntry[K, V] {
+		m := items()
+		entries := make([]MapEntry[K, V], 0, len(m))
+		for k, v := range m {
+			entries = append(entries, MapEntry[K, V]{k, v})
+		}
+		return entries
+	}, column, opts...)
+}
+
+// sliceFilters are the constraints supported on every column of a slice table
+var sliceFilters = []*ColumnFilter{
+	{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_GT}, {Op: sqlite.INDEX_CONSTRAINT_GE},
+	{Op: sqlite.INDEX_CONSTRAINT_LT}, {Op: sqlite.INDEX_CONSTRAINT_LE},
+}
+
+func sliceColumns(columns []Column) []Column {
+	cols := make([]Column, len(columns))
+	for c, col := range columns {
+		if col.Filters == nil {
+			col.Filters = sliceFilters
+		}
+		if col.OrderBy == NONE {
+			col.OrderBy = ASC | DESC
+		}
+		cols[c] = col
+	}
+	return cols
+}
+
+type sliceIterator[T any] struct {
+	rows    []*seqRow[T]
+	current int
+}
+
+func newSliceIterator[T any](items []T, column ColumnFunc[T], constraints []*Constraint, order []*sqlite.OrderBy) (*sliceIterator[T], error) {
+	rows := make([]*seqRow[T], 0, len(items))
+	keys := make([][]interface{}, 0, len(items))
+
+	// the LIMIT (see PushDownLimit) has no column, and is only passed once every other constraint is handled here
+	limit := int64(-1)
+	var columnConstraints []*Constraint
+	for _, constraint := range constraints {
+		if constraint.ColIndex < 0 {
+			if constraint.Op == INDEX_CONSTRAINT_LIMIT {
+				limit = constraint.Value.Int64()
+			}
+			continue
+		}
+		columnConstraints = append(columnConstraints, constraint)
+	}
+
+outer:
+	for _, item := range items {
+		row := &seqRow[T]{item, column}
+		for _, constraint := range columnConstraints {
+			getter := &valueGetter{}
+			if err := row.Column(getter, constraint.ColIndex); err != nil {
+				return nil, err
+			}
+			if getter.value == nil || constraint.Value.IsNil() {
+				// comparisons with NULL are never true
+				continue outer
+			}
+			// values that can't be compared here are left for SQLite to check
+			if comparison, ok := compareValue(getter.value, constraint.Value); ok && !matchConstraint(comparison, constraint.Op) {
+				continue outer
+			}
+		}
+
+		key := make([]interface{}, len(order))
+		for o, ord := range order {
+			getter := &valueGetter{}
+			if err := row.Column(getter, ord.ColumnIndex); err != nil {
+				return nil, err
+			}
+			key[o] = getter.value
+		}
+
+		rows = append(rows, row)
+		keys = append(keys, key)
+	}
+
+	if len(order) > 0 {
+		sort.Stable(&sliceSorter[T]{rows, keys, order})
+	}
+	if limit >= 0 && int64(len(rows)) > limit {
+		rows = rows[:limit]
+	}
+
+	return &sliceIterator[T]{rows, -1}, nil
+}
+
+func (i *sliceIterator[T]) Next() (Row, error) {
+	i.current++
+	if i.current >= len(i.rows) {
+		return nil, io.EOF
+	}
+	return i.rows[i.current], nil
+}
+
+// sliceSorter sorts rows by their precomputed ORDER BY keys
+type sliceSorter[T any] struct {
+	rows  []*seqRow[T]
+	keys  [][]interface{}
+	order []*sqlite.OrderBy
+}
+
+func (s *sliceSorter[T]) Len() int { return len(s.rows) }
+
+func (s *sliceSorter[T]) Swap(i, j int) {
+	s.rows[i], s.rows[j] = s.rows[j], s.rows[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func (s *sliceSorter[T]) Less(i, j int) bool {
+	for o, ord := range s.order {
+		comparison := compareValues(s.keys[i][o], s.keys[j][o])
+		if comparison == 0 {
+			continue
+		}
+		if ord.Desc {
+			return comparison > 0
+		}
+		return comparison < 0
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package vtab_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/augmentable-dev/vtab"
+	_ "github.com/augmentable-dev/vtab/pkg/sqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.riyazali.net/sqlite"
+)
+
+type service struct {
+	Name     string
+	Port     int
+	Replicas int
+}
+
+var services = []service{
+	{"api", 8080, 3}, {"web", 80, 2}, {"db", 5432, 1}, {"cache", 6379, 2}, {"queue", 5672, 1},
+}
+
+var serviceCols = []vtab.Column{
+	{Name: "name", Type: "TEXT"},
+	{Name: "port", Type: "INTEGER"},
+	{Name: "replicas", Type: "INTEGER"},
+}
+
+var servicesModule = vtab.NewSliceTable("services", serviceCols, func() []service {
+	return services
+}, vtab.StructColumns[service](serviceCols))
+
+// limitedServicesModule is servicesModule, passed the LIMIT of queries
+var limitedServicesModule = vtab.NewSliceTable("limited_services", serviceCols, func() []service {
+	return services
+}, vtab.StructColumns[service](serviceCols), vtab.PushDownLimit(true))
+
+var configs = map[string]int{"timeout": 30, "retries": 5, "workers": 8}
+
+var configCols = []vtab.Column{
+	{Name: "key", Type: "TEXT"},
+	{Name: "value", Type: "INTEGER"},
+}
+
+var configsModule = vtab.NewMapTable("configs", configCols, func() map[string]int {
+	return configs
+}, func(ctx vtab.Context, entry vtab.MapEntry[string, int], col int) error {
+	switch configCols[col].Name {
+	case "key":
+		ctx.ResultText(entry.Key)
+	case "value":
+		ctx.ResultInt(entry.Value)
+	default:
+		return fmt.Errorf("unknown column")
+	}
+	return nil
+})
+
+func init() {
+	sqlite.Register(func(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
+		if err := api.CreateModule("services", servicesModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("limited_services", limitedServicesModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		if err := api.CreateModule("configs", configsModule,
+			sqlite.EponymousOnly(true),
+			sqlite.ReadOnly(true)); err != nil {
+			return sqlite.SQLITE_ERROR, err
+		}
+		return sqlite.SQLITE_OK, nil
+	})
+}
+
+func TestSliceTableEQ(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ports []int
+	err = db.Select(&ports, "select port from services where name = 'db'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []int{5432}, ports)
+}
+
+func TestSliceTableRangeOrderBy(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var names []string
+	err = db.Select(&names, "select name from services where port >= 5000 order by port desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"api", "cache", "queue", "db"}, names)
+}
+
+func TestSliceTableMultipleOrderBy(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var names []string
+	err = db.Select(&names, "select name from services order by replicas asc, name desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"queue", "db", "web", "cache", "api"}, names)
+}
+
+func TestSliceTableRangeSecondOrderBy(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// a row past the constraint on port only ends the rows of its replicas, not the scan
+	var names []string
+	err = db.Select(&names, "select name from services where port > 100 order by replicas, port desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"queue", "db", "cache", "api"}, names)
+}
+
+func TestMapTable(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var keys []string
+	err = db.Select(&keys, "select key from configs where value > 5 order by key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"timeout", "workers"}, keys)
+}
+
+func TestSliceTableFractionalBounds(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// integers are compared with REAL bounds as numbers, not truncated to the bounds' integer part
+	var names []string
+	err = db.Select(&names, "select name from services where port < 80.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"web"}, names)
+
+	names = nil
+	err = db.Select(&names, "select name from services where replicas > 1.5 and port <= 6379.0 order by port desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"cache", "web"}, names)
+
+	names = nil
+	err = db.Select(&names, "select name from services where replicas >= 2.5 order by name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"api"}, names)
+}
+
+func TestSliceTableLimit(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for query, want := range map[string][]string{
+		"select name from limited_services limit 2":                          {"api", "web"},
+		"select name from limited_services order by port desc limit 2":       {"cache", "queue"},
+		"select name from limited_services where port > 1000 limit 2":        {"api", "db"},
+		"select name from limited_services order by name limit 2 offset 1":   {"cache", "db"},
+		"select name from limited_services where replicas = 2 order by name": {"cache", "web"},
+	} {
+		var names []string
+		if err := db.Select(&names, query); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, names, query)
+	}
+}
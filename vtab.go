@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"text/template"
+	"time"
 
 	"go.riyazali.net/sqlite"
 )
@@ -29,8 +31,13 @@ type Column struct {
 	Type    string
 	NotNull bool
 	Hidden  bool
-	Filters []*ColumnFilter
-	OrderBy Orders
+	// PrimaryKey declares the column as the table's PRIMARY KEY, making it a WITHOUT ROWID table.
+	// At most one column may be the primary key, which is required for a Writable table.
+	PrimaryKey bool
+	Filters    []*ColumnFilter
+	OrderBy    Orders
+	// Description documents the column, as listed by vtab_columns and vtab_help (see Registry)
+	Description string
 }
 
 type Constraint struct {
@@ -39,10 +46,27 @@ type Constraint struct {
 	Value    *sqlite.Value
 }
 
+// INDEX_CONSTRAINT_LIMIT and INDEX_CONSTRAINT_OFFSET are the operators of the LIMIT and OFFSET
+// constraints that SQLite (3.38 and later) passes to BestIndex. They aren't associated with a column.
+const (
+	INDEX_CONSTRAINT_LIMIT  sqlite.ConstraintOp = 73
+	INDEX_CONSTRAINT_OFFSET sqlite.ConstraintOp = 74
+)
+
 type GetIteratorFunc func(constraints []*Constraint, order []*sqlite.OrderBy) (Iterator, error)
 
 type options struct {
 	earlyOrderByConstraintExit bool
+	tolerateColumnErrors       bool
+	pushDownLimit              bool
+	writer                     Writer
+	plans                      *PlanRecorder
+	observer                   Observer
+	cache                      *Cache
+	noCache                    bool
+	noCacheColumns             []string
+	description                string
+	examples                   []string
 }
 
 type OptFunc func(*options)
@@ -54,12 +78,75 @@ func EarlyOrderByConstraintExit(value bool) OptFunc {
 	return func(opts *options) { opts.earlyOrderByConstraintExit = value }
 }
 
+// TolerateColumnErrors tells the table-func to report a NULL for any column whose Row.Column returns an error,
+// rather than aborting the query. The errors for each row are exposed through an additional hidden
+// column, _errors, as a JSON array (or NULL if there were none), of the columns used by the query.
+func TolerateColumnErrors(value bool) OptFunc {
+	return func(opts *options) { opts.tolerateColumnErrors = value }
+}
+
+// PushDownLimit tells the table-func to accept a query's LIMIT, when every other constraint is handled by the
+// table-func with a filter that's OmitCheck, and the ORDER BY is consumed too (so that the first rows of the
+// iterator are the rows of the result, none of which SQLite discards). SQLite passes LIMIT from version 3.38.
+// The limit is passed to the iterator as a constraint with the INDEX_CONSTRAINT_LIMIT op and a ColIndex of -1.
+// Iterators may produce more rows than the limit, SQLite still applies it. Queries with an OFFSET aren't pushed down.
+func PushDownLimit(value bool) OptFunc {
+	return func(opts *options) { opts.pushDownLimit = value }
+}
+
+// Writable makes the table-func's table writeable, with INSERT, UPDATE and DELETE statements passed to w.
+// The table must have a PrimaryKey column.
+func Writable(w Writer) OptFunc {
+	return func(opts *options) { opts.writer = w }
+}
+
+// Writer receives the changes made to a Writable table. key is the value of the PrimaryKey column of an
+// existing row, and values are the values of every column (including hidden ones) of a new row, in order.
+// Updating the primary key of a row is passed to Update, with values holding the new key.
+type Writer interface {
+	Insert(values []sqlite.Value) error
+	Update(key sqlite.Value, values []sqlite.Value) error
+	Delete(key sqlite.Value) error
+}
+
 func NewTableFunc(name string, columns []Column, newIterator GetIteratorFunc, opts ...OptFunc) sqlite.Module {
 	opt := &options{}
 	for _, optFunc := range opts {
 		optFunc(opt)
 	}
-	return &tableFuncModule{name, columns, newIterator, opt}
+	return &tableFuncModule{name, opt.declaredColumns(columns), newIterator, opt, nil}
+}
+
+// ConnectFunc decides the columns and iterator of a table from the arguments it's created with.
+// args are as passed to the module's Connect, see ParseArgs for parsing key=value arguments.
+type ConnectFunc func(args []string) ([]Column, GetIteratorFunc, error)
+
+// NewModule is like NewTableFunc, except that the schema of each table is decided from its arguments, as in
+// CREATE VIRTUAL TABLE t USING name(arg=value, ...), rather than being fixed when the module is created.
+func NewModule(name string, connect ConnectFunc, opts ...OptFunc) sqlite.Module {
+	opt := &options{}
+	for _, optFunc := range opts {
+		optFunc(opt)
+	}
+	return &tableFuncModule{name: name, options: opt, connect: connect}
+}
+
+// ModuleColumns returns the columns of a module created with NewTableFunc (or a function built on it, such as
+// NewSliceTable), including any added by its options. It returns nil for other modules, including those
+// of NewModule, whose columns are decided by the arguments of each table.
+func ModuleColumns(m sqlite.Module) []Column {
+	if m, ok := m.(*tableFuncModule); ok && m.connect == nil {
+		return m.columns
+	}
+	return nil
+}
+
+// declaredColumns adds any columns required by the options to columns
+func (opt *options) declaredColumns(columns []Column) []Column {
+	if opt.tolerateColumnErrors {
+		columns = append(columns[:len(columns):len(columns)], Column{Name: ErrorsColumn, Type: "TEXT", Hidden: true})
+	}
+	return columns
 }
 
 type tableFuncModule struct {
@@ -67,6 +154,7 @@ type tableFuncModule struct {
 	columns     []Column
 	getIterator GetIteratorFunc
 	options     *options
+	connect     ConnectFunc
 }
 
 type tableFuncTable struct {
@@ -80,8 +168,16 @@ type tableFuncCursor struct {
 	current     Row
 	order       []*sqlite.OrderBy
 	constraints []*Constraint
+	columnsUsed ColumnSet
+	rowErrors   []*rowError
+	// plan is the recorded plan the cursor was filtered with, if plans are recorded
+	plan *Plan
+	// scan is the observer of the current scan, if the table-func is observed
+	scan ScanObserver
 }
 
+// Iterator produces the rows of a table-func. If an Iterator also implements io.Closer,
+// Close is called once the cursor is done with it, which may be before Next returns io.EOF.
 type Iterator interface {
 	Next() (Row, error)
 }
@@ -104,18 +200,22 @@ type Row interface {
 
 // createTableSQL produces the SQL to declare a new virtual table
 func (m *tableFuncModule) createTableSQL() (string, error) {
-	// TODO needs to support WITHOUT ROWID, PRIMARY KEY, NOT NULL
-	const declare = `CREATE TABLE {{ .Name }} (
+	// TODO needs to support NOT NULL
+	const declare = `CREATE TABLE {{ ident .Name }} (
   {{- range $c, $col := .Columns }}
-    {{ .Name }} {{ .Type }}{{ if .Hidden }} HIDDEN{{ end }}{{ if columnComma $c }},{{ end }}
+    {{ ident .Name }} {{ .Type }}{{ if .Hidden }} HIDDEN{{ end }}{{ if .PrimaryKey }} PRIMARY KEY{{ end }}{{ if columnComma $c }},{{ end }}
   {{- end }}
-)`
+){{ if withoutRowid }} WITHOUT ROWID{{ end }}`
 
 	// helper to determine whether we're on the last column (and therefore should avoid a comma ",") in the range
 	fns := template.FuncMap{
+		"ident": QuoteIdent,
 		"columnComma": func(c int) bool {
 			return c < len(m.columns)-1
 		},
+		"withoutRowid": func() bool {
+			return m.primaryKey() >= 0
+		},
 	}
 	tmpl, err := template.New(fmt.Sprintf("declare_table_func_%s", m.name)).Funcs(fns).Parse(declare)
 	if err != nil {
@@ -137,7 +237,25 @@ func (m *tableFuncModule) createTableSQL() (string, error) {
 	return buf.String(), nil
 }
 
-func (m *tableFuncModule) Connect(_ *sqlite.Conn, _ []string, declare func(string) error) (sqlite.VirtualTable, error) {
+// primaryKey returns the index of the PrimaryKey column, or -1 if there's none
+func (m *tableFuncModule) primaryKey() int {
+	for c, col := range m.columns {
+		if col.PrimaryKey {
+			return c
+		}
+	}
+	return -1
+}
+
+func (m *tableFuncModule) Connect(_ *sqlite.Conn, args []string, declare func(string) error) (sqlite.VirtualTable, error) {
+	if m.connect != nil {
+		columns, getIterator, err := m.connect(args)
+		if err != nil {
+			return nil, err
+		}
+		m = &tableFuncModule{m.name, m.options.declaredColumns(columns), getIterator, m.options, nil}
+	}
+
 	str, err := m.createTableSQL()
 	if err != nil {
 		return nil, err
@@ -148,6 +266,12 @@ func (m *tableFuncModule) Connect(_ *sqlite.Conn, _ []string, declare func(strin
 		return nil, err
 	}
 
+	if m.options.writer != nil {
+		if m.primaryKey() < 0 {
+			return nil, fmt.Errorf("%s: a writable table requires a primary key column", m.name)
+		}
+		return &writableTableFuncTable{tableFuncTable{m}}, nil
+	}
 	return &tableFuncTable{m}, nil
 }
 
@@ -156,15 +280,27 @@ func (m *tableFuncModule) Destroy() error {
 }
 
 func (t *tableFuncTable) Open() (sqlite.VirtualCursor, error) {
-	return &tableFuncCursor{t, nil, 0, nil, nil, nil}, nil
+	return &tableFuncCursor{t, nil, 0, nil, nil, nil, AllColumns, nil, nil, nil}, nil
 }
 
 type index struct {
 	Constraints []*Constraint
 	Orders      []*sqlite.OrderBy
+	ColumnsUsed ColumnSet
+	// Plan is the ID of the plan recorded, if plans are recorded
+	Plan int64 `json:",omitempty"`
 }
 
 func (t *tableFuncTable) BestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, error) {
+	output, plan, err := t.bestIndex(input)
+	if t.options.observer != nil {
+		t.observeBestIndex(input, output, plan, err)
+	}
+	return output, err
+}
+
+// bestIndex returns the plan of a query, along with its recorded Plan, if plans are recorded
+func (t *tableFuncTable) bestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexInfoOutput, *Plan, error) {
 	// start with a relatively high cost
 	cost := 1000.0
 	usage := make([]*sqlite.ConstraintUsage, len(input.Constraints))
@@ -175,6 +311,11 @@ func (t *tableFuncTable) BestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexI
 
 	orderByUsed := true
 	for _, order := range input.OrderBy {
+		// the rowid (-1) can't be ordered by
+		if order.ColumnIndex < 0 || order.ColumnIndex >= len(t.columns) {
+			orderByUsed = false
+			continue
+		}
 		col := t.columns[order.ColumnIndex]
 		if col.OrderBy&ASC != 0 && !order.Desc {
 			idx.Orders = append(idx.Orders, order)
@@ -188,40 +329,90 @@ func (t *tableFuncTable) BestIndex(input *sqlite.IndexInfoInput) (*sqlite.IndexI
 	}
 
 	// iterate over constraints
+	// allOmitted is whether every constraint is used and omitted, so that SQLite keeps each row of the iterator
+	limit, offset, allOmitted := -1, false, true
 	for cst, constraint := range input.Constraints {
 		usage[cst] = &sqlite.ConstraintUsage{}
 
 		if !constraint.Usable {
-			return nil, sqlite.SQLITE_CONSTRAINT
+			return nil, nil, sqlite.SQLITE_CONSTRAINT
+		}
+
+		// LIMIT and OFFSET have no column, and can only be used once the other constraints are known
+		switch constraint.Op {
+		case INDEX_CONSTRAINT_LIMIT:
+			limit = cst
+			continue
+		case INDEX_CONSTRAINT_OFFSET:
+			offset = true
+			continue
+		}
+
+		// constraints on the rowid (-1) can't be used
+		if constraint.ColumnIndex < 0 || constraint.ColumnIndex >= len(t.columns) {
+			allOmitted = false
+			continue
 		}
 
 		// iterate over the declared constraints the column supports
 		col := t.columns[constraint.ColumnIndex]
+		used := false
 		for _, filter := range col.Filters {
 			// if there's a match, reduce the cost (to prefer usage of this constraint)
 			if filter.Op == constraint.Op {
 				cost -= 10
+				used = true
 				usage[cst].ArgvIndex = len(idx.Constraints) + 1
 				usage[cst].Omit = filter.OmitCheck
 				idx.Constraints = append(idx.Constraints, &Constraint{
 					ColIndex: constraint.ColumnIndex,
 					Op:       filter.Op,
 				})
+				// each constraint is passed once, even if the column declares its filter more than once
+				break
 			}
 		}
+		allOmitted = allOmitted && used && usage[cst].Omit
 	}
 
-	idxStr, err := json.Marshal(idx)
-	if err != nil {
-		return nil, err
+	if t.options.pushDownLimit && limit >= 0 && !offset && allOmitted && orderByUsed {
+		cost -= 10
+		usage[limit].ArgvIndex = len(idx.Constraints) + 1
+		idx.Constraints = append(idx.Constraints, &Constraint{ColIndex: -1, Op: INDEX_CONSTRAINT_LIMIT})
+	}
+
+	idx.ColumnsUsed = AllColumns
+	if input.ColUsed != nil {
+		idx.ColumnsUsed = ColumnSet(*input.ColUsed)
 	}
 
-	return &sqlite.IndexInfoOutput{
+	output := &sqlite.IndexInfoOutput{
 		EstimatedCost:   cost,
-		IndexString:     string(idxStr),
 		ConstraintUsage: usage,
 		OrderByConsumed: orderByUsed,
-	}, nil
+	}
+	var plan *Plan
+	if t.options.plans != nil {
+		plan = t.newPlan(input, output)
+		idx.Plan = t.options.plans.record(plan)
+	}
+
+	idxStr, err := json.Marshal(idx)
+	if err != nil {
+		return nil, nil, err
+	}
+	output.IndexString = string(idxStr)
+	return output, plan, nil
+}
+
+// DecodeIndex decodes the IndexString returned by the BestIndex of a table-func's table, into the constraints
+// (without their values, which are passed to Filter in this order) and orders passed to its iterator.
+func DecodeIndex(indexString string) ([]*Constraint, []*sqlite.OrderBy, error) {
+	var idx index
+	if err := json.Unmarshal([]byte(indexString), &idx); err != nil {
+		return nil, nil, err
+	}
+	return idx.Constraints, idx.Orders, nil
 }
 
 func (t *tableFuncTable) Disconnect() error {
@@ -243,137 +434,155 @@ func (c *tableFuncCursor) Filter(idxNum int, idxName string, values ...sqlite.Va
 
 	c.order = idx.Orders
 	c.constraints = idx.Constraints
+	c.columnsUsed = idx.ColumnsUsed
+	c.plan = nil
+	if c.options.plans != nil {
+		if c.plan = c.options.plans.plan(idx.Plan); c.plan != nil {
+			atomic.AddInt64(&c.plan.filters, 1)
+		}
+	}
 
-	iter, err := c.getIterator(idx.Constraints, idx.Orders)
-	if err != nil {
+	if err := c.closeIterator(); err != nil {
 		return err
 	}
+	if c.options.observer != nil {
+		c.scan = c.options.observer.Filter(&Scan{c.name, c.columns, idx.Constraints, idx.Orders})
+	}
+
+	iter, err := c.newIterator(&idx)
+	if err != nil {
+		return c.observeError(c.translateError(err, -1))
+	}
 	c.iterator = iter
 
+	start := time.Now()
 	row, err := iter.Next()
+	c.observeNext(start, row, err)
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			c.current = nil
 			return nil
 		}
-		return err
+		return c.observeError(c.translateError(err, -1))
 	}
 
 	c.current = row
+	c.rowErrors = nil
 	return nil
 }
 
+// newIterator returns the iterator of a scan, replaying its rows if they're cached, or recording them
+// if they're cacheable
+func (c *tableFuncCursor) newIterator(idx *index) (Iterator, error) {
+	var key string
+	cacheable := false
+	if cache := c.options.cache; cache != nil {
+		if key, cacheable = c.cacheKey(idx.Constraints, idx.Orders, idx.ColumnsUsed); cacheable {
+			if rows, ok := cache.get(key); ok {
+				return &cachedIterator{rows: rows}, nil
+			}
+		}
+	}
+
+	iter, err := c.getIterator(idx.Constraints, idx.Orders)
+	if err != nil {
+		return nil, err
+	}
+	if iter, ok := iter.(ColumnsUsedIterator); ok {
+		iter.ColumnsUsed(idx.ColumnsUsed)
+	}
+	if cacheable {
+		return c.newCachingIterator(iter, c.options.cache, key, idx.ColumnsUsed), nil
+	}
+	return iter, nil
+}
+
 // earlyOrderByConstraintExit determines if there should be an early exit, based on supplied ORDER BYs
-// and any of <, >=, <, or <= constraints on corresponding columns
+// and any of <, >=, <, or <= constraints on corresponding columns. Only the first ORDER BY is considered,
+// as rows are only ordered by the later ones within the rows of equal earlier ones.
 func (c *tableFuncCursor) earlyOrderByConstraintExit() error {
-outer:
-	for _, order := range c.order {
-		for _, constraint := range c.constraints {
-			if order.ColumnIndex == constraint.ColIndex {
-				// limit := constraint.Value.Blob()
-
-				getter := &valueGetter{}
-				err := c.current.Column(getter, constraint.ColIndex)
-				if err != nil {
-					return err
-				}
-
-				var comparison int
-				switch v := getter.value.(type) {
-				case int:
-					limit := constraint.Value.Int()
-					switch {
-					case v == limit:
-						comparison = 0
-					case v < limit:
-						comparison = -1
-					case v > limit:
-						comparison = 1
-					}
-				case int64:
-					limit := constraint.Value.Int64()
-					switch {
-					case v == limit:
-						comparison = 0
-					case v < limit:
-						comparison = -1
-					case v > limit:
-						comparison = 1
-					}
-				case string:
-					limit := constraint.Value.Text()
-					switch {
-					case v == limit:
-						comparison = 0
-					case v < limit:
-						comparison = -1
-					case v > limit:
-						comparison = 1
-					}
-				case float64:
-					limit := constraint.Value.Float()
-					switch {
-					case v == limit:
-						comparison = 0
-					case v < limit:
-						comparison = -1
-					case v > limit:
-						comparison = 1
-					}
-				case []byte:
-					limit := constraint.Value.Blob()
-					comparison = bytes.Compare(v, limit)
-				default:
-					break outer
-				}
-
-				switch constraint.Op {
-				case sqlite.INDEX_CONSTRAINT_GT:
-					if order.Desc {
-						if comparison <= 0 {
-							c.current = nil
-							return nil
-						}
-					}
-				case sqlite.INDEX_CONSTRAINT_GE:
-					if order.Desc {
-						if comparison < 0 {
-							c.current = nil
-							return nil
-						}
-					}
-				case sqlite.INDEX_CONSTRAINT_LT:
-					if !order.Desc {
-						if comparison >= 0 {
-							c.current = nil
-							return nil
-						}
-					}
-				case sqlite.INDEX_CONSTRAINT_LE:
-					if !order.Desc {
-						if comparison > 0 {
-							c.current = nil
-							return nil
-						}
-					}
-				}
+	if len(c.order) == 0 {
+		return nil
+	}
+	order := c.order[0]
+	if !hasConstraint(c.constraints, order.ColumnIndex) {
+		return nil
+	}
+
+	getter := &valueGetter{}
+	err := c.current.Column(getter, order.ColumnIndex)
+	if err != nil {
+		return err
+	}
+
+	if past, ok := pastConstraints(getter.value, c.constraints, order.ColumnIndex, order.Desc); ok && past {
+		c.current = nil
+	}
+	return nil
+}
+
+func hasConstraint(constraints []*Constraint, col int) bool {
+	for _, constraint := range constraints {
+		if constraint.ColIndex == col {
+			return true
+		}
+	}
+	return false
+}
+
+// pastConstraints reports whether v, the value of column col in rows ordered by col (descending if desc),
+// is beyond the bound of one of the >, >=, < or <= constraints on col, so that no later row can satisfy it.
+// ok is false if v can't be compared with the constraints.
+func pastConstraints(v interface{}, constraints []*Constraint, col int, desc bool) (past bool, ok bool) {
+	for _, constraint := range constraints {
+		if constraint.ColIndex != col {
+			continue
+		}
+
+		comparison, ok := compareValue(v, constraint.Value)
+		if !ok {
+			return false, false
+		}
+
+		switch constraint.Op {
+		case sqlite.INDEX_CONSTRAINT_GT:
+			if desc && comparison <= 0 {
+				return true, true
+			}
+		case sqlite.INDEX_CONSTRAINT_GE:
+			if desc && comparison < 0 {
+				return true, true
+			}
+		case sqlite.INDEX_CONSTRAINT_LT:
+			if !desc && comparison >= 0 {
+				return true, true
+			}
+		case sqlite.INDEX_CONSTRAINT_LE:
+			if !desc && comparison > 0 {
+				return true, true
 			}
 		}
 	}
-	return nil
+	return false, true
 }
 
 func (c *tableFuncCursor) Next() error {
 	defer func() { c.count++ }()
+	if c.plan != nil {
+		atomic.AddInt64(&c.plan.nexts, 1)
+	}
+	start := time.Now()
 	row, err := c.iterator.Next()
+	c.observeNext(start, row, err)
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			c.current = nil
 			return nil
 		}
-		return err
+		return c.observeError(c.translateError(err, -1))
 	}
 	c.current = row
+	c.rowErrors = nil
 
 	if c.tableFuncModule.options.earlyOrderByConstraintExit {
 		err := c.earlyOrderByConstraintExit()
@@ -381,14 +590,33 @@ func (c *tableFuncCursor) Next() error {
 			c.current = nil
 			return nil
 		}
-		return err
+		if c.current == nil && c.scan != nil {
+			c.scan.EarlyExit()
+		}
+		return c.observeError(c.translateError(err, -1))
 	}
 
 	return nil
 }
 
 func (c *tableFuncCursor) Column(ctx *sqlite.VirtualTableContext, col int) error {
-	return c.current.Column(ctx, col)
+	if c.options.tolerateColumnErrors {
+		return c.tolerantColumn(ctx, col)
+	}
+
+	err := c.current.Column(ctx, col)
+	if err == nil {
+		return nil
+	}
+
+	// an *Error is reported through the context, so that SQLite sees both its message and its code
+	err = c.observeError(c.annotateError(err, col))
+	var e *Error
+	if errors.As(err, &e) {
+		ResultErrorCode(ctx, e.code(), e)
+		return nil
+	}
+	return err
 }
 
 func (c *tableFuncCursor) Eof() bool {
@@ -400,5 +628,60 @@ func (c *tableFuncCursor) Rowid() (int64, error) {
 }
 
 func (c *tableFuncCursor) Close() error {
+	return c.closeIterator()
+}
+
+// closeIterator closes the current iterator, if it implements io.Closer, ending the current scan
+func (c *tableFuncCursor) closeIterator() error {
+	if c.scan != nil {
+		c.scan.Close()
+		c.scan = nil
+	}
+	if closer, ok := c.iterator.(io.Closer); ok {
+		c.iterator = nil
+		return closer.Close()
+	}
 	return nil
 }
+
+// writableTableFuncTable is the table of a Writable table-func
+type writableTableFuncTable struct {
+	tableFuncTable
+}
+
+// columnValues returns the values of the columns of a new row, from the arguments of an xUpdate call,
+// which may be preceded by the row's rowid (or primary key)
+func (t *writableTableFuncTable) columnValues(values []sqlite.Value) []sqlite.Value {
+	if len(values) > len(t.columns) {
+		return values[len(values)-len(t.columns):]
+	}
+	return values
+}
+
+func (t *writableTableFuncTable) Insert(values ...sqlite.Value) (int64, error) {
+	defer t.invalidateCache()
+	return 0, t.translateError(t.options.writer.Insert(t.columnValues(values)), -1)
+}
+
+func (t *writableTableFuncTable) Update(key sqlite.Value, values ...sqlite.Value) error {
+	defer t.invalidateCache()
+	return t.translateError(t.options.writer.Update(key, t.columnValues(values)), -1)
+}
+
+func (t *writableTableFuncTable) Replace(old, _ sqlite.Value, values ...sqlite.Value) error {
+	defer t.invalidateCache()
+	return t.translateError(t.options.writer.Update(old, t.columnValues(values)), -1)
+}
+
+func (t *writableTableFuncTable) Delete(key sqlite.Value) error {
+	defer t.invalidateCache()
+	return t.translateError(t.options.writer.Delete(key), -1)
+}
+
+// invalidateCache discards the cached scans of the table, which may have been changed by a write
+// (even a failed one, which may have been partly applied)
+func (t *writableTableFuncTable) invalidateCache() {
+	if t.options.cache != nil {
+		t.options.cache.Invalidate(t.name)
+	}
+}
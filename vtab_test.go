@@ -31,3 +31,29 @@ func TestCreateTableSQL(t *testing.T) {
 		t.Fatalf("wanted: %s, got: %s", want, str)
 	}
 }
+
+func TestCreateTableSQLQuoted(t *testing.T) {
+	m := &tableFuncModule{
+		name: "test_table",
+		columns: []Column{
+			{Name: "order", Type: "TEXT"},
+			{Name: "first name", Type: "TEXT"},
+			{Name: `say "hi"`, Type: "TEXT", Hidden: true},
+		},
+	}
+
+	str, err := m.createTableSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `CREATE TABLE test_table (
+    "order" TEXT,
+    "first name" TEXT,
+    "say ""hi""" TEXT HIDDEN
+)`
+
+	if str != want {
+		t.Fatalf("wanted: %s, got: %s", want, str)
+	}
+}